@@ -0,0 +1,53 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	textsearch "textscout/inmemsearch"
+)
+
+func runAnalyze(fs *flag.FlagSet, args []string) error {
+	var analyzerName, text string
+	fs.StringVar(&analyzerName, "analyzer", textsearch.StandardAnalyzer, "analyzer to run the text through. possible values are "+strings.Join(textsearch.AnalyzerNames(), ", "))
+	fs.StringVar(&text, "text", "", "text to analyze, the args are analyzed when it isn't set")
+	rest := parseArgs(fs, args)
+	if text == "" {
+		text = strings.Join(rest, " ")
+	}
+	// doesn't need a database or an index, so the config isn't read
+	if text == "" {
+		return fmt.Errorf("%w: specify the text to analyze", errUsage)
+	}
+	analyzer, err := textsearch.GetAnalyzer(analyzerName)
+	if err != nil {
+		return err
+	}
+
+	for _, stage := range analyzer.Stages(text) {
+		fmt.Printf("%s:\n", stage.Name)
+		for _, token := range stage.Tokens {
+			fmt.Printf("  %-20s position=%d offsets=%d-%d\n", token.Term, token.Position, token.StartOffset, token.EndOffset)
+		}
+	}
+	return nil
+}
+
+// prints the merged config even when it is invalid, so the setting at fault can be found
+func runConfig(fs *flag.FlagSet, args []string) error {
+	var configFlags configFlags
+	configFlags.register(fs)
+	rest := parseArgs(fs, args)
+	if len(rest) != 1 || rest[0] != "print" {
+		return fmt.Errorf("%w: specify print after config", errUsage)
+	}
+
+	config, err := configFlags.load(fs)
+	if config != nil {
+		if printErr := config.Print(os.Stdout); printErr != nil {
+			return printErr
+		}
+	}
+	return err
+}
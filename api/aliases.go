@@ -0,0 +1,160 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+type aliasRequest struct {
+	// collection the alias should point at
+	Collection string `json:"collection"`
+	// delete the collection the alias pointed at before, it is released once
+	// the searches running on it finish
+	ReleasePrevious bool `json:"release_previous,omitempty"`
+}
+
+type aliasInfo struct {
+	Alias      string `json:"alias"`
+	Collection string `json:"collection"`
+	// collection the alias pointed at before the swap
+	Previous string `json:"previous,omitempty"`
+}
+
+// SetAlias atomically points the alias at the collection, searches started after
+// it returns use the new collection while the ones running keep the old one.
+// An alias takes precedence over a collection with the same name, so the collection
+// a server was started with can be swapped out by an alias of its name.
+// Returns the name of the collection the alias resolved to before.
+func (c *Collections) SetAlias(alias string, target string, releasePrevious bool) (string, error) {
+	if !collectionNameRegex.MatchString(alias) {
+		return "", fmt.Errorf("alias must be lowercase letters, digits, - or _, got: %q", alias)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, ok := c.aliases[target]; ok {
+		return "", fmt.Errorf("%s is an alias, aliases can only point at collections", target)
+	}
+	collection, ok := c.collections[target]
+	if !ok {
+		return "", fmt.Errorf("collection %s not found", target)
+	}
+	if collection.status != collectionReady {
+		return "", fmt.Errorf("collection %s is %s", target, collection.status)
+	}
+
+	previous, ok := c.aliases[alias]
+	if !ok {
+		if _, shadowed := c.collections[alias]; shadowed {
+			previous = alias
+		}
+	}
+	c.aliases[alias] = target
+	log.Printf("pointed the alias %s at the collection %s", alias, target)
+
+	if releasePrevious && previous != "" && previous != target && len(c.aliasesOf(previous)) == 0 {
+		if old, ok := c.collections[previous]; ok {
+			c.remove(old)
+		}
+	}
+	return previous, nil
+}
+
+func (c *Collections) DeleteAlias(alias string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.aliases[alias]; !ok {
+		return false
+	}
+	delete(c.aliases, alias)
+	log.Printf("deleted the alias %s", alias)
+	return true
+}
+
+func (c *Collections) Aliases() []aliasInfo {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	infos := make([]aliasInfo, 0, len(c.aliases))
+	for alias, target := range c.aliases {
+		infos = append(infos, aliasInfo{Alias: alias, Collection: target})
+	}
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].Alias < infos[j].Alias
+	})
+	return infos
+}
+
+// names of the aliases pointing at the collection, must be called with the lock held
+func (c *Collections) aliasesOf(name string) []string {
+	aliases := make([]string, 0)
+	for alias, target := range c.aliases {
+		if target == name {
+			aliases = append(aliases, alias)
+		}
+	}
+	sort.Strings(aliases)
+	return aliases
+}
+
+// ServeAliases manages the aliases
+// Endpoints:
+// GET    localhost:8080/api/v1/aliases             lists the aliases
+// GET    localhost:8080/api/v1/aliases/{alias}     describes the alias
+// PUT    localhost:8080/api/v1/aliases/{alias}     points the alias at a collection, body is an aliasRequest
+// DELETE localhost:8080/api/v1/aliases/{alias}     deletes the alias, the collection is kept
+func (c *Collections) ServeAliases(w http.ResponseWriter, r *http.Request) {
+	alias := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/v1/aliases"), "/")
+	if alias == "" {
+		if r.Method != http.MethodGet {
+			httpError(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{"aliases": c.Aliases()})
+		return
+	}
+	if strings.Contains(alias, "/") {
+		notFound(w, r)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		for _, info := range c.Aliases() {
+			if info.Alias == alias {
+				writeJSON(w, http.StatusOK, info)
+				return
+			}
+		}
+		httpError(w, fmt.Sprintf("alias %s not found", alias), http.StatusNotFound)
+
+	case http.MethodPut:
+		var req aliasRequest
+		decoder := json.NewDecoder(r.Body)
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(&req); err != nil {
+			httpError(w, fmt.Sprintf("invalid alias: %s", err.Error()), http.StatusBadRequest)
+			return
+		}
+		previous, err := c.SetAlias(alias, req.Collection, req.ReleasePrevious)
+		if err != nil {
+			httpError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		writeJSON(w, http.StatusOK, aliasInfo{Alias: alias, Collection: req.Collection, Previous: previous})
+
+	case http.MethodDelete:
+		if !c.DeleteAlias(alias) {
+			httpError(w, fmt.Sprintf("alias %s not found", alias), http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		httpError(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+	}
+}
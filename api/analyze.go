@@ -0,0 +1,51 @@
+package api
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	textsearch "textscout/inmemsearch"
+)
+
+type analyzeResponse struct {
+	Analyzer string                     `json:"analyzer"`
+	Text     string                     `json:"text"`
+	Stages   []textsearch.AnalysisStage `json:"stages"`
+}
+
+// Analyze shows what every step of the analyzer does to the text
+// Endpoint: localhost:8080/api/v1/analyze?analyzer=standard&text=""
+func Analyze(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		httpError(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	values := r.URL.Query()
+	text := values.Get("text")
+	if text == "" {
+		httpError(w, "query parameter text is required", http.StatusBadRequest)
+		return
+	}
+
+	analyzer, err := textsearch.GetAnalyzer(values.Get("analyzer"))
+	if err != nil {
+		httpError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	jsonBytes, err := json.Marshal(analyzeResponse{
+		Analyzer: analyzer.Name,
+		Text:     text,
+		Stages:   analyzer.Stages(text),
+	})
+	if err != nil {
+		log.Printf("failed to marshal the analyze resp: %+v", err)
+		httpError(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(jsonBytes)
+}
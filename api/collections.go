@@ -0,0 +1,553 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"textscout/common"
+	"textscout/internal/backend"
+	"textscout/internal/dataset"
+	"time"
+)
+
+var collectionNameRegex = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)
+
+var (
+	errCollectionNotFound = errors.New("collection not found")
+	errCollectionNotReady = errors.New("collection is not ready")
+)
+
+// states of a collection
+const (
+	collectionBuilding = "building"
+	collectionReady    = "ready"
+	collectionFailed   = "failed"
+)
+
+// how a collection is built and searched
+type CollectionSettings struct {
+	// name of the backend, database, postgresFTS, trigram or inmemIndex. the database only stores movies
+	SearchBy string `json:"search_by"`
+	// dataset the in-memory index is built from, its file_path, format and csv_header_map
+	dataset.Source
+	// schema of the documents, either a path to a schema file or the schema itself.
+	// defaults to the movies schema when both are empty
+	SchemaPath string          `json:"schema_path,omitempty"`
+	Schema     json.RawMessage `json:"schema,omitempty"`
+	// and (default) or or, whether a document has to match all the query tokens or any of them
+	DefaultOperator string `json:"default_operator,omitempty"`
+	// cap on the number of documents a search returns, 0 returns all of them
+	MaxResults int `json:"max_results,omitempty"`
+	// minimum word similarity, between 0 and 1, of a movie matched when searching by trigram. defaults to 0.6
+	TrigramThreshold float64 `json:"trigram_threshold,omitempty"`
+	// build the in-memory index from the movies table instead of file_path and keep it in sync
+	// with the changes made to the table
+	SyncFromDatabase bool `json:"sync_from_database,omitempty"`
+	// file of the database when searching by sqlite, defaults to textscout.db
+	SQLitePath string `json:"sqlite_path,omitempty"`
+}
+
+// a named index with its own schema and settings
+type Collection struct {
+	Name     string
+	Settings CollectionSettings
+	// building, ready or failed, guarded by the Collections lock like api and err
+	status string
+	err    error
+	api    *SearchAPI
+	// when the index was built and how long that took
+	builtAt   time.Time
+	buildTime time.Duration
+	// searches running on the collection, once deleted it is released after they finish
+	inflight sync.WaitGroup
+}
+
+type collectionRequest struct {
+	Name string `json:"name"`
+	// the api always builds the index in the background and responds right away, the collection
+	// can be searched once its status is ready. kept so the requests which set it still decode
+	Background bool `json:"background,omitempty"`
+	CollectionSettings
+}
+
+type collectionInfo struct {
+	Name            string `json:"name"`
+	Status          string `json:"status"`
+	Error           string `json:"error,omitempty"`
+	Schema          string `json:"schema,omitempty"`
+	SearchBy        string `json:"search_by"`
+	DefaultOperator string `json:"default_operator"`
+	MaxResults      int    `json:"max_results,omitempty"`
+	// number of documents in the in-memory index, not reported for the database
+	Documents *int `json:"documents,omitempty"`
+	// aliases pointing at the collection
+	Aliases []string `json:"aliases,omitempty"`
+}
+
+// Collections serves every named collection of the process
+// Endpoints:
+// GET    localhost:8080/api/v1/collections                                   lists the collections
+// POST   localhost:8080/api/v1/collections                                   creates a collection from a collectionRequest
+// GET    localhost:8080/api/v1/collections/{name}                            describes the collection
+// DELETE localhost:8080/api/v1/collections/{name}                            deletes the collection
+// GET    localhost:8080/api/v1/collections/{name}/search?...                 same as /api/v1/search
+// GET    localhost:8080/api/v1/collections/{name}/documents/{id}/similar     same as /api/v1/movies/{id}/similar
+// POST   localhost:8080/api/v1/collections/{name}/documents[/_bulk]          same as /api/v1/documents[/_bulk]
+// PUT    localhost:8080/api/v1/collections/{name}/documents/{id}             same as /api/v1/documents/{id}, so is DELETE
+// {name} can also be an alias when searching or writing documents, see Aliases
+type Collections struct {
+	config *common.Config
+
+	mu          sync.RWMutex
+	collections map[string]*Collection
+	// alias to the name of the collection it points at
+	aliases map[string]string
+}
+
+func NewCollections(config *common.Config) *Collections {
+	return &Collections{
+		config:      config,
+		collections: make(map[string]*Collection),
+		aliases:     make(map[string]string),
+	}
+}
+
+// creates every collection listed in the json file, a json array of collectionRequest
+func (c *Collections) LoadFile(filePath string) error {
+	jsonBytes, err := os.ReadFile(filePath)
+	if err != nil {
+		return fmt.Errorf("failed to read the collections file: %w", err)
+	}
+
+	var requests []collectionRequest
+	if err := json.Unmarshal(jsonBytes, &requests); err != nil {
+		return fmt.Errorf("failed to unmarshal the collections file: %w", err)
+	}
+	for _, req := range requests {
+		if _, err := c.Create(req.Name, req.CollectionSettings); err != nil {
+			return fmt.Errorf("collection %s: %w", req.Name, err)
+		}
+	}
+	return nil
+}
+
+// builds the index of the collection and adds it, the name must not be taken
+func (c *Collections) Create(name string, settings CollectionSettings) (*Collection, error) {
+	collection, err := c.reserve(name, settings)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.build(collection); err != nil {
+		c.mu.Lock()
+		if c.collections[name] == collection {
+			delete(c.collections, name)
+		}
+		c.mu.Unlock()
+		return nil, err
+	}
+	return collection, nil
+}
+
+// adds the collection right away with the building status and builds its index
+// in the background, a failed build is kept with its error so it can be inspected
+func (c *Collections) CreateInBackground(name string, settings CollectionSettings) (*Collection, error) {
+	collection, err := c.reserve(name, settings)
+	if err != nil {
+		return nil, err
+	}
+	go c.build(collection)
+	return collection, nil
+}
+
+// validates the settings and claims the name for a collection which is yet to be built
+func (c *Collections) reserve(name string, settings CollectionSettings) (*Collection, error) {
+	if !collectionNameRegex.MatchString(name) {
+		return nil, fmt.Errorf("collection name must be lowercase letters, digits, - or _, got: %q", name)
+	}
+	if err := settings.Validate(); err != nil {
+		return nil, err
+	}
+	// checked by Validate, stored in its canonical form
+	settings.Format, _ = dataset.ParseFormat(string(settings.Format))
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.collections[name]; ok {
+		return nil, fmt.Errorf("collection %s already exists", name)
+	}
+	collection := &Collection{Name: name, Settings: settings, status: collectionBuilding}
+	c.collections[name] = collection
+	return collection, nil
+}
+
+// Validate checks the settings are consistent, the backend and the dataset are only opened when the collection is built
+func (settings CollectionSettings) Validate() error {
+	switch settings.DefaultOperator {
+	case "", "and", "or":
+	default:
+		return fmt.Errorf("default_operator must be and or or, got: %q", settings.DefaultOperator)
+	}
+	if settings.MaxResults < 0 {
+		return fmt.Errorf("max_results must not be negative")
+	}
+	if !backend.Registered(settings.SearchBy) {
+		return fmt.Errorf("search_by must be one of %s, got: %q", strings.Join(backend.Names(), ", "), settings.SearchBy)
+	}
+	if settings.TrigramThreshold < 0 || settings.TrigramThreshold > 1 {
+		return fmt.Errorf("trigram_threshold must be between 0 and 1, got: %v", settings.TrigramThreshold)
+	}
+	if settings.SearchBy == backend.InMemIndex && settings.Path == "" && !settings.SyncFromDatabase {
+		return fmt.Errorf("file_path is required to build the in-memory index")
+	}
+	if settings.SyncFromDatabase && settings.SearchBy != backend.InMemIndex {
+		return fmt.Errorf("sync_from_database is only supported when searching by the inmemIndex")
+	}
+	if _, err := dataset.ParseFormat(string(settings.Format)); err != nil {
+		return err
+	}
+	if len(settings.Schema) != 0 && settings.SchemaPath != "" {
+		return fmt.Errorf("only one of schema and schema_path can be set")
+	}
+
+	return nil
+}
+
+func (c *Collections) build(collection *Collection) error {
+	start := time.Now()
+	s, err := c.newCollectionAPI(collection.Name, collection.Settings)
+
+	c.mu.Lock()
+	if err != nil {
+		defer c.mu.Unlock()
+		log.Printf("failed to build the collection %s: %+v", collection.Name, err)
+		collection.status = collectionFailed
+		collection.err = err
+		return err
+	}
+	if c.collections[collection.Name] != collection {
+		// deleted, or the server closed, while it was being built, nothing will release it
+		c.mu.Unlock()
+		s.close()
+		return fmt.Errorf("%w: collection %s was deleted while it was built", errCollectionNotFound, collection.Name)
+	}
+	defer c.mu.Unlock()
+	collection.api = s
+	collection.status = collectionReady
+	collection.builtAt, collection.buildTime = time.Now(), time.Since(start)
+	log.Printf("created the collection %s in %s", collection.Name, collection.buildTime.Round(time.Millisecond))
+	return nil
+}
+
+func (c *Collections) newCollectionAPI(name string, settings CollectionSettings) (*SearchAPI, error) {
+	schema, err := settings.loadSchema()
+	if err != nil {
+		return nil, err
+	}
+	return newSearchAPI(c.config, name, settings, schema)
+}
+
+// adds a collection whose SearchAPI is already built
+func (c *Collections) add(name string, settings CollectionSettings, s *SearchAPI) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.collections[name] = &Collection{Name: name, Settings: settings, status: collectionReady, api: s, builtAt: time.Now()}
+}
+
+// resolves the name, an alias or a collection, to a ready collection and marks a
+// search as running on it. release must be called once the search is done.
+func (c *Collections) acquire(name string) (*SearchAPI, func(), error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if target, ok := c.aliases[name]; ok {
+		name = target
+	}
+	collection, ok := c.collections[name]
+	if !ok {
+		return nil, nil, errCollectionNotFound
+	}
+	if collection.status != collectionReady {
+		return nil, nil, fmt.Errorf("%w: collection %s is %s", errCollectionNotReady, name, collection.status)
+	}
+
+	// added under the lock so a delete, which takes the write lock, can't miss it
+	collection.inflight.Add(1)
+	return collection.api, collection.inflight.Done, nil
+}
+
+// removes the collection, it is released once the searches running on it finish
+func (c *Collections) Delete(name string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	collection, ok := c.collections[name]
+	if !ok {
+		return errCollectionNotFound
+	}
+	if aliases := c.aliasesOf(name); len(aliases) != 0 {
+		return fmt.Errorf("collection %s is pointed at by the aliases %v, point them somewhere else first", name, aliases)
+	}
+	c.remove(collection)
+	return nil
+}
+
+// must be called with the lock held
+func (c *Collections) remove(collection *Collection) {
+	delete(c.collections, collection.Name)
+	log.Printf("deleted the collection %s", collection.Name)
+
+	go c.release(collection)
+}
+
+// waits for the searches running on the removed collection and closes its backend
+func (c *Collections) release(collection *Collection) {
+	collection.inflight.Wait()
+	c.mu.Lock()
+	s := collection.api
+	collection.api = nil
+	c.mu.Unlock()
+	if s != nil {
+		s.close()
+	}
+	log.Printf("released the collection %s", collection.Name)
+}
+
+// Close removes every collection and alias and releases the collections, closing
+// the database pools of their backends. the server must not take requests anymore.
+func (c *Collections) Close() {
+	c.mu.Lock()
+	collections := make([]*Collection, 0, len(c.collections))
+	for _, collection := range c.collections {
+		collections = append(collections, collection)
+	}
+	c.collections = make(map[string]*Collection)
+	c.aliases = make(map[string]string)
+	c.mu.Unlock()
+
+	for _, collection := range collections {
+		c.release(collection)
+	}
+}
+
+func (c *Collections) List() []collectionInfo {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	infos := make([]collectionInfo, 0, len(c.collections))
+	for _, collection := range c.collections {
+		infos = append(infos, c.info(collection))
+	}
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].Name < infos[j].Name
+	})
+	return infos
+}
+
+func (c *Collections) Describe(name string) (collectionInfo, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	collection, ok := c.collections[name]
+	if !ok {
+		return collectionInfo{}, false
+	}
+	return c.info(collection), true
+}
+
+func (c *Collections) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	path := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/v1/collections"), "/")
+	if path == "" {
+		switch r.Method {
+		case http.MethodGet:
+			writeJSON(w, http.StatusOK, map[string]interface{}{"collections": c.List()})
+		case http.MethodPost:
+			c.create(w, r)
+		default:
+			httpError(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		}
+		return
+	}
+
+	parts := strings.Split(path, "/")
+	switch {
+	case len(parts) == 1 && r.Method == http.MethodGet:
+		info, ok := c.Describe(parts[0])
+		if !ok {
+			httpError(w, fmt.Sprintf("collection %s not found", parts[0]), http.StatusNotFound)
+			return
+		}
+		writeJSON(w, http.StatusOK, info)
+	case len(parts) == 1 && r.Method == http.MethodDelete:
+		err := c.Delete(parts[0])
+		if errors.Is(err, errCollectionNotFound) {
+			httpError(w, fmt.Sprintf("collection %s not found", parts[0]), http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			httpError(w, err.Error(), http.StatusConflict)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	case len(parts) == 1:
+		httpError(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+	case len(parts) == 2 && parts[1] == "search":
+		setRoute(r, "/api/v1/collections/{name}/search")
+		c.Search(parts[0]).ServeHTTP(w, r)
+	case len(parts) == 4 && parts[1] == "documents" && parts[3] == "similar":
+		setRoute(r, "/api/v1/collections/{name}/documents/{id}/similar")
+		c.Similar(parts[0], parts[2]).ServeHTTP(w, r)
+	case parts[1] == "documents":
+		setRoute(r, documentsRoute("/api/v1/collections/{name}/documents", parts[2:]))
+		c.Documents(parts[0], parts[2:]).ServeHTTP(w, r)
+	default:
+		notFound(w, r)
+	}
+}
+
+// searches the collection or alias, resolved on every request so a swapped alias takes effect right away
+func (c *Collections) Search(name string) http.Handler {
+	return c.withCollection(name, func(s *SearchAPI, w http.ResponseWriter, r *http.Request) {
+		Validator(s.schema, s).ServeHTTP(w, r)
+	})
+}
+
+// documents similar to the one with the id in the collection or alias
+func (c *Collections) Similar(name string, id string) http.Handler {
+	return c.withCollection(name, func(s *SearchAPI, w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			httpError(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		s.similar(w, r, id)
+	})
+}
+
+func (c *Collections) withCollection(name string, next func(*SearchAPI, http.ResponseWriter, *http.Request)) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s, release, err := c.acquire(name)
+		if errors.Is(err, errCollectionNotFound) {
+			httpError(w, fmt.Sprintf("collection %s not found", name), http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			httpError(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+		defer release()
+
+		setBackend(r, s.searchBy)
+		next(s, w, r)
+	})
+}
+
+func (c *Collections) create(w http.ResponseWriter, r *http.Request) {
+	var req collectionRequest
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&req); err != nil {
+		httpError(w, fmt.Sprintf("invalid collection: %s", err.Error()), http.StatusBadRequest)
+		return
+	}
+
+	settings, err := req.CollectionSettings.inDataDir(c.serverConfig().DataDir)
+	if err != nil {
+		httpError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	// a large dataset takes longer to index than a request may last
+	collection, err := c.CreateInBackground(req.Name, settings)
+	if err != nil {
+		httpError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	info, _ := c.Describe(collection.Name)
+	writeJSON(w, http.StatusAccepted, info)
+}
+
+// the files of a collection created through the api must be in the data directory, so a
+// client can't have the server read any other file. the paths are resolved against it
+func (settings CollectionSettings) inDataDir(dir string) (CollectionSettings, error) {
+	paths := []struct {
+		key  string
+		path *string
+	}{
+		{"file_path", &settings.Path},
+		{"schema_path", &settings.SchemaPath},
+		{"sqlite_path", &settings.SQLitePath},
+	}
+	for _, p := range paths {
+		if *p.path == "" {
+			continue
+		}
+		if !filepath.IsLocal(*p.path) {
+			return settings, fmt.Errorf("%s must be a relative path inside the data directory, got: %q", p.key, *p.path)
+		}
+		*p.path = filepath.Join(dir, *p.path)
+	}
+	return settings, nil
+}
+
+func (c *Collections) serverConfig() common.ServerConfig {
+	if c.config == nil {
+		return common.DefaultServerConfig()
+	}
+	return c.config.Server
+}
+
+// must be called with the lock held
+func (c *Collections) info(collection *Collection) collectionInfo {
+	settings := collection.Settings
+	info := collectionInfo{
+		Name:            collection.Name,
+		Status:          collection.status,
+		SearchBy:        settings.SearchBy,
+		DefaultOperator: settings.DefaultOperator,
+		MaxResults:      settings.MaxResults,
+		Aliases:         c.aliasesOf(collection.Name),
+	}
+	if info.SearchBy == "" {
+		// an empty searchBy falls back to the database
+		info.SearchBy = "database"
+	}
+	if info.DefaultOperator == "" {
+		info.DefaultOperator = "and"
+	}
+	if collection.err != nil {
+		info.Error = collection.err.Error()
+	}
+	if collection.api != nil {
+		info.Schema = collection.api.schema.Name
+		if counter, ok := collection.api.backend.(backend.DocumentCounter); ok {
+			count := counter.DocCount()
+			info.Documents = &count
+		}
+	}
+	return info
+}
+
+func (settings CollectionSettings) loadSchema() (*common.Schema, error) {
+	if len(settings.Schema) != 0 {
+		return common.ParseSchema(settings.Schema)
+	}
+	return common.LoadSchema(settings.SchemaPath)
+}
+
+func writeJSON(w http.ResponseWriter, status int, resp interface{}) {
+	jsonBytes, err := json.Marshal(resp)
+	if err != nil {
+		log.Printf("failed to marshal the resp: %+v", err)
+		httpError(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(jsonBytes)
+}
@@ -0,0 +1,153 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"textscout/common"
+	"textscout/internal/dataset"
+	"time"
+)
+
+const sampleFilePath = "../inmemsearch/testdata/sample.json"
+
+// collections whose data directory holds the sample dataset, as sample.json
+func sampleCollections() *Collections {
+	config := common.DefaultConfig()
+	config.Server.DataDir = filepath.Dir(sampleFilePath)
+	return NewCollections(config)
+}
+
+// waits for the collection built in the background to be ready
+func waitReady(t *testing.T, collections *Collections, name string) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		info, _ := collections.Describe(name)
+		if info.Status == collectionReady {
+			return
+		}
+		if info.Status == collectionFailed || time.Now().After(deadline) {
+			t.Fatalf("collection %s didn't become ready: %+v", name, info)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestCollections(t *testing.T) {
+	collections := sampleCollections()
+
+	// built in the background, so a large dataset doesn't outlast the request
+	body := `{"name": "films", "search_by": "inmemIndex", "file_path": "sample.json", "default_operator": "or", "max_results": 2}`
+	rec := httptest.NewRecorder()
+	collections.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/v1/collections", strings.NewReader(body)))
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("expected status: %d, got: %d %s", http.StatusAccepted, rec.Code, rec.Body.String())
+	}
+	waitReady(t, collections, "films")
+
+	// the same name can't be taken twice
+	rec = httptest.NewRecorder()
+	collections.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/v1/collections", strings.NewReader(body)))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("expected status: %d, got: %d", http.StatusBadRequest, rec.Code)
+	}
+
+	// or matches the three kong and godzilla movies, max_results keeps two of them
+	rec = httptest.NewRecorder()
+	collections.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/collections/films/search?title=kong&desc=godzilla", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status: %d, got: %d %s", http.StatusOK, rec.Code, rec.Body.String())
+	}
+	var resp map[string][]map[string]interface{}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if len(resp["movies"]) != 2 {
+		t.Errorf("expected 2 movies, got: %d", len(resp["movies"]))
+	}
+
+	rec = httptest.NewRecorder()
+	collections.ServeHTTP(rec, httptest.NewRequest(http.MethodDelete, "/api/v1/collections/films", nil))
+	if rec.Code != http.StatusNoContent {
+		t.Errorf("expected status: %d, got: %d", http.StatusNoContent, rec.Code)
+	}
+
+	rec = httptest.NewRecorder()
+	collections.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/collections/films/search?title=kong", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("expected status: %d, got: %d", http.StatusNotFound, rec.Code)
+	}
+
+	// the files must be in the data directory
+	for _, body := range []string{
+		`{"name": "secrets", "search_by": "inmemIndex", "file_path": "/etc/passwd"}`,
+		`{"name": "secrets", "search_by": "inmemIndex", "file_path": "../../go.mod"}`,
+		`{"name": "secrets", "search_by": "inmemIndex", "file_path": "sample.json", "schema_path": "nested/../../schema.json"}`,
+		`{"name": "secrets", "search_by": "sqlite", "sqlite_path": "/tmp/textscout.db"}`,
+	} {
+		rec = httptest.NewRecorder()
+		collections.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/v1/collections", strings.NewReader(body)))
+		if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), "inside the data directory") {
+			t.Errorf("expected status: %d for %s, got: %d %s", http.StatusBadRequest, body, rec.Code, rec.Body.String())
+		}
+	}
+	if _, ok := collections.Describe("secrets"); ok {
+		t.Errorf("expected no collection from the files outside the data directory")
+	}
+}
+
+func TestAliasSwap(t *testing.T) {
+	collections := sampleCollections()
+	settings := CollectionSettings{SearchBy: "inmemIndex", Source: dataset.Source{Path: sampleFilePath}}
+	if _, err := collections.Create("films-v1", settings); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := collections.SetAlias("films", "films-v1", false); err != nil {
+		t.Fatal(err)
+	}
+
+	// build the new index in the background and wait for it to be ready
+	body := `{"name": "films-v2", "background": true, "search_by": "inmemIndex", "file_path": "sample.json"}`
+	rec := httptest.NewRecorder()
+	collections.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/v1/collections", strings.NewReader(body)))
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("expected status: %d, got: %d %s", http.StatusAccepted, rec.Code, rec.Body.String())
+	}
+	waitReady(t, collections, "films-v2")
+
+	// a search holding the old collection keeps it alive until it finishes
+	_, release, err := collections.acquire("films")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rec = httptest.NewRecorder()
+	collections.ServeAliases(rec, httptest.NewRequest(http.MethodPut, "/api/v1/aliases/films", strings.NewReader(`{"collection": "films-v2", "release_previous": true}`)))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status: %d, got: %d %s", http.StatusOK, rec.Code, rec.Body.String())
+	}
+	if _, ok := collections.Describe("films-v1"); ok {
+		t.Errorf("expected the previous collection to be deleted")
+	}
+	release()
+
+	rec = httptest.NewRecorder()
+	collections.Search("films").ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/search?title=kong", nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("expected status: %d, got: %d %s", http.StatusOK, rec.Code, rec.Body.String())
+	}
+	info, _ := collections.Describe("films-v2")
+	if len(info.Aliases) != 1 || info.Aliases[0] != "films" {
+		t.Errorf("expected films-v2 to be aliased by films, got: %+v", info.Aliases)
+	}
+
+	// an aliased collection can't be deleted
+	if err := collections.Delete("films-v2"); err == nil {
+		t.Errorf("expected an error deleting an aliased collection")
+	}
+
+}
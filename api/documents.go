@@ -0,0 +1,260 @@
+package api
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"textscout/internal/backend"
+	"time"
+)
+
+// results of a write
+const (
+	documentCreated = "created"
+	documentUpdated = "updated"
+	documentDeleted = "deleted"
+)
+
+type documentResponse struct {
+	ID     string `json:"id"`
+	Result string `json:"result"`
+}
+
+// outcome of one line of a bulk request, either the result or the error
+type bulkItem struct {
+	Line   int    `json:"line"`
+	ID     string `json:"id,omitempty"`
+	Status int    `json:"status"`
+	Result string `json:"result,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+type bulkResponse struct {
+	// time taken in milliseconds
+	Took int64 `json:"took"`
+	// true when any of the items failed
+	Errors bool       `json:"errors"`
+	Items  []bulkItem `json:"items"`
+}
+
+// Documents writes to the collection or alias, to whichever backend it searches
+// Endpoints, {path} being the rest of the path after /documents:
+// POST   localhost:8080/api/v1/documents          indexes the document in the body, 409 if its id is taken
+// POST   localhost:8080/api/v1/documents/_bulk    ndjson body, every line is a document which is created or replaced
+// PUT    localhost:8080/api/v1/documents/{id}     creates or replaces the document
+// DELETE localhost:8080/api/v1/documents/{id}     deletes the document
+func (c *Collections) Documents(name string, path []string) http.Handler {
+	return c.withCollection(name, func(s *SearchAPI, w http.ResponseWriter, r *http.Request) {
+		switch {
+		case len(path) == 0 && r.Method == http.MethodPost:
+			s.createDocument(w, r)
+		case len(path) == 1 && path[0] == "_bulk" && r.Method == http.MethodPost:
+			s.bulkDocuments(w, r)
+		case len(path) == 1 && path[0] != "_bulk" && r.Method == http.MethodPut:
+			s.putDocument(w, r, path[0])
+		case len(path) == 1 && path[0] != "_bulk" && r.Method == http.MethodDelete:
+			s.removeDocument(w, r, path[0])
+		case len(path) <= 1:
+			httpError(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		default:
+			notFound(w, r)
+		}
+	})
+}
+
+// the documents of the collection the server was started with
+// Endpoint: localhost:8080/api/v1/documents[/_bulk or /{id}]
+func (c *Collections) StartupDocuments(name string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path := splitPath(strings.TrimPrefix(r.URL.Path, "/api/v1/documents"))
+		setRoute(r, documentsRoute("/api/v1/documents", path))
+		c.Documents(name, path).ServeHTTP(w, r)
+	})
+}
+
+// the route a request to the documents is counted by, see Instrument
+func documentsRoute(prefix string, path []string) string {
+	switch {
+	case len(path) == 0:
+		return prefix
+	case len(path) == 1 && path[0] == "_bulk":
+		return prefix + "/_bulk"
+	}
+	return prefix + "/{id}"
+}
+
+func (s *SearchAPI) createDocument(w http.ResponseWriter, r *http.Request) {
+	raw, err := decodeDocument(r.Body)
+	if err != nil {
+		httpError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	id, err := s.addDocument(r.Context(), raw)
+	if err != nil {
+		writeBackendError(w, "adding the document", err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, documentResponse{ID: id, Result: documentCreated})
+}
+
+func (s *SearchAPI) putDocument(w http.ResponseWriter, r *http.Request, id string) {
+	raw, err := decodeDocument(r.Body)
+	if err != nil {
+		httpError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// the id can be left out of the body, otherwise it must match the one in the path
+	if _, ok := raw[s.schema.IDField]; !ok {
+		raw[s.schema.IDField] = id
+	}
+	fields, err := s.schema.Normalise(raw)
+	if err != nil {
+		httpError(w, fmt.Sprintf("%s: %s", backend.ErrInvalidDocument, err), http.StatusBadRequest)
+		return
+	}
+	if bodyID := s.schema.DocumentID(fields); bodyID != id {
+		httpError(w, fmt.Sprintf("%s: the %s %s doesn't match the id %s in the path", backend.ErrInvalidDocument, s.schema.IDField, bodyID, id), http.StatusBadRequest)
+		return
+	}
+
+	_, created, err := s.upsertDocument(r.Context(), raw)
+	if err != nil {
+		writeBackendError(w, "writing the document", err)
+		return
+	}
+	if created {
+		writeJSON(w, http.StatusCreated, documentResponse{ID: id, Result: documentCreated})
+		return
+	}
+	writeJSON(w, http.StatusOK, documentResponse{ID: id, Result: documentUpdated})
+}
+
+func (s *SearchAPI) removeDocument(w http.ResponseWriter, r *http.Request, id string) {
+	if err := s.deleteDocument(r.Context(), id); err != nil {
+		writeBackendError(w, "deleting the document", err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// upserts every line of the ndjson body, a failing line doesn't stop the rest
+// and is reported in its item
+func (s *SearchAPI) bulkDocuments(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	resp := bulkResponse{Items: []bulkItem{}}
+
+	scanner := bufio.NewScanner(r.Body)
+	scanner.Buffer(make([]byte, 64*1024), s.server.MaxBulkLineSize)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := bytes.TrimSpace(scanner.Bytes())
+		if len(text) == 0 {
+			continue
+		}
+
+		item := bulkItem{Line: line}
+		raw, err := decodeDocument(bytes.NewReader(text))
+		if err == nil {
+			var created bool
+			item.ID, created, err = s.upsertDocument(r.Context(), raw)
+			item.Status, item.Result = http.StatusOK, documentUpdated
+			if created {
+				item.Status, item.Result = http.StatusCreated, documentCreated
+			}
+		}
+		if err != nil {
+			item.Status, item.Error = backendError(w.Header().Get(requestIDHeader), fmt.Sprintf("writing the document of line %d", line), err)
+			item.Result = ""
+			resp.Errors = true
+		}
+		resp.Items = append(resp.Items, item)
+	}
+	if err := scanner.Err(); err != nil {
+		// the lines read so far are written already, so report them along with the error
+		resp.Errors = true
+		resp.Items = append(resp.Items, bulkItem{Line: line + 1, Status: http.StatusBadRequest, Error: fmt.Sprintf("failed to read the line: %s", err)})
+	}
+
+	resp.Took = time.Since(start).Milliseconds()
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// decodes a json object, numbers are kept as json.Number like when loading the dataset
+func decodeDocument(body io.Reader) (map[string]interface{}, error) {
+	var raw map[string]interface{}
+	decoder := json.NewDecoder(body)
+	decoder.UseNumber()
+	if err := decoder.Decode(&raw); err != nil {
+		return nil, fmt.Errorf("%w: %s", backend.ErrInvalidDocument, err)
+	}
+	if raw == nil {
+		return nil, fmt.Errorf("%w: the document must be a json object", backend.ErrInvalidDocument)
+	}
+	return raw, nil
+}
+
+// the writes go to the backend of the collection, the in-memory index or the database, each
+// taking at most the write timeout of the server config
+
+func (s *SearchAPI) documentWriter() (backend.DocumentWriter, error) {
+	writer, ok := s.backend.(backend.DocumentWriter)
+	if !ok {
+		return nil, fmt.Errorf("%w: documents can't be written when searching by %s", backend.ErrUnsupported, s.searchBy)
+	}
+	return writer, nil
+}
+
+func (s *SearchAPI) addDocument(ctx context.Context, raw map[string]interface{}) (string, error) {
+	writer, err := s.documentWriter()
+	if err != nil {
+		return "", err
+	}
+	ctx, cancel := context.WithTimeout(ctx, s.server.WriteTimeout)
+	defer cancel()
+	id, err := writer.AddDocument(ctx, raw)
+	observeWrite(s.searchBy, documentCreated, err)
+	return id, err
+}
+
+func (s *SearchAPI) upsertDocument(ctx context.Context, raw map[string]interface{}) (string, bool, error) {
+	writer, err := s.documentWriter()
+	if err != nil {
+		return "", false, err
+	}
+	ctx, cancel := context.WithTimeout(ctx, s.server.WriteTimeout)
+	defer cancel()
+	id, created, err := writer.UpsertDocument(ctx, raw)
+	result := documentUpdated
+	if created {
+		result = documentCreated
+	}
+	observeWrite(s.searchBy, result, err)
+	return id, created, err
+}
+
+func (s *SearchAPI) deleteDocument(ctx context.Context, id string) error {
+	writer, err := s.documentWriter()
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(ctx, s.server.WriteTimeout)
+	defer cancel()
+	err = writer.DeleteDocument(ctx, id)
+	observeWrite(s.searchBy, documentDeleted, err)
+	return err
+}
+
+func splitPath(path string) []string {
+	path = strings.Trim(path, "/")
+	if path == "" {
+		return []string{}
+	}
+	return strings.Split(path, "/")
+}
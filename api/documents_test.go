@@ -0,0 +1,119 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"textscout/internal/dataset"
+)
+
+func TestDocuments(t *testing.T) {
+	collections := NewCollections(nil)
+	if _, err := collections.Create("films", CollectionSettings{SearchBy: "inmemIndex", Source: dataset.Source{Path: sampleFilePath}}); err != nil {
+		t.Fatal(err)
+	}
+
+	rec := httptest.NewRecorder()
+	collections.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/v1/collections/films/documents", strings.NewReader(`{"id": 1, "title": "Mothra"}`)))
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("expected status: %d, got: %d %s", http.StatusCreated, rec.Code, rec.Body.String())
+	}
+	rec = httptest.NewRecorder()
+	collections.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/v1/collections/films/documents", strings.NewReader(`{"id": 1, "title": "Mothra"}`)))
+	if rec.Code != http.StatusConflict {
+		t.Errorf("expected status: %d, got: %d", http.StatusConflict, rec.Code)
+	}
+
+	// the id in the body must match the path
+	rec = httptest.NewRecorder()
+	collections.ServeHTTP(rec, httptest.NewRequest(http.MethodPut, "/api/v1/collections/films/documents/2", strings.NewReader(`{"id": 1, "title": "Rodan"}`)))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("expected status: %d, got: %d", http.StatusBadRequest, rec.Code)
+	}
+	rec = httptest.NewRecorder()
+	collections.ServeHTTP(rec, httptest.NewRequest(http.MethodPut, "/api/v1/collections/films/documents/1", strings.NewReader(`{"title": "Rodan"}`)))
+	if rec.Code != http.StatusOK {
+		t.Errorf("expected status: %d, got: %d %s", http.StatusOK, rec.Code, rec.Body.String())
+	}
+
+	// every line is reported, the bad ones don't stop the rest
+	bulk := strings.Join([]string{
+		`{"id": 2, "title": "King Ghidorah"}`,
+		`{"id": "two", "title": "Gigan"}`,
+		``,
+		`not json`,
+		`{"id": 1, "title": "Rodan returns"}`,
+	}, "\n")
+	rec = httptest.NewRecorder()
+	collections.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/v1/collections/films/documents/_bulk", strings.NewReader(bulk)))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status: %d, got: %d %s", http.StatusOK, rec.Code, rec.Body.String())
+	}
+	var resp bulkResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	expectedItems := []bulkItem{
+		{Line: 1, ID: "2", Status: http.StatusCreated},
+		{Line: 2, Status: http.StatusBadRequest},
+		{Line: 4, Status: http.StatusBadRequest},
+		{Line: 5, ID: "1", Status: http.StatusOK},
+	}
+	if !resp.Errors || len(resp.Items) != len(expectedItems) {
+		t.Fatalf("expected items: %+v, got: %+v", expectedItems, resp)
+	}
+	for i, expected := range expectedItems {
+		item := resp.Items[i]
+		if item.Line != expected.Line || item.ID != expected.ID || item.Status != expected.Status {
+			t.Errorf("expected item: %+v, got: %+v", expected, item)
+		}
+	}
+
+	rec = httptest.NewRecorder()
+	collections.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/collections/films/search?title=rodan", nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("expected status: %d, got: %d", http.StatusOK, rec.Code)
+	}
+
+	rec = httptest.NewRecorder()
+	collections.ServeHTTP(rec, httptest.NewRequest(http.MethodDelete, "/api/v1/collections/films/documents/1", nil))
+	if rec.Code != http.StatusNoContent {
+		t.Errorf("expected status: %d, got: %d", http.StatusNoContent, rec.Code)
+	}
+	rec = httptest.NewRecorder()
+	collections.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/collections/films/search?title=rodan", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("expected status: %d, got: %d", http.StatusNotFound, rec.Code)
+	}
+
+}
+
+func TestOmitEmptyFields(t *testing.T) {
+	collections := NewCollections(nil)
+	if _, err := collections.Create("films", CollectionSettings{SearchBy: "inmemIndex", Source: dataset.Source{Path: sampleFilePath}}); err != nil {
+		t.Fatal(err)
+	}
+	doc := `{"id": 1, "title": "Mechagodzilla", "original_title": "", "overview": "", "video": false, "vote_count": 0, "genre_ids": []}`
+	rec := httptest.NewRecorder()
+	collections.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/v1/collections/films/documents", strings.NewReader(doc)))
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("expected status: %d, got: %d %s", http.StatusCreated, rec.Code, rec.Body.String())
+	}
+
+	// the zero values of the omit_empty fields are left out, the titles and the id are always there
+	rec = httptest.NewRecorder()
+	collections.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/collections/films/search?title=mechagodzilla", nil))
+	var resp map[string][]map[string]interface{}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if len(resp["movies"]) != 1 {
+		t.Fatalf("expected the movie, got: %s", rec.Body.String())
+	}
+	movie := resp["movies"][0]
+	if len(movie) != 3 || movie["id"] != float64(1) || movie["title"] != "Mechagodzilla" || movie["original_title"] != "" {
+		t.Errorf("expected only the id and the titles, got: %v", movie)
+	}
+}
@@ -0,0 +1,137 @@
+package api
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	textsearch "textscout/inmemsearch"
+	"textscout/internal/backend"
+)
+
+// header carrying the id of a request, the one sent by the client or a proxy is kept
+const requestIDHeader = "X-Request-ID"
+
+// longest request id taken from the client, a longer one is replaced
+const maxRequestIDLength = 128
+
+// the body of every error response
+type errorResponse struct {
+	// the kind of error, derived from the status, i.e bad_request or timeout
+	Code    string `json:"code"`
+	Message string `json:"message"`
+	// the id logged with the request, to find it in the logs
+	RequestID string `json:"request_id,omitempty"`
+}
+
+// the codes of the statuses whose text doesn't make a good one
+var errorCodes = map[int]string{
+	http.StatusInternalServerError: "internal",
+	http.StatusServiceUnavailable:  "unavailable",
+	http.StatusGatewayTimeout:      "timeout",
+}
+
+// RequestID gives every request an id, set on the response header so the handlers and
+// the error responses can read it back
+func RequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(requestIDHeader)
+		if id == "" || len(id) > maxRequestIDLength || strings.ContainsFunc(id, invalidIDRune) {
+			id = newRequestID()
+		}
+		w.Header().Set(requestIDHeader, id)
+		next.ServeHTTP(w, r)
+	})
+}
+
+func invalidIDRune(r rune) bool {
+	return r <= ' ' || r > '~'
+}
+
+func newRequestID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// httpError is http.Error with a json errorResponse body
+func httpError(w http.ResponseWriter, message string, status int) {
+	code, ok := errorCodes[status]
+	if !ok {
+		code = strings.ReplaceAll(strings.ToLower(http.StatusText(status)), " ", "_")
+	}
+	jsonBytes, _ := json.Marshal(errorResponse{
+		Code:      code,
+		Message:   message,
+		RequestID: w.Header().Get(requestIDHeader),
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	w.Write(jsonBytes)
+}
+
+// http.NotFound with a json errorResponse body
+func notFound(w http.ResponseWriter, r *http.Request) {
+	httpError(w, "no route for "+r.URL.Path, http.StatusNotFound)
+}
+
+func isTimeout(err error) bool {
+	return errors.Is(err, backend.ErrTimeout) || errors.Is(err, context.DeadlineExceeded)
+}
+
+// the client went away and the request was cancelled, there's no one to send the error to
+func clientGone(w http.ResponseWriter, r *http.Request, err error) bool {
+	if !errors.Is(r.Context().Err(), context.Canceled) {
+		return false
+	}
+	log.Printf("request %s: cancelled, the client went away: %v", w.Header().Get(requestIDHeader), err)
+	return true
+}
+
+// the status of an error of a backend: the request is wrong, the backend is down or too slow,
+// or anything else which is a bug or an unexpected failure
+func errorStatus(err error) int {
+	switch {
+	case errors.Is(err, backend.ErrInvalidRequest), errors.Is(err, backend.ErrInvalidDocument), errors.Is(err, backend.ErrUnsupported):
+		return http.StatusBadRequest
+	case errors.Is(err, textsearch.ErrDocumentExists):
+		return http.StatusConflict
+	case errors.Is(err, textsearch.ErrDocumentNotFound):
+		return http.StatusNotFound
+	case isTimeout(err):
+		return http.StatusGatewayTimeout
+	case errors.Is(err, backend.ErrUnavailable):
+		return http.StatusServiceUnavailable
+	}
+	return http.StatusInternalServerError
+}
+
+// writes the error of a backend, see backendError
+func writeBackendError(w http.ResponseWriter, what string, err error) {
+	status, message := backendError(w.Header().Get(requestIDHeader), what, err)
+	httpError(w, message, status)
+}
+
+// the status and message of the error of a backend, what failed is i.e "searching by database".
+// the error of a database down, too slow or failing unexpectedly is logged rather than sent, it may tell too much.
+func backendError(requestID string, what string, err error) (int, string) {
+	status := errorStatus(err)
+	if status < http.StatusInternalServerError {
+		return status, err.Error()
+	}
+
+	log.Printf("request %s: error while %s: %+v", requestID, what, err)
+	switch status {
+	case http.StatusGatewayTimeout:
+		return status, what + " timed out"
+	case http.StatusServiceUnavailable:
+		return status, what + " failed, the backend is unavailable"
+	}
+	return status, "internal server error"
+}
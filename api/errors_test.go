@@ -0,0 +1,230 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"textscout/common"
+	"textscout/internal/backend"
+	"textscout/internal/database"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// the movies table failing with err, or hanging until the search is cancelled when block is set
+type failingQuerier struct {
+	database.Querier
+	err   error
+	block bool
+}
+
+func (q *failingQuerier) SearchMoviesFTS(ctx context.Context, arg database.SearchMoviesFTSParams) ([]database.SearchMoviesFTSRow, error) {
+	if q.block {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+	if q.err != nil {
+		return nil, q.err
+	}
+	return []database.SearchMoviesFTSRow{{MovieID: 293167, MovieTitle: "Kong: Skull Island", Rank: 0.5}}, nil
+}
+
+func (q *failingQuerier) DeleteMovie(ctx context.Context, movieID int32) (int64, error) {
+	return 0, q.err
+}
+
+func TestErrorResponses(t *testing.T) {
+	schema := common.DefaultMovieSchema()
+	querier := &failingQuerier{}
+	s := &SearchAPI{
+		backend:  &backend.FTS{Postgres: backend.NewPostgres(querier, nil, schema)},
+		searchBy: backend.PostgresFTS,
+		schema:   schema,
+		server:   common.DefaultServerConfig(),
+	}
+	collections := NewCollections(nil)
+	collections.add(schema.Name, CollectionSettings{SearchBy: backend.PostgresFTS}, s)
+	router := NewRouter(collections, NewHealth(collections), schema.Name)
+
+	tests := []struct {
+		name    string
+		method  string
+		target  string
+		err     error
+		block   bool
+		status  int
+		code    string
+		message string
+	}{
+		{name: "found", target: "/api/v1/search?title=kong", status: http.StatusOK},
+		{name: "no query", target: "/api/v1/search", status: http.StatusBadRequest, code: "bad_request", message: "At least one query parameter"},
+		{name: "unsupported", target: "/api/v1/search?title=kong&explain=true", status: http.StatusBadRequest, code: "bad_request", message: "not supported"},
+		{name: "statement timeout", target: "/api/v1/search?title=kong", err: &pgconn.PgError{Code: "57014", Message: "canceling statement due to statement timeout"}, status: http.StatusGatewayTimeout, code: "timeout", message: "searching by postgresFTS timed out"},
+		{name: "search timeout", target: "/api/v1/search?title=kong", block: true, status: http.StatusGatewayTimeout, code: "timeout", message: "timed out"},
+		{name: "database down", target: "/api/v1/search?title=kong", err: &pgconn.PgError{Code: "57P03", Message: "the database system is starting up"}, status: http.StatusServiceUnavailable, code: "unavailable", message: "the backend is unavailable"},
+		{name: "unexpected", target: "/api/v1/search?title=kong", err: errors.New("relation movies does not exist"), status: http.StatusInternalServerError, code: "internal", message: "internal server error"},
+		{name: "delete timeout", method: http.MethodDelete, target: "/api/v1/documents/1", err: context.DeadlineExceeded, status: http.StatusGatewayTimeout, code: "timeout", message: "deleting the document timed out"},
+		{name: "delete not found", method: http.MethodDelete, target: "/api/v1/documents/abc", status: http.StatusNotFound, code: "not_found", message: "document not found"},
+		{name: "no route", target: "/api/v2/search", status: http.StatusNotFound, code: "not_found", message: "no route"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			querier.err, querier.block = tt.err, tt.block
+			s.server.SearchTimeout = 5 * time.Second
+			if tt.block {
+				s.server.SearchTimeout = 10 * time.Millisecond
+			}
+			method := tt.method
+			if method == "" {
+				method = http.MethodGet
+			}
+
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, httptest.NewRequest(method, tt.target, nil))
+			if rec.Code != tt.status {
+				t.Fatalf("expected status: %d, got: %d %s", tt.status, rec.Code, rec.Body.String())
+			}
+			requestID := rec.Header().Get(requestIDHeader)
+			if requestID == "" {
+				t.Errorf("expected the response to carry the request id")
+			}
+			if tt.status == http.StatusOK {
+				return
+			}
+
+			var resp errorResponse
+			if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("expected a json error body, got: %s", rec.Body.String())
+			}
+			if resp.Code != tt.code || !strings.Contains(resp.Message, tt.message) || resp.RequestID != requestID {
+				t.Errorf("expected the code %s, a message with %q and the request id %s, got: %+v", tt.code, tt.message, requestID, resp)
+			}
+			// what the database said isn't sent back
+			if tt.err != nil && strings.Contains(resp.Message, tt.err.Error()) {
+				t.Errorf("expected the error of the database to be logged only, got: %s", resp.Message)
+			}
+		})
+	}
+}
+
+func TestRequestID(t *testing.T) {
+	handler := RequestID(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		httpError(w, "slow down", http.StatusTooManyRequests)
+	}))
+
+	// the id of the client or a proxy is kept
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set(requestIDHeader, "lb-4f2a")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	var resp errorResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.RequestID != "lb-4f2a" || resp.Code != "too_many_requests" {
+		t.Errorf("expected the id lb-4f2a, got: %+v", resp)
+	}
+
+	// one which could forge log lines is replaced
+	req.Header.Set(requestIDHeader, "a\nb")
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if id := rec.Header().Get(requestIDHeader); id == "a\nb" || len(id) != 16 {
+		t.Errorf("expected a generated id, got: %q", id)
+	}
+}
+
+func TestSearchTimeoutParam(t *testing.T) {
+	schema := common.DefaultMovieSchema()
+	querier := &failingQuerier{block: true}
+	s := &SearchAPI{
+		backend:  &backend.FTS{Postgres: backend.NewPostgres(querier, nil, schema)},
+		searchBy: backend.PostgresFTS,
+		schema:   schema,
+		server:   common.DefaultServerConfig(),
+	}
+
+	// the timeout of the client returns what was found in time, nothing from the database
+	rec := httptest.NewRecorder()
+	s.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/search?title=kong&timeout=5ms", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status: %d, got: %d %s", http.StatusOK, rec.Code, rec.Body.String())
+	}
+	var resp map[string]interface{}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp["timed_out"] != true || resp["movies"] == nil {
+		t.Errorf("expected a timed out result, got: %s", rec.Body.String())
+	}
+
+	rec = httptest.NewRecorder()
+	s.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/search?title=kong&timeout=soon", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("expected status: %d, got: %d", http.StatusBadRequest, rec.Code)
+	}
+
+	// a timeout longer than the one of the server is capped by it, which is an error
+	s.server.SearchTimeout = 20 * time.Millisecond
+	rec = httptest.NewRecorder()
+	s.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/search?title=kong&timeout=1s", nil))
+	if rec.Code != http.StatusGatewayTimeout {
+		t.Errorf("expected status: %d, got: %d %s", http.StatusGatewayTimeout, rec.Code, rec.Body.String())
+	}
+
+	// the search stops with the request of a client which went away, and nothing is written
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	rec = httptest.NewRecorder()
+	s.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/search?title=kong", nil).WithContext(ctx))
+	if rec.Body.Len() != 0 {
+		t.Errorf("expected no response for a cancelled request, got: %d %s", rec.Code, rec.Body.String())
+	}
+}
+
+// finds one similar movie before the deadline of the search passes
+type slowFinder struct {
+	backend.Backend
+}
+
+func (f *slowFinder) Similar(ctx context.Context, id string, limit int) (backend.Result, error) {
+	<-ctx.Done()
+	hits := []backend.Hit{{ID: "293167", Fields: map[string]interface{}{"id": int64(293167), "title": "Kong: Skull Island"}}}
+	return backend.Result{Hits: hits, TimedOut: true}, fmt.Errorf("%w: %w", backend.ErrTimeout, ctx.Err())
+}
+
+func TestSimilarTimeoutParam(t *testing.T) {
+	schema := common.DefaultMovieSchema()
+	server := common.DefaultServerConfig()
+	server.SearchTimeout = 20 * time.Millisecond
+	s := &SearchAPI{backend: &slowFinder{}, searchBy: backend.InMemIndex, schema: schema, server: server}
+
+	// the timeout of the client returns the movies found in time
+	rec := httptest.NewRecorder()
+	s.similar(rec, httptest.NewRequest(http.MethodGet, "/api/v1/movies/823464/similar?timeout=5ms", nil), "823464")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status: %d, got: %d %s", http.StatusOK, rec.Code, rec.Body.String())
+	}
+	var resp map[string]interface{}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if movies, _ := resp["movies"].([]interface{}); resp["timed_out"] != true || len(movies) != 1 {
+		t.Errorf("expected the movie found in time flagged timed_out, got: %s", rec.Body.String())
+	}
+
+	// the one of the server is an error, even with a longer timeout of the client
+	for _, target := range []string{"/api/v1/movies/823464/similar", "/api/v1/movies/823464/similar?timeout=1s"} {
+		rec = httptest.NewRecorder()
+		s.similar(rec, httptest.NewRequest(http.MethodGet, target, nil), "823464")
+		if rec.Code != http.StatusGatewayTimeout {
+			t.Errorf("expected status: %d for %s, got: %d %s", http.StatusGatewayTimeout, target, rec.Code, rec.Body.String())
+		}
+	}
+}
@@ -0,0 +1,238 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"runtime"
+	"sort"
+	"sync/atomic"
+	"textscout/internal/backend"
+	"time"
+)
+
+// how long the databases of the collections have to answer the ping of a readiness check
+const pingTimeout = 2 * time.Second
+
+// Health tells whether the server is up and ready to take searches, and reports the state of its collections
+// Endpoints:
+// GET localhost:8080/healthz          200 as long as the process serves requests
+// GET localhost:8080/readyz           200 once the collections the server was started with are built and the
+// databases of the ready collections reachable, 503 otherwise and once the server is shutting down
+// GET localhost:8080/api/v1/status    the backend, size and build time of every collection and the memory of the process
+type Health struct {
+	collections *Collections
+	started     time.Time
+	// set once the collections the server was started with are built
+	loaded atomic.Bool
+	// set once the server is shutting down, so no more requests are sent its way
+	stopping atomic.Bool
+}
+
+func NewHealth(collections *Collections) *Health {
+	return &Health{collections: collections, started: time.Now()}
+}
+
+type readinessResponse struct {
+	Ready bool `json:"ready"`
+	// what is checked, the server and every collection, to ok or what is wrong with it
+	Checks map[string]string `json:"checks"`
+}
+
+type statusResponse struct {
+	StartedAt   time.Time          `json:"started_at"`
+	Uptime      string             `json:"uptime"`
+	Ready       bool               `json:"ready"`
+	Memory      memoryStatus       `json:"memory"`
+	Goroutines  int                `json:"goroutines"`
+	Collections []collectionStatus `json:"collections"`
+}
+
+type memoryStatus struct {
+	// bytes of the live objects on the heap, the indexes being most of them
+	HeapAllocBytes uint64 `json:"heap_alloc_bytes"`
+	HeapInuseBytes uint64 `json:"heap_inuse_bytes"`
+	// bytes obtained from the os
+	SysBytes uint64 `json:"sys_bytes"`
+	NumGC    uint32 `json:"num_gc"`
+}
+
+type collectionStatus struct {
+	Name     string `json:"name"`
+	Status   string `json:"status"`
+	Error    string `json:"error,omitempty"`
+	SearchBy string `json:"search_by"`
+	Schema   string `json:"schema,omitempty"`
+	// size of the index, or of the table of the database, when the backend can tell
+	Documents *int `json:"documents,omitempty"`
+	Terms     *int `json:"terms,omitempty"`
+	// approximate bytes of the posting lists of the in-memory index
+	PostingsBytes *int `json:"postings_bytes,omitempty"`
+	// the size couldn't be read, i.e the database is down
+	StatsError  string     `json:"stats_error,omitempty"`
+	BuiltAt     *time.Time `json:"built_at,omitempty"`
+	BuildTimeMs *int64     `json:"build_time_ms,omitempty"`
+}
+
+// a collection as it was when the health was checked
+type collectionState struct {
+	name      string
+	status    string
+	err       error
+	searchBy  string
+	api       *SearchAPI
+	builtAt   time.Time
+	buildTime time.Duration
+}
+
+// the state of every collection sorted by name, the ready ones are marked as in use so
+// they aren't released while they are checked. release must be called once done.
+func (c *Collections) snapshot() ([]collectionState, func()) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	states := make([]collectionState, 0, len(c.collections))
+	inUse := make([]*Collection, 0, len(c.collections))
+	for _, collection := range c.collections {
+		state := collectionState{
+			name:      collection.Name,
+			status:    collection.status,
+			err:       collection.err,
+			searchBy:  collection.Settings.SearchBy,
+			builtAt:   collection.builtAt,
+			buildTime: collection.buildTime,
+		}
+		if state.searchBy == "" {
+			state.searchBy = backend.Database
+		}
+		if collection.status == collectionReady {
+			collection.inflight.Add(1)
+			inUse = append(inUse, collection)
+			state.api = collection.api
+		}
+		states = append(states, state)
+	}
+	sort.Slice(states, func(i, j int) bool {
+		return states[i].name < states[j].name
+	})
+	return states, func() {
+		for _, collection := range inUse {
+			collection.inflight.Done()
+		}
+	}
+}
+
+func (h *Health) Live(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		httpError(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+func (h *Health) Ready(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		httpError(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	resp := h.readiness(r.Context())
+	status := http.StatusOK
+	if !resp.Ready {
+		status = http.StatusServiceUnavailable
+	}
+	writeJSON(w, status, resp)
+}
+
+// a collection created later which is still building, or failed, doesn't make the server unready,
+// the searches of the others are served fine
+func (h *Health) readiness(ctx context.Context) readinessResponse {
+	resp := readinessResponse{Ready: true, Checks: map[string]string{"server": "ok"}}
+	switch {
+	case h.stopping.Load():
+		resp.Ready, resp.Checks["server"] = false, "shutting down"
+	case !h.loaded.Load():
+		resp.Ready, resp.Checks["server"] = false, "building the collections"
+	}
+
+	states, release := h.collections.snapshot()
+	defer release()
+	ctx, cancel := context.WithTimeout(ctx, pingTimeout)
+	defer cancel()
+	for _, state := range states {
+		key := "collection " + state.name
+		if state.api == nil {
+			resp.Checks[key] = state.status
+			continue
+		}
+		resp.Checks[key] = "ok"
+		if pinger, ok := state.api.backend.(backend.Pinger); ok {
+			if err := pinger.Ping(ctx); err != nil {
+				resp.Ready, resp.Checks[key] = false, "database unreachable: "+err.Error()
+			}
+		}
+	}
+	return resp
+}
+
+func (h *Health) Status(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		httpError(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+	resp := statusResponse{
+		StartedAt: h.started,
+		Uptime:    time.Since(h.started).Round(time.Second).String(),
+		Ready:     h.loaded.Load() && !h.stopping.Load(),
+		Memory: memoryStatus{
+			HeapAllocBytes: mem.HeapAlloc,
+			HeapInuseBytes: mem.HeapInuse,
+			SysBytes:       mem.Sys,
+			NumGC:          mem.NumGC,
+		},
+		Goroutines:  runtime.NumGoroutine(),
+		Collections: make([]collectionStatus, 0),
+	}
+
+	states, release := h.collections.snapshot()
+	defer release()
+	for _, state := range states {
+		resp.Collections = append(resp.Collections, h.collectionStatus(r.Context(), state))
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func (h *Health) collectionStatus(ctx context.Context, state collectionState) collectionStatus {
+	status := collectionStatus{Name: state.name, Status: state.status, SearchBy: state.searchBy}
+	if state.err != nil {
+		status.Error = state.err.Error()
+	}
+	if state.api == nil {
+		return status
+	}
+
+	status.Schema = state.api.schema.Name
+	if !state.builtAt.IsZero() {
+		builtAt := state.builtAt
+		status.BuiltAt = &builtAt
+	}
+	if state.buildTime > 0 {
+		ms := state.buildTime.Milliseconds()
+		status.BuildTimeMs = &ms
+	}
+	if reporter, ok := state.api.backend.(backend.StatsReporter); ok {
+		ctx, cancel := context.WithTimeout(ctx, pingTimeout)
+		defer cancel()
+		stats, err := reporter.Stats(ctx)
+		if err != nil {
+			status.StatsError = err.Error()
+			return status
+		}
+		status.Documents = &stats.Documents
+		if stats.Terms > 0 {
+			status.Terms, status.PostingsBytes = &stats.Terms, &stats.PostingsBytes
+		}
+	}
+	return status
+}
@@ -0,0 +1,276 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	textsearch "textscout/inmemsearch"
+	"textscout/internal/backend"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Metrics, in the prometheus text format:
+// GET localhost:8080/metrics
+//
+// the requests, searches, writes and loads of the documents are counted for the whole process, the size
+// of the indexes and the database pools are read from the collections on every scrape
+var (
+	registry = prometheus.NewRegistry()
+
+	requestsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "textscout_http_requests_total",
+		Help: "Requests served, by route, status and the backend of the collection.",
+	}, []string{"route", "status", "backend"})
+	requestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name: "textscout_http_request_duration_seconds",
+		Help: "Time taken to serve the requests, by route, status and the backend of the collection.",
+		// the in-memory index answers in a few ms, the databases in tens to hundreds
+		Buckets: []float64{.001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10},
+	}, []string{"route", "status", "backend"})
+
+	searchesTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "textscout_searches_total",
+		Help: "Searches answered, including the ones which timed out with partial results.",
+	}, []string{"backend"})
+	zeroHitSearchesTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "textscout_zero_hit_searches_total",
+		Help: "Searches which found no documents, the ones which timed out aren't counted.",
+	}, []string{"backend"})
+	searchResults = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "textscout_search_results",
+		Help:    "Documents returned by a search.",
+		Buckets: []float64{0, 1, 5, 10, 25, 50, 100, 250, 500, 1000},
+	}, []string{"backend"})
+
+	documentsWrittenTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "textscout_documents_written_total",
+		Help: "Documents written through the api, one per line of a bulk request, by result: created, updated, deleted or failed.",
+	}, []string{"backend", "result"})
+	documentsIngestedTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "textscout_documents_ingested_total",
+		Help: "Documents loaded into the in-memory index of the collection as it is built, batch by batch, including the reloads of an index synced with the database.",
+	}, []string{"collection"})
+)
+
+func init() {
+	registry.MustRegister(
+		requestsTotal, requestDuration,
+		searchesTotal, zeroHitSearchesTotal, searchResults,
+		documentsWrittenTotal, documentsIngestedTotal,
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+}
+
+// the result of a write which failed, see documentsWrittenTotal
+const documentFailed = "failed"
+
+// status of a request whose client went away before anything was written, as nginx logs it
+const statusClientClosed = 499
+
+// what a request is counted by, the handlers down the route fill in what they learn
+type observedRequest struct {
+	// the pattern of the path, i.e /api/v1/collections/{name}/search, rather than the path itself
+	route   string
+	backend string
+}
+
+type observedRequestKey struct{}
+
+func observed(r *http.Request) *observedRequest {
+	o, _ := r.Context().Value(observedRequestKey{}).(*observedRequest)
+	return o
+}
+
+// narrows down the route of a request, for the handlers serving several patterns
+func setRoute(r *http.Request, route string) {
+	if o := observed(r); o != nil {
+		o.route = route
+	}
+}
+
+func setBackend(r *http.Request, searchBy string) {
+	if o := observed(r); o != nil {
+		o.backend = searchBy
+	}
+}
+
+// keeps the status the handler wrote
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (w *statusRecorder) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *statusRecorder) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// lets http.ResponseController reach the deadlines and the connection of the wrapped writer
+func (w *statusRecorder) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// streams what was written so far when the wrapped writer can
+func (w *statusRecorder) Flush() {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Instrument counts the requests of the route and how long they take
+func Instrument(route string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		o := &observedRequest{route: route}
+		rec := &statusRecorder{ResponseWriter: w}
+		next.ServeHTTP(rec, r.WithContext(context.WithValue(r.Context(), observedRequestKey{}, o)))
+
+		status := rec.status
+		if status == 0 {
+			status = http.StatusOK
+			if errors.Is(r.Context().Err(), context.Canceled) {
+				status = statusClientClosed
+			}
+		}
+		labels := prometheus.Labels{"route": o.route, "status": strconv.Itoa(status), "backend": o.backend}
+		requestsTotal.With(labels).Inc()
+		requestDuration.With(labels).Observe(time.Since(start).Seconds())
+	})
+}
+
+func observeSearch(searchBy string, result backend.Result) {
+	searchesTotal.WithLabelValues(searchBy).Inc()
+	searchResults.WithLabelValues(searchBy).Observe(float64(len(result.Hits)))
+	if len(result.Hits) == 0 && !result.TimedOut {
+		zeroHitSearchesTotal.WithLabelValues(searchBy).Inc()
+	}
+}
+
+func observeWrite(searchBy string, result string, err error) {
+	if err != nil {
+		result = documentFailed
+	}
+	documentsWrittenTotal.WithLabelValues(searchBy, result).Inc()
+}
+
+// counts the documents of every batch the index of the collection is built from
+func observeIngest(collection string) textsearch.LoadProgress {
+	return func(docs int) {
+		documentsIngestedTotal.WithLabelValues(collection).Add(float64(docs))
+	}
+}
+
+// MetricsHandler serves the metrics of the process along with the ones of the collections
+func MetricsHandler(collections *Collections) http.Handler {
+	collectionsRegistry := prometheus.NewRegistry()
+	collectionsRegistry.MustRegister(&collectionsCollector{collections: collections})
+	return promhttp.HandlerFor(prometheus.Gatherers{registry, collectionsRegistry}, promhttp.HandlerOpts{})
+}
+
+var (
+	collectionLabels = []string{"collection", "backend"}
+
+	indexDocumentsDesc = prometheus.NewDesc("textscout_index_documents",
+		"Documents of the collection, the rows of the table when searching the database.", collectionLabels, nil)
+	indexTermsDesc = prometheus.NewDesc("textscout_index_terms",
+		"Distinct terms of the in-memory index of the collection.", collectionLabels, nil)
+	indexPostingsBytesDesc = prometheus.NewDesc("textscout_index_postings_bytes",
+		"Approximate bytes held by the posting lists of the in-memory index of the collection.", collectionLabels, nil)
+	buildDurationDesc = prometheus.NewDesc("textscout_collection_build_seconds",
+		"Time taken to build the collection, the documents over it is the throughput of the indexing.", collectionLabels, nil)
+
+	poolAcquiredDesc = prometheus.NewDesc("textscout_pgx_pool_acquired_connections",
+		"Connections of the pool in use.", collectionLabels, nil)
+	poolIdleDesc = prometheus.NewDesc("textscout_pgx_pool_idle_connections",
+		"Connections of the pool waiting to be used.", collectionLabels, nil)
+	poolConstructingDesc = prometheus.NewDesc("textscout_pgx_pool_constructing_connections",
+		"Connections of the pool being opened.", collectionLabels, nil)
+	poolMaxDesc = prometheus.NewDesc("textscout_pgx_pool_max_connections",
+		"Most connections the pool opens.", collectionLabels, nil)
+	poolAcquiresDesc = prometheus.NewDesc("textscout_pgx_pool_acquires_total",
+		"Connections acquired from the pool.", collectionLabels, nil)
+	poolAcquireDurationDesc = prometheus.NewDesc("textscout_pgx_pool_acquire_duration_seconds_total",
+		"Time spent acquiring connections from the pool.", collectionLabels, nil)
+	poolEmptyAcquiresDesc = prometheus.NewDesc("textscout_pgx_pool_empty_acquires_total",
+		"Acquires which waited for a connection because the pool had none idle.", collectionLabels, nil)
+	poolCanceledAcquiresDesc = prometheus.NewDesc("textscout_pgx_pool_canceled_acquires_total",
+		"Acquires cancelled before a connection was available.", collectionLabels, nil)
+)
+
+// reads the size and the database pool of every ready collection when scraped
+type collectionsCollector struct {
+	collections *Collections
+}
+
+func (c *collectionsCollector) Describe(ch chan<- *prometheus.Desc) {
+	for _, desc := range []*prometheus.Desc{
+		indexDocumentsDesc, indexTermsDesc, indexPostingsBytesDesc, buildDurationDesc,
+		poolAcquiredDesc, poolIdleDesc, poolConstructingDesc, poolMaxDesc,
+		poolAcquiresDesc, poolAcquireDurationDesc, poolEmptyAcquiresDesc, poolCanceledAcquiresDesc,
+	} {
+		ch <- desc
+	}
+}
+
+func (c *collectionsCollector) Collect(ch chan<- prometheus.Metric) {
+	states, release := c.collections.snapshot()
+	defer release()
+	for _, state := range states {
+		if state.api == nil {
+			continue
+		}
+		gauge := func(desc *prometheus.Desc, value float64) {
+			ch <- prometheus.MustNewConstMetric(desc, prometheus.GaugeValue, value, state.name, state.searchBy)
+		}
+		counter := func(desc *prometheus.Desc, value float64) {
+			ch <- prometheus.MustNewConstMetric(desc, prometheus.CounterValue, value, state.name, state.searchBy)
+		}
+
+		if state.buildTime > 0 {
+			gauge(buildDurationDesc, state.buildTime.Seconds())
+		}
+		// a database which can't tell its size leaves the collection out, /api/v1/status says why
+		if reporter, ok := state.api.backend.(backend.StatsReporter); ok {
+			ctx, cancel := context.WithTimeout(context.Background(), pingTimeout)
+			stats, err := reporter.Stats(ctx)
+			cancel()
+			if err == nil {
+				gauge(indexDocumentsDesc, float64(stats.Documents))
+				if stats.Terms > 0 {
+					gauge(indexTermsDesc, float64(stats.Terms))
+					gauge(indexPostingsBytesDesc, float64(stats.PostingsBytes))
+				}
+			}
+		}
+		if reporter, ok := state.api.backend.(backend.PoolReporter); ok {
+			if stat := reporter.PoolStats(); stat != nil {
+				gauge(poolAcquiredDesc, float64(stat.AcquiredConns()))
+				gauge(poolIdleDesc, float64(stat.IdleConns()))
+				gauge(poolConstructingDesc, float64(stat.ConstructingConns()))
+				gauge(poolMaxDesc, float64(stat.MaxConns()))
+				counter(poolAcquiresDesc, float64(stat.AcquireCount()))
+				counter(poolAcquireDurationDesc, stat.AcquireDuration().Seconds())
+				counter(poolEmptyAcquiresDesc, float64(stat.EmptyAcquireCount()))
+				counter(poolCanceledAcquiresDesc, float64(stat.CanceledAcquireCount()))
+			}
+		}
+	}
+}
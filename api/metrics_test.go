@@ -0,0 +1,120 @@
+package api
+
+import (
+	"bufio"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"textscout/internal/dataset"
+	"time"
+)
+
+// the value of the series, i.e name{label="value"}, in the scrape of the router, 0 when it isn't there
+func scrapeMetric(t *testing.T, router http.Handler, series string) float64 {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status: %d, got: %d %s", http.StatusOK, rec.Code, rec.Body.String())
+	}
+	scanner := bufio.NewScanner(rec.Body)
+	for scanner.Scan() {
+		if value, ok := strings.CutPrefix(scanner.Text(), series+" "); ok {
+			f, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				t.Fatal(err)
+			}
+			return f
+		}
+	}
+	return 0
+}
+
+func TestMetrics(t *testing.T) {
+	collections := NewCollections(nil)
+	router := NewRouter(collections, NewHealth(collections), "films")
+
+	// the documents the index is built from are counted as they are loaded
+	ingested := `textscout_documents_ingested_total{collection="films"}`
+	ingestedBefore := scrapeMetric(t, router, ingested)
+	if _, err := collections.Create("films", CollectionSettings{SearchBy: "inmemIndex", Source: dataset.Source{Path: sampleFilePath}}); err != nil {
+		t.Fatal(err)
+	}
+	if got := scrapeMetric(t, router, ingested) - ingestedBefore; got != 6 {
+		t.Errorf("expected %s to grow by 6, got: %v", ingested, got)
+	}
+
+	// the counters are the process', other tests add to them as well
+	searched := `textscout_http_requests_total{backend="inmemIndex",route="/api/v1/collections/{name}/search",status="200"}`
+	notFound := `textscout_http_requests_total{backend="inmemIndex",route="/api/v1/collections/{name}/search",status="404"}`
+	zeroHits := `textscout_zero_hit_searches_total{backend="inmemIndex"}`
+	written := `textscout_documents_written_total{backend="inmemIndex",result="created"}`
+	before := map[string]float64{}
+	for _, series := range []string{searched, notFound, zeroHits, written} {
+		before[series] = scrapeMetric(t, router, series)
+	}
+
+	for _, req := range []*http.Request{
+		httptest.NewRequest(http.MethodGet, "/api/v1/collections/films/search?title=kong", nil),
+		httptest.NewRequest(http.MethodGet, "/api/v1/collections/films/search?title=mothra", nil),
+		httptest.NewRequest(http.MethodPost, "/api/v1/collections/films/documents", strings.NewReader(`{"id": 1, "title": "Mothra"}`)),
+	} {
+		router.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	// the route is the pattern, not the path with the name of the collection
+	for series, expected := range map[string]float64{searched: 1, notFound: 1, zeroHits: 1, written: 1} {
+		if got := scrapeMetric(t, router, series) - before[series]; got != expected {
+			t.Errorf("expected %s to grow by %v, got: %v", series, expected, got)
+		}
+	}
+
+	// the size of the index, with the document added
+	if docs := scrapeMetric(t, router, `textscout_index_documents{backend="inmemIndex",collection="films"}`); docs != 7 {
+		t.Errorf("expected 7 documents, got: %v", docs)
+	}
+	if terms := scrapeMetric(t, router, `textscout_index_terms{backend="inmemIndex",collection="films"}`); terms < 126 {
+		t.Errorf("expected at least 126 terms, got: %v", terms)
+	}
+	if size := scrapeMetric(t, router, `textscout_index_postings_bytes{backend="inmemIndex",collection="films"}`); size <= 0 {
+		t.Errorf("expected the size of the posting lists, got: %v", size)
+	}
+}
+
+func TestInstrumentKeepsTheWriter(t *testing.T) {
+	var unwrapped bool
+	handler := Instrument("/stream", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("first"))
+		// a streaming handler flushes through the recorder of the status
+		if flusher, ok := w.(http.Flusher); ok {
+			flusher.Flush()
+		}
+		// and reaches the writer underneath it through a response controller
+		err := http.NewResponseController(w).SetWriteDeadline(time.Now().Add(time.Second))
+		unwrapped = !errors.Is(err, http.ErrNotSupported)
+	}))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/stream", nil))
+	if !rec.Flushed {
+		t.Errorf("expected the response to be flushed")
+	}
+	if rec.Body.String() != "first" {
+		t.Errorf("expected the body first, got: %q", rec.Body.String())
+	}
+
+	// the server's writer supports deadlines, which the recorder only passes on once unwrapped
+	server := httptest.NewServer(handler)
+	defer server.Close()
+	resp, err := http.Get(server.URL + "/stream")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if !unwrapped {
+		t.Errorf("expected the write deadline to reach the writer of the server")
+	}
+}
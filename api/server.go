@@ -3,37 +3,58 @@ package api
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"log"
+	"net"
 	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
 	"textscout/common"
-	textsearch "textscout/inmemsearch"
-	"textscout/internal/database"
+	"textscout/internal/backend"
 	"time"
-
-	"github.com/jackc/pgx/v5/pgtype"
 )
 
 type SearchAPI struct {
-	querier       database.Querier
-	inMemoryIndex *textsearch.InMemSearch
-	searchBy      string
+	backend  backend.Backend
+	searchBy string
+	schema   *common.Schema
+	// match any of the query tokens instead of all of them
+	union bool
+	// cap on the number of documents a search returns, 0 leaves it to the backend
+	maxResults int
+	// timeouts and limits of the requests
+	server common.ServerConfig
 }
 
+// query parameters which aren't the text of an indexed field
+const (
+	explainParam      = "explain"
+	sortParam         = "sort"
+	timeoutParam      = "timeout"
+	filterParamPrefix = "filter."
+)
+
 // Middlewares:
-// 1. Validator: validate its a GET request, check for at least one query params present to search.
+// 1. Validator: validate its a GET request, check for at least one query params of the indexed fields present to search.
 // 2. Logger: log every incoming request
+// 3. RequestID: give every request an id, see errors.go
+
+func Validator(schema *common.Schema, next http.Handler) http.Handler {
+	params := make([]string, 0)
+	for _, f := range schema.IndexedFields() {
+		params = append(params, f.QueryParam)
+	}
 
-func Validator(next http.Handler) http.Handler {
 	f := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodGet {
-			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+			httpError(w, "Method Not Allowed", http.StatusMethodNotAllowed)
 			return
 		}
-		queryValues := r.URL.Query()
-		title := queryValues.Get("title")
-		desc := queryValues.Get("desc")
-		if title == "" && desc == "" {
-			http.Error(w, "At least one query parameter (title or desc) is required", http.StatusBadRequest)
+		if queryText(schema, r.URL.Query()) == "" {
+			httpError(w, fmt.Sprintf("At least one query parameter (%s) is required", strings.Join(params, " or ")), http.StatusBadRequest)
 			return
 		}
 
@@ -45,7 +66,7 @@ func Validator(next http.Handler) http.Handler {
 func Logger(next http.Handler) http.Handler {
 	f := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 
-		log.Printf("Method: %s and URI: %s\n", r.Method, r.RequestURI)
+		log.Printf("Method: %s and URI: %s, request %s\n", r.Method, r.RequestURI, w.Header().Get(requestIDHeader))
 
 		next.ServeHTTP(w, r)
 
@@ -53,74 +74,50 @@ func Logger(next http.Handler) http.Handler {
 	return f
 }
 
-func (s *SearchAPI) readyResponseDB(resp []database.Movie) common.Response {
-	movies := []common.MovieData{}
-
-	for _, data := range resp {
-		d := common.MovieData{
-			Adult:         data.Adult.Bool,
-			BackdropPath:  data.BackdropPath.String,
-			GenreIDs:      data.GenreIds,
-			ID:            data.MovieID,
-			Language:      data.MovieLanguage.String,
-			OriginalTitle: data.MovieOriginalTitle.String,
-			Overview:      data.MovieOverview.String,
-			Popularity:    data.Popularity.Float64,
-			PosterPath:    data.PosterPath.String,
-			ReleaseDate:   data.ReleaseDate.String,
-			MovieTitle:    data.MovieTitle,
-			Video:         data.Video.Bool,
-			VoteAverage:   data.VoteAverage.Float64,
-			VoteCount:     data.VoteCount.Int64,
+func (s *SearchAPI) readyResponse(hits []backend.Hit) common.Response {
+	docs := []map[string]interface{}{}
+
+	for _, hit := range hits {
+		d := s.schema.StoredFields(hit.Fields)
+		if len(hit.Highlights) != 0 {
+			d["_highlights"] = hit.Highlights
 		}
-		movies = append(movies, d)
+		docs = append(docs, d)
 	}
 
 	return common.Response{
-		Movies: movies,
+		s.schema.Name: docs,
 	}
 
 }
 
-func (s *SearchAPI) readyResponseInMemIndex(resp []textsearch.Document) common.Response {
-	movies := []common.MovieData{}
-
-	for _, data := range resp {
-		d := common.MovieData{
-			Adult:         data.Adult,
-			BackdropPath:  data.BackdropPath,
-			GenreIDs:      data.GenreIDs,
-			ID:            data.MovieID,
-			Language:      data.Language,
-			OriginalTitle: data.OriginalTitle,
-			Overview:      data.Overview,
-			Popularity:    data.Popularity,
-			PosterPath:    data.PosterPath,
-			ReleaseDate:   data.ReleaseDate,
-			MovieTitle:    data.MovieTitle,
-			Video:         data.Video,
-			VoteAverage:   data.VoteAverage,
-			VoteCount:     data.VoteCount,
-		}
-		movies = append(movies, d)
-	}
+// the documents carry their score and how it was computed
+func (s *SearchAPI) readyExplainResponse(result backend.Result) map[string]interface{} {
+	docs := []map[string]interface{}{}
 
-	return common.Response{
-		Movies: movies,
+	for _, hit := range result.Hits {
+		d := s.schema.StoredFields(hit.Fields)
+		d["_score"] = hit.Score
+		d["_explanation"] = hit.Explanation
+		docs = append(docs, d)
 	}
 
+	return map[string]interface{}{
+		"analysis":    result.Analysis,
+		s.schema.Name: docs,
+	}
 }
 
-func (s *SearchAPI) validateAndWriteAPIResponseDatabase(w http.ResponseWriter, dbResp []database.Movie) {
-	if len(dbResp) == 0 {
-		http.Error(w, "no records found", http.StatusNotFound)
+func (s *SearchAPI) writeResponse(w http.ResponseWriter, hits []backend.Hit, resp interface{}) {
+	if len(hits) == 0 {
+		httpError(w, "no records found", http.StatusNotFound)
 		return
 	}
 
-	jsonBytes, err := json.Marshal(s.readyResponseDB(dbResp))
+	jsonBytes, err := json.Marshal(resp)
 	if err != nil {
-		log.Fatalf("failed to marshal the resp: %+v", err)
-		http.Error(w, "internal server error", http.StatusInternalServerError)
+		log.Printf("failed to marshal the resp: %+v", err)
+		httpError(w, "internal server error", http.StatusInternalServerError)
 		return
 	}
 
@@ -129,145 +126,296 @@ func (s *SearchAPI) validateAndWriteAPIResponseDatabase(w http.ResponseWriter, d
 	w.Write(jsonBytes)
 }
 
-func (s *SearchAPI) validateAndWriteAPIResponseInMemIndex(w http.ResponseWriter, inMemResp []textsearch.Document) {
-	if len(inMemResp) == 0 {
-		http.Error(w, "no records found", http.StatusNotFound)
-		return
+func (s *SearchAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// search the backend given the search query/queries
+	values := r.URL.Query()
+	req := backend.Request{
+		Query:   queryText(s.schema, values),
+		Fields:  make(map[string]string),
+		Union:   s.union,
+		Filters: make(map[string]string),
+		Sort:    values.Get(sortParam),
+		Explain: values.Get(explainParam) == "true",
+		Limit:   s.maxResults,
+	}
+	for _, f := range s.schema.IndexedFields() {
+		if text := values.Get(f.QueryParam); text != "" {
+			req.Fields[f.QueryParam] = text
+		}
+	}
+	for param := range values {
+		if strings.HasPrefix(param, filterParamPrefix) {
+			req.Filters[strings.TrimPrefix(param, filterParamPrefix)] = values.Get(param)
+		}
 	}
 
-	jsonBytes, err := json.Marshal(s.readyResponseInMemIndex(inMemResp))
+	ctx, cancel, partial, err := s.searchContext(r)
 	if err != nil {
-		log.Fatalf("failed to marshal the resp: %+v", err)
-		http.Error(w, "internal server error", http.StatusInternalServerError)
+		httpError(w, err.Error(), http.StatusBadRequest)
 		return
 	}
-
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
-	w.Write(jsonBytes)
-}
-
-func (s *SearchAPI) useDatabase(w http.ResponseWriter, title string, desc string) {
-
-	if title != "" && desc != "" {
-		// search by both and return the results
-		context, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-		defer cancel()
-
-		args := database.GetMovieByTitleAndDescParams{
-			Column1: pgtype.Text{
-				String: title,
-				Valid:  true,
-			},
-			Column2: pgtype.Text{
-				String: desc,
-				Valid:  true,
-			},
-		}
-
-		resp, err := s.querier.GetMovieByTitleAndDesc(context, args)
-		if err != nil {
-			log.Fatalf("error while searching by both title and desc: %+v", err.Error())
-			http.Error(w, "internal server error", http.StatusInternalServerError)
+	defer cancel()
+	result, err := s.backend.Search(ctx, req)
+	if partial && isTimeout(err) {
+		result.TimedOut, err = true, nil
+	}
+	if err == nil {
+		observeSearch(s.searchBy, result)
+	}
+	if err != nil {
+		if clientGone(w, r, err) {
 			return
 		}
-		s.validateAndWriteAPIResponseDatabase(w, resp)
-	} else if title != "" {
-		// search by the title
-		context, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-		defer cancel()
-
-		args := pgtype.Text{
-			String: title,
-			Valid:  true,
-		}
+		writeBackendError(w, "searching by "+s.searchBy, err)
+		return
+	}
 
-		resp, err := s.querier.GetMovieByTitle(context, args)
-		if err != nil {
-			log.Fatalf("error while searching by title: %+v", err.Error())
-			http.Error(w, "internal server error", http.StatusInternalServerError)
-			return
+	if result.TimedOut {
+		// none found in time isn't the same as no records found
+		resp := map[string]interface{}{s.schema.Name: s.readyResponse(result.Hits)[s.schema.Name]}
+		if req.Explain {
+			resp = s.readyExplainResponse(result)
 		}
-		s.validateAndWriteAPIResponseDatabase(w, resp)
+		resp["timed_out"] = true
+		writeJSON(w, http.StatusOK, resp)
+		return
+	}
+	if req.Explain {
+		s.writeResponse(w, result.Hits, s.readyExplainResponse(result))
 	} else {
-		// search by the desc
-		context, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-		defer cancel()
-
-		args := pgtype.Text{
-			String: desc,
-			Valid:  true,
-		}
+		s.writeResponse(w, result.Hits, s.readyResponse(result.Hits))
+	}
+}
 
-		resp, err := s.querier.GetMovieByDesc(context, args)
+// the context of a search, cancelled at its timeout and when the client goes away. a timeout of
+// the client returns what was found in time, partial is then true, the one of the server is an error.
+// a timeout of the client past the one of the server is capped by it, and so is an error too
+func (s *SearchAPI) searchContext(r *http.Request) (context.Context, context.CancelFunc, bool, error) {
+	timeout, partial := s.server.SearchTimeout, false
+	if param := r.URL.Query().Get(timeoutParam); param != "" {
+		d, err := parseTimeout(param)
 		if err != nil {
-			log.Fatalf("error while searching by title: %+v", err.Error())
-			http.Error(w, "internal server error", http.StatusInternalServerError)
-			return
+			return nil, nil, false, err
 		}
-		s.validateAndWriteAPIResponseDatabase(w, resp)
+		timeout, partial = min(d, timeout), d < timeout
 	}
+	ctx, cancel := context.WithTimeout(r.Context(), timeout)
+	return ctx, cancel, partial, nil
 }
 
-func (s *SearchAPI) useInMemoryIndex(w http.ResponseWriter, title string, desc string) {
-	matchedDocIds := s.inMemoryIndex.Intersection(common.ConcatStrings(title, desc))
+// a duration such as 50ms or 2s, or a number of milliseconds
+func parseTimeout(param string) (time.Duration, error) {
+	d, err := time.ParseDuration(param)
+	if ms, msErr := strconv.Atoi(param); msErr == nil {
+		d, err = time.Duration(ms)*time.Millisecond, nil
+	}
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("timeout must be a positive duration such as 50ms or a number of milliseconds, got: %q", param)
+	}
+	return d, nil
+}
 
-	s.validateAndWriteAPIResponseInMemIndex(w, matchedDocIds)
+// concatenates the values of the query params of every indexed field
+func queryText(schema *common.Schema, values url.Values) string {
+	texts := make([]string, 0)
+	for _, f := range schema.IndexedFields() {
+		if text := values.Get(f.QueryParam); text != "" {
+			texts = append(texts, text)
+		}
+	}
+	if len(texts) == 0 {
+		return ""
+	}
+	return common.ConcatStrings(texts...)
+}
 
+func newSearchAPI(config *common.Config, collection string, settings CollectionSettings, schema *common.Schema) (*SearchAPI, error) {
+	searchBy := settings.SearchBy
+	if searchBy == "" {
+		searchBy = backend.Database
+	}
+	log.Printf("searching %s by %s", schema.Name, searchBy)
+	b, err := backend.New(searchBy, backend.Options{
+		Config:           config,
+		Source:           settings.Source,
+		Schema:           schema,
+		TrigramThreshold: settings.TrigramThreshold,
+		SyncFromDatabase: settings.SyncFromDatabase,
+		SQLitePath:       settings.SQLitePath,
+		Progress:         observeIngest(collection),
+	})
+	if err != nil {
+		return nil, err
+	}
+	server := common.DefaultServerConfig()
+	if config != nil {
+		server = config.Server
+	}
+	return &SearchAPI{
+		backend:    b,
+		searchBy:   searchBy,
+		schema:     schema,
+		union:      settings.DefaultOperator == "or",
+		maxResults: settings.MaxResults,
+		server:     server,
+	}, nil
 }
 
-func (s *SearchAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	// search the db given the search query/queries
-	values := r.URL.Query()
-	title := values.Get("title")
-	desc := values.Get("desc")
+// closes the backend, its database pool or the sync of its index with the database
+func (s *SearchAPI) close() {
+	if closer, ok := s.backend.(io.Closer); ok {
+		if err := closer.Close(); err != nil {
+			log.Printf("error while closing the %s backend: %+v", s.searchBy, err)
+		}
+	}
+}
 
-	if s.searchBy == "inmemIndex" {
-		s.useInMemoryIndex(w, title, desc)
-	} else {
-		s.useDatabase(w, title, desc)
+// NewRouter routes the endpoints to the collections, the one named by defaultCollection
+// is the one searched by /api/v1/search, /api/v1/movies and /api/v1/documents
+// Endpoints:
+// localhost:8080/api/v1/search?title=""&desc=""&filter.original_language=en&sort=-popularity&explain=true
+// localhost:8080/api/v1/analyze?analyzer=standard&text=""
+// localhost:8080/api/v1/movies/{id}/similar?limit=10
+// localhost:8080/api/v1/documents[/_bulk or /{id}] see Collections.Documents
+// localhost:8080/api/v1/collections and localhost:8080/api/v1/collections/{name}/... see Collections
+// localhost:8080/api/v1/aliases/{alias} see Collections.ServeAliases
+// localhost:8080/healthz, localhost:8080/readyz and localhost:8080/api/v1/status see Health
+// localhost:8080/metrics see metrics.go
+func NewRouter(collections *Collections, health *Health, defaultCollection string) http.Handler {
+	mux := http.NewServeMux()
+	// counted by the pattern of the route, the handlers serving several narrow it down
+	handle := func(pattern string, route string, handler http.Handler) {
+		mux.Handle(pattern, Instrument(route, handler))
 	}
+	handle("/api/v1/search", "/api/v1/search", collections.Search(defaultCollection))
+	handle("/api/v1/analyze", "/api/v1/analyze", http.HandlerFunc(Analyze))
+	handle("/api/v1/movies/", "/api/v1/movies/{id}/similar", collections.SimilarMovies(defaultCollection))
+	handle("/api/v1/documents", "/api/v1/documents", collections.StartupDocuments(defaultCollection))
+	handle("/api/v1/documents/", "/api/v1/documents", collections.StartupDocuments(defaultCollection))
+	handle("/api/v1/collections", "/api/v1/collections", collections)
+	handle("/api/v1/collections/", "/api/v1/collections/{name}", collections)
+	handle("/api/v1/aliases", "/api/v1/aliases", http.HandlerFunc(collections.ServeAliases))
+	handle("/api/v1/aliases/", "/api/v1/aliases/{alias}", http.HandlerFunc(collections.ServeAliases))
+	handle("/api/v1/status", "/api/v1/status", http.HandlerFunc(health.Status))
+	handle("/", "other", http.HandlerFunc(notFound))
+
+	// the probes of the orchestrator and the scrapes of prometheus come every few seconds, they aren't logged
+	root := http.NewServeMux()
+	root.Handle("/healthz", http.HandlerFunc(health.Live))
+	root.Handle("/readyz", http.HandlerFunc(health.Ready))
+	root.Handle("/metrics", MetricsHandler(collections))
+	root.Handle("/", Logger(mux))
+	return RequestID(root)
+}
 
+// Server is the REST server of the collections, see NewRouter for its endpoints
+type Server struct {
+	config      common.ServerConfig
+	collections *Collections
+	health      *Health
+	http        *http.Server
+	// the collection the server is started with and the file listing more
+	startup         *Collection
+	collectionsPath string
 }
 
-func initDB(dbName, dbUser, dbPass string) *database.Queries {
-	pgDB, err := database.NewPostgres(dbName, dbUser, dbPass)
+// NewServer validates the settings of the collection the server is started with, served as a
+// collection named after its schema, its index and the ones of the collections file are built by Serve
+func NewServer(config *common.Config, settings CollectionSettings, schema *common.Schema, collectionsPath string) (*Server, error) {
+	// /api/v1/search, /api/v1/movies and /api/v1/documents resolve the name on every request, so pointing
+	// an alias of the same name at a rebuilt collection swaps it in without a restart.
+	collections := NewCollections(config)
+	startup, err := collections.reserve(schema.Name, settings)
 	if err != nil {
-		panic(err.Error())
+		return nil, err
 	}
-	queries := database.New(pgDB.DB)
-	return queries
-}
+	health := NewHealth(collections)
 
-func getHandler(config *common.Config, searchBy string, filePath string) *SearchAPI {
-	if searchBy == "inmemIndex" {
-		log.Println("using the in-memory index for searching")
-		return &SearchAPI{
-			inMemoryIndex: textsearch.GetInMemSearch(filePath),
-			searchBy:      searchBy,
-		}
-	} else {
-		log.Println("using the database for searching")
-		return &SearchAPI{
-			querier:  initDB(config.DBName, config.DBUser, config.DBPass),
-			searchBy: searchBy,
-		}
+	server := common.DefaultServerConfig()
+	if config != nil {
+		server = config.Server
 	}
+	return &Server{
+		config:      server,
+		collections: collections,
+		health:      health,
+		http: &http.Server{
+			Addr:              server.Addr(),
+			Handler:           NewRouter(collections, health, schema.Name),
+			ReadTimeout:       server.ReadTimeout,
+			ReadHeaderTimeout: server.ReadHeaderTimeout,
+			WriteTimeout:      server.ResponseTimeout,
+			IdleTimeout:       server.IdleTimeout,
+			MaxHeaderBytes:    server.MaxHeaderBytes,
+		},
+		startup:         startup,
+		collectionsPath: collectionsPath,
+	}, nil
 }
 
-func StartServer(config *common.Config, searchBy string, filePath string) {
-	// REST server
-	// One Endpoint: localhost:8080/api/v1/search?title=""&desc=""
+// ListenAndServe listens on the address of the config and serves until the context is done, see Serve
+func (s *Server) ListenAndServe(ctx context.Context) error {
+	listener, err := net.Listen("tcp", s.http.Addr)
+	if err != nil {
+		s.collections.Close()
+		return err
+	}
+	return s.Serve(ctx, listener)
+}
 
-	s := getHandler(config, searchBy, filePath)
+// Serve builds the collections in the background and serves the requests until the context is done,
+// i.e. on SIGINT or SIGTERM, or a collection fails to build. /readyz reports whether they are built.
+// it then stops accepting connections, waits up to the shutdown timeout for the requests in flight
+// to finish and closes the collections along with their database pools.
+func (s *Server) Serve(ctx context.Context, listener net.Listener) error {
+	defer s.collections.Close()
+
+	errs := make(chan error, 2)
+	go func() {
+		errs <- s.http.Serve(listener)
+	}()
+	go func() {
+		if err := s.load(); err != nil {
+			errs <- err
+		}
+	}()
+	log.Printf("starting the server at %s", listener.Addr())
 
-	handler := Validator(Logger(s))
-	http.Handle("/api/v1/search", handler)
+	var serveErr error
+	select {
+	case serveErr = <-errs:
+	case <-ctx.Done():
+	}
 
-	log.Println("starting the server at port 8080")
-	err := http.ListenAndServe(":8080", handler)
-	if err != nil {
-		panic(err.Error())
+	s.health.stopping.Store(true)
+	log.Printf("shutting down the server, waiting up to %s for the requests in flight", s.config.ShutdownTimeout)
+	shutdownCtx := context.Background()
+	if s.config.ShutdownTimeout > 0 {
+		var cancel context.CancelFunc
+		shutdownCtx, cancel = context.WithTimeout(shutdownCtx, s.config.ShutdownTimeout)
+		defer cancel()
 	}
+	if err := s.http.Shutdown(shutdownCtx); err != nil {
+		// the requests still running are cut off
+		s.http.Close()
+		return errors.Join(serveErr, fmt.Errorf("failed to drain the requests in flight: %w", err))
+	}
+	log.Printf("the server is stopped")
+	return serveErr
+}
 
+// builds the collection the server is started with and the ones of the collections file, the server is ready after
+func (s *Server) load() error {
+	start := time.Now()
+	if err := s.collections.build(s.startup); err != nil {
+		return fmt.Errorf("failed to build the collection %s: %w", s.startup.Name, err)
+	}
+	if s.collectionsPath != "" {
+		if err := s.collections.LoadFile(s.collectionsPath); err != nil {
+			return err
+		}
+	}
+	s.health.loaded.Store(true)
+	log.Printf("the server is ready, the collections were built in %s", time.Since(start).Round(time.Millisecond))
+	return nil
 }
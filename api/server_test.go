@@ -0,0 +1,160 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"textscout/common"
+	"textscout/internal/dataset"
+	"time"
+)
+
+func TestServerShutdown(t *testing.T) {
+	settings := CollectionSettings{SearchBy: "inmemIndex", Source: dataset.Source{Path: sampleFilePath}}
+	server, err := NewServer(nil, settings, common.DefaultMovieSchema(), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// a request which is still running when the server is asked to stop
+	started, finish := make(chan struct{}), make(chan struct{})
+	router := server.http.Handler
+	server.http.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/slow" {
+			close(started)
+			<-finish
+		}
+		router.ServeHTTP(w, r)
+	})
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	url := "http://" + listener.Addr().String()
+	ctx, cancel := context.WithCancel(context.Background())
+	served := make(chan error, 1)
+	go func() {
+		served <- server.Serve(ctx, listener)
+	}()
+
+	// alive right away, ready once the index is built
+	resp, err := http.Get(url + "/healthz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected status: %d, got: %d", http.StatusOK, resp.StatusCode)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		resp, err := http.Get(url + "/readyz")
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode == http.StatusOK {
+			break
+		}
+		if resp.StatusCode != http.StatusServiceUnavailable || time.Now().After(deadline) {
+			t.Fatalf("expected the server to get ready, got: %d", resp.StatusCode)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	resp, err = http.Get(url + "/api/v1/search?title=kong")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected status: %d, got: %d", http.StatusOK, resp.StatusCode)
+	}
+
+	resp, err = http.Get(url + "/api/v1/status")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var status statusResponse
+	err = json.NewDecoder(resp.Body).Decode(&status)
+	resp.Body.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !status.Ready || len(status.Collections) != 1 || status.Memory.HeapAllocBytes == 0 {
+		t.Fatalf("expected the status of the ready movies collection, got: %+v", status)
+	}
+	movies := status.Collections[0]
+	if movies.SearchBy != "inmemIndex" || movies.Documents == nil || *movies.Documents != 6 || movies.Terms == nil || *movies.Terms == 0 || movies.BuiltAt == nil || movies.BuildTimeMs == nil {
+		t.Errorf("expected the size and build of the index, got: %+v", movies)
+	}
+
+	slow := make(chan *http.Response, 1)
+	go func() {
+		resp, err := http.Get(url + "/slow")
+		if err != nil {
+			t.Error(err)
+		}
+		slow <- resp
+	}()
+	<-started
+	cancel()
+
+	// no longer ready once shutting down, so the load balancer stops sending requests
+	deadline = time.Now().Add(5 * time.Second)
+	for !server.health.stopping.Load() && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	rec := httptest.NewRecorder()
+	server.health.Ready(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	if rec.Code != http.StatusServiceUnavailable || !strings.Contains(rec.Body.String(), "shutting down") {
+		t.Errorf("expected the server not to be ready while shutting down, got: %d %s", rec.Code, rec.Body.String())
+	}
+
+	// the server waits for the request in flight
+	select {
+	case err := <-served:
+		t.Fatalf("expected the server to wait for the request in flight, it returned: %v", err)
+	case <-time.After(100 * time.Millisecond):
+	}
+	close(finish)
+	if resp := <-slow; resp != nil {
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusNotFound {
+			t.Errorf("expected the slow request to get a response, got: %d", resp.StatusCode)
+		}
+	}
+	if err := <-served; err != nil {
+		t.Errorf("expected the server to stop cleanly, got: %v", err)
+	}
+
+	// the collections are released and the listener closed
+	if len(server.collections.List()) != 0 {
+		t.Errorf("expected the collections to be closed, got: %+v", server.collections.List())
+	}
+	if _, err := http.Get(url + "/api/v1/search?title=kong"); err == nil {
+		t.Errorf("expected the server to stop accepting connections")
+	}
+}
+
+func TestServerBuildFails(t *testing.T) {
+	settings := CollectionSettings{SearchBy: "inmemIndex", Source: dataset.Source{Path: "testdata/missing.json"}}
+	server, err := NewServer(nil, settings, common.DefaultMovieSchema(), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the server stops rather than serving without the collection it was started with
+	if err := server.Serve(context.Background(), listener); err == nil || !strings.Contains(err.Error(), "failed to build the collection movies") {
+		t.Errorf("expected the build to fail, got: %v", err)
+	}
+}
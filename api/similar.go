@@ -0,0 +1,67 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"textscout/internal/backend"
+)
+
+// SimilarMovies returns the movies most like the given one from the collection or alias
+// Endpoint: localhost:8080/api/v1/movies/{id}/similar?limit=10
+func (c *Collections) SimilarMovies(name string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// path is /api/v1/movies/{id}/similar
+		parts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/v1/movies/"), "/"), "/")
+		if len(parts) != 2 || parts[1] != "similar" {
+			notFound(w, r)
+			return
+		}
+		c.Similar(name, parts[0]).ServeHTTP(w, r)
+	})
+}
+
+func (s *SearchAPI) similar(w http.ResponseWriter, r *http.Request, id string) {
+	finder, ok := s.backend.(backend.SimilarFinder)
+	if !ok {
+		httpError(w, "similar movies are only supported when searching by the inmemIndex", http.StatusBadRequest)
+		return
+	}
+
+	limit := 0
+	if param := r.URL.Query().Get("limit"); param != "" {
+		var err error
+		limit, err = strconv.Atoi(param)
+		if err != nil || limit <= 0 {
+			httpError(w, "limit must be a positive integer", http.StatusBadRequest)
+			return
+		}
+	}
+
+	ctx, cancel, partial, err := s.searchContext(r)
+	if err != nil {
+		httpError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	defer cancel()
+	result, err := finder.Similar(ctx, id, limit)
+	if partial && isTimeout(err) {
+		result.TimedOut, err = true, nil
+	}
+	if err != nil {
+		if clientGone(w, r, err) {
+			return
+		}
+		writeBackendError(w, "finding the documents similar to "+id, err)
+		return
+	}
+
+	if result.TimedOut {
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			s.schema.Name: s.readyResponse(result.Hits)[s.schema.Name],
+			"timed_out":   true,
+		})
+		return
+	}
+	s.writeResponse(w, result.Hits, s.readyResponse(result.Hits))
+}
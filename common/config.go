@@ -1,25 +1,317 @@
 package common
 
 import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"net/url"
 	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
 
+	"github.com/BurntSushi/toml"
 	"github.com/joho/godotenv"
+	"gopkg.in/yaml.v3"
 )
 
+// Config is merged from, lowest to highest precedence: the defaults, the config file,
+// the environment (and .env) and the command line flags, see LoadConfig
 type Config struct {
-	DBName string
-	DBUser string
-	DBPass string
+	Server   ServerConfig `yaml:"server" toml:"server"`
+	Postgres ConnConfig   `yaml:"postgres" toml:"postgres"`
 }
 
+type ServerConfig struct {
+	// interface the server listens on, all of them when empty
+	Host string `yaml:"host" toml:"host"`
+	Port int    `yaml:"port" toml:"port"`
+	// how long a search, or a write of documents, may take before it is cancelled
+	SearchTimeout time.Duration `yaml:"search_timeout" toml:"search_timeout"`
+	WriteTimeout  time.Duration `yaml:"write_timeout" toml:"write_timeout"`
+	// longest line of a bulk request, i.e. the biggest document it can have
+	MaxBulkLineSize int `yaml:"max_bulk_line_size" toml:"max_bulk_line_size"`
+	// directory the collections created through the api read their files from, their
+	// file_path, schema_path and sqlite_path are relative to it and can't leave it
+	DataDir string `yaml:"data_dir" toml:"data_dir"`
+
+	// the timeouts of the http.Server, 0 means no timeout. reading a request, its headers included,
+	// handling it and writing the response, and how long a keep-alive connection may sit idle
+	ReadTimeout       time.Duration `yaml:"read_timeout" toml:"read_timeout"`
+	ReadHeaderTimeout time.Duration `yaml:"read_header_timeout" toml:"read_header_timeout"`
+	ResponseTimeout   time.Duration `yaml:"response_timeout" toml:"response_timeout"`
+	IdleTimeout       time.Duration `yaml:"idle_timeout" toml:"idle_timeout"`
+	MaxHeaderBytes    int           `yaml:"max_header_bytes" toml:"max_header_bytes"`
+	// how long the requests in flight have to finish once the server is asked to stop
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout" toml:"shutdown_timeout"`
+}
+
+// Addr is the address the server listens on, host:port
+func (s ServerConfig) Addr() string {
+	return net.JoinHostPort(s.Host, strconv.Itoa(s.Port))
+}
+
+// env var holding the path to the config file when it isn't passed to LoadConfig
+const ConfigFileEnv = "TEXTSCOUT_CONFIG"
+
+const redacted = "********"
+
+func DefaultConfig() *Config {
+	return &Config{
+		Server: DefaultServerConfig(),
+		Postgres: ConnConfig{
+			Host:            "localhost",
+			Port:            5432,
+			SSLMode:         "disable",
+			ApplicationName: "textscout",
+			ConnectTimeout:  10 * time.Second,
+			PingInterval:    time.Second,
+		},
+	}
+}
+
+func DefaultServerConfig() ServerConfig {
+	return ServerConfig{
+		Port:            8080,
+		SearchTimeout:   5 * time.Second,
+		WriteTimeout:    5 * time.Second,
+		MaxBulkLineSize: 1 << 20,
+		DataDir:         "data",
+
+		ReadTimeout:       time.Minute,
+		ReadHeaderTimeout: 10 * time.Second,
+		ResponseTimeout:   time.Minute,
+		IdleTimeout:       2 * time.Minute,
+		MaxHeaderBytes:    1 << 20,
+		ShutdownTimeout:   30 * time.Second,
+	}
+}
+
+// GetConfigOrDie loads the config without a file or flags, it panics if it is invalid
 func GetConfigOrDie() *Config {
-	err := godotenv.Load()
+	config, err := LoadConfig("")
 	if err != nil {
-		panic("error in reading the .env file")
+		panic(err.Error())
 	}
-	return &Config{
-		DBName: os.Getenv("POSTGRES_DB"),
-		DBUser: os.Getenv("POSTGRES_USER"),
-		DBPass: os.Getenv("POSTGRES_PASS"),
+	if err := config.Validate(); err != nil {
+		panic(err.Error())
+	}
+	return config
+}
+
+// LoadConfig reads the yaml or toml file at the path, TEXTSCOUT_CONFIG when the path is empty,
+// over the defaults and the environment over it. no file is read when neither is set.
+// the flags are applied by the caller, so the config isn't validated yet, see Validate.
+func LoadConfig(path string) (*Config, error) {
+	config := DefaultConfig()
+
+	// the .env file is optional, the variables may be set in the environment already
+	if err := godotenv.Load(); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("error in reading the .env file: %w", err)
+	}
+
+	if path == "" {
+		path = os.Getenv(ConfigFileEnv)
+	}
+	if path != "" {
+		if err := config.readFile(path); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := config.readEnv(); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+func (c *Config) readFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read the config file: %w", err)
+	}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		decoder := yaml.NewDecoder(bytes.NewReader(data))
+		// a misspelt key would otherwise be silently ignored
+		decoder.KnownFields(true)
+		if err := decoder.Decode(c); err != nil && !errors.Is(err, io.EOF) {
+			return fmt.Errorf("invalid config file %s: %w", path, err)
+		}
+	case ".toml":
+		meta, err := toml.Decode(string(data), c)
+		if err != nil {
+			return fmt.Errorf("invalid config file %s: %w", path, err)
+		}
+		if undecoded := meta.Undecoded(); len(undecoded) != 0 {
+			return fmt.Errorf("invalid config file %s: unknown key %s", path, undecoded[0])
+		}
+	default:
+		return fmt.Errorf("config file must be .yaml, .yml or .toml, got: %s", path)
+	}
+	return nil
+}
+
+// the variables which are set override the file
+func (c *Config) readEnv() error {
+	env := &envReader{}
+	env.string("TEXTSCOUT_HOST", &c.Server.Host)
+	env.int("TEXTSCOUT_PORT", &c.Server.Port)
+	env.duration("TEXTSCOUT_SEARCH_TIMEOUT", &c.Server.SearchTimeout)
+	env.duration("TEXTSCOUT_WRITE_TIMEOUT", &c.Server.WriteTimeout)
+	env.int("TEXTSCOUT_MAX_BULK_LINE_SIZE", &c.Server.MaxBulkLineSize)
+	env.string("TEXTSCOUT_DATA_DIR", &c.Server.DataDir)
+	env.duration("TEXTSCOUT_READ_TIMEOUT", &c.Server.ReadTimeout)
+	env.duration("TEXTSCOUT_READ_HEADER_TIMEOUT", &c.Server.ReadHeaderTimeout)
+	env.duration("TEXTSCOUT_RESPONSE_TIMEOUT", &c.Server.ResponseTimeout)
+	env.duration("TEXTSCOUT_IDLE_TIMEOUT", &c.Server.IdleTimeout)
+	env.int("TEXTSCOUT_MAX_HEADER_BYTES", &c.Server.MaxHeaderBytes)
+	env.duration("TEXTSCOUT_SHUTDOWN_TIMEOUT", &c.Server.ShutdownTimeout)
+
+	pg := &c.Postgres
+	env.string("DATABASE_URL", &pg.URL)
+	env.string("POSTGRES_HOST", &pg.Host)
+	env.int("POSTGRES_PORT", &pg.Port)
+	env.string("POSTGRES_DB", &pg.Name)
+	env.string("POSTGRES_USER", &pg.User)
+	env.string("POSTGRES_PASS", &pg.Password)
+
+	env.string("POSTGRES_SSLMODE", &pg.SSLMode)
+	env.string("POSTGRES_SSLROOTCERT", &pg.SSLRootCert)
+	env.string("POSTGRES_SSLCERT", &pg.SSLCert)
+	env.string("POSTGRES_SSLKEY", &pg.SSLKey)
+
+	env.int32("POSTGRES_MAX_CONNS", &pg.MaxConns)
+	env.int32("POSTGRES_MIN_CONNS", &pg.MinConns)
+	env.duration("POSTGRES_MAX_CONN_IDLE_TIME", &pg.MaxConnIdleTime)
+	env.duration("POSTGRES_MAX_CONN_LIFETIME", &pg.MaxConnLifetime)
+	env.duration("POSTGRES_HEALTH_CHECK_PERIOD", &pg.HealthCheckPeriod)
+	env.duration("POSTGRES_STATEMENT_TIMEOUT", &pg.StatementTimeout)
+	env.string("POSTGRES_APPLICATION_NAME", &pg.ApplicationName)
+
+	env.duration("POSTGRES_CONNECT_TIMEOUT", &pg.ConnectTimeout)
+	env.duration("POSTGRES_PING_INTERVAL", &pg.PingInterval)
+	return errors.Join(env.errs...)
+}
+
+// Validate reports every invalid setting, named by its key in the config file
+func (c *Config) Validate() error {
+	var errs []error
+	if c.Server.Port < 1 || c.Server.Port > 65535 {
+		errs = append(errs, fmt.Errorf("server.port must be between 1 and 65535, got: %d", c.Server.Port))
+	}
+	if c.Server.SearchTimeout <= 0 {
+		errs = append(errs, fmt.Errorf("server.search_timeout must be positive, got: %s", c.Server.SearchTimeout))
+	}
+	if c.Server.WriteTimeout <= 0 {
+		errs = append(errs, fmt.Errorf("server.write_timeout must be positive, got: %s", c.Server.WriteTimeout))
+	}
+	if c.Server.MaxBulkLineSize < 1024 {
+		errs = append(errs, fmt.Errorf("server.max_bulk_line_size must be at least 1024 bytes, got: %d", c.Server.MaxBulkLineSize))
+	}
+	if c.Server.DataDir == "" {
+		errs = append(errs, fmt.Errorf("server.data_dir must be set"))
+	}
+	timeouts := []struct {
+		key string
+		d   time.Duration
+	}{
+		{"read_timeout", c.Server.ReadTimeout},
+		{"read_header_timeout", c.Server.ReadHeaderTimeout},
+		{"response_timeout", c.Server.ResponseTimeout},
+		{"idle_timeout", c.Server.IdleTimeout},
+		{"shutdown_timeout", c.Server.ShutdownTimeout},
+	}
+	for _, t := range timeouts {
+		if t.d < 0 {
+			errs = append(errs, fmt.Errorf("server.%s must not be negative, got: %s", t.key, t.d))
+		}
+	}
+	// a search cut off by the server would never get to report its timeout
+	if c.Server.ResponseTimeout > 0 && c.Server.ResponseTimeout <= c.Server.SearchTimeout {
+		errs = append(errs, fmt.Errorf("server.response_timeout must be longer than server.search_timeout %s, got: %s", c.Server.SearchTimeout, c.Server.ResponseTimeout))
+	}
+	if c.Server.MaxHeaderBytes < 0 {
+		errs = append(errs, fmt.Errorf("server.max_header_bytes must not be negative, got: %d", c.Server.MaxHeaderBytes))
+	}
+	// the connection is only made when needed, but a wrong setting is reported right away
+	if _, err := c.Postgres.PoolConfig(); err != nil {
+		errs = append(errs, fmt.Errorf("postgres.%w", err))
+	}
+	return errors.Join(errs...)
+}
+
+// Print writes the config as yaml with the passwords redacted
+func (c *Config) Print(w io.Writer) error {
+	printed := *c
+	if printed.Postgres.Password != "" {
+		printed.Postgres.Password = redacted
+	}
+	if u, err := url.Parse(printed.Postgres.URL); err == nil && printed.Postgres.URL != "" {
+		printed.Postgres.URL = u.Redacted()
+	} else if printed.Postgres.URL != "" {
+		printed.Postgres.URL = redacted
+	}
+	encoder := yaml.NewEncoder(w)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(printed); err != nil {
+		return err
+	}
+	return encoder.Close()
+}
+
+// parses the variables which are set, collecting the errors so all of them are reported
+type envReader struct {
+	errs []error
+}
+
+func (e *envReader) string(key string, dst *string) {
+	if value := os.Getenv(key); value != "" {
+		*dst = value
+	}
+}
+
+func (e *envReader) int(key string, dst *int) {
+	value := os.Getenv(key)
+	if value == "" {
+		return
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		e.errs = append(e.errs, fmt.Errorf("%s must be an integer, got: %q", key, value))
+		return
+	}
+	*dst = n
+}
+
+func (e *envReader) int32(key string, dst *int32) {
+	value := os.Getenv(key)
+	if value == "" {
+		return
+	}
+	// a value past the range of an int32 is an error rather than wrapping around
+	n, err := strconv.ParseInt(value, 10, 32)
+	if err != nil {
+		e.errs = append(e.errs, fmt.Errorf("%s must be an integer between %d and %d, got: %q", key, math.MinInt32, math.MaxInt32, value))
+		return
+	}
+	*dst = int32(n)
+}
+
+// durations are in the go syntax, i.e 30s, 5m or 1h30m
+func (e *envReader) duration(key string, dst *time.Duration) {
+	value := os.Getenv(key)
+	if value == "" {
+		return
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		e.errs = append(e.errs, fmt.Errorf("%s must be a duration such as 30s or 5m, got: %q", key, value))
+		return
 	}
+	*dst = d
 }
@@ -1,9 +1,5 @@
 package common
 
-type Results struct {
-	Results []MovieData `json:"results"`
-}
-
 // search by title and overview(desc)
 type MovieData struct {
 	Adult         bool    `json:"adult,omitempty"`
@@ -22,6 +18,5 @@ type MovieData struct {
 	VoteCount     int64   `json:"vote_count,omitempty"`
 }
 
-type Response struct {
-	Movies []MovieData `json:"movies"`
-}
+// documents keyed by the name of their schema, i.e {"movies": [...]}
+type Response map[string][]map[string]interface{}
@@ -0,0 +1,68 @@
+package common
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPoolConfig(t *testing.T) {
+	config := ConnConfig{
+		Host:             "db.internal",
+		Port:             6432,
+		Name:             "movies",
+		User:             "textscout",
+		Password:         "p@ss/word",
+		SSLMode:          "require",
+		MaxConns:         20,
+		MinConns:         2,
+		MaxConnIdleTime:  time.Minute,
+		StatementTimeout: 3 * time.Second,
+		ApplicationName:  "textscout",
+	}
+	poolConfig, err := config.PoolConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn := poolConfig.ConnConfig
+	if conn.Host != "db.internal" || conn.Port != 6432 || conn.Database != "movies" || conn.Password != "p@ss/word" {
+		t.Errorf("expected the connection settings to be kept, got: %s:%d/%s", conn.Host, conn.Port, conn.Database)
+	}
+	if conn.TLSConfig == nil {
+		t.Errorf("expected tls with sslmode require")
+	}
+	if poolConfig.MaxConns != 20 || poolConfig.MinConns != 2 || poolConfig.MaxConnIdleTime != time.Minute {
+		t.Errorf("expected the pool settings to be applied, got: %d %d %s", poolConfig.MaxConns, poolConfig.MinConns, poolConfig.MaxConnIdleTime)
+	}
+	if conn.RuntimeParams["statement_timeout"] != "3000" || conn.RuntimeParams["application_name"] != "textscout" {
+		t.Errorf("expected the session params to be set, got: %v", conn.RuntimeParams)
+	}
+
+	// the url is used as it is, the pool settings still apply to it
+	poolConfig, err = ConnConfig{URL: "postgres://u:p@managed.example.com:5433/prod?sslmode=disable", MaxConns: 5}.PoolConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if poolConfig.ConnConfig.Host != "managed.example.com" || poolConfig.ConnConfig.Port != 5433 || poolConfig.MaxConns != 5 {
+		t.Errorf("expected the url with the pool settings, got: %s:%d %d", poolConfig.ConnConfig.Host, poolConfig.ConnConfig.Port, poolConfig.MaxConns)
+	}
+
+	// an ipv6 host is bracketed in the connection string
+	poolConfig, err = ConnConfig{Host: "::1", Port: 5433, Name: "movies"}.PoolConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if poolConfig.ConnConfig.Host != "::1" || poolConfig.ConnConfig.Port != 5433 || poolConfig.ConnConfig.Database != "movies" {
+		t.Errorf("expected the ipv6 host, got: %s:%d/%s", poolConfig.ConnConfig.Host, poolConfig.ConnConfig.Port, poolConfig.ConnConfig.Database)
+	}
+
+	for _, invalid := range []ConnConfig{
+		{SSLMode: "sometimes"},
+		{Port: 70000},
+		{MaxConns: 2, MinConns: 3},
+		{StatementTimeout: -time.Second},
+	} {
+		if _, err := invalid.PoolConfig(); err == nil {
+			t.Errorf("expected an error for %+v", invalid)
+		}
+	}
+}
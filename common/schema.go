@@ -0,0 +1,354 @@
+package common
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type FieldType string
+
+const (
+	// analysed full text
+	TextFieldType FieldType = "text"
+	// string matched as a whole, i.e. a language code or a path
+	KeywordFieldType FieldType = "keyword"
+	IntegerFieldType FieldType = "integer"
+	FloatFieldType   FieldType = "float"
+	BooleanFieldType FieldType = "boolean"
+	// string in the YYYY-MM-DD format, so it sorts lexicographically
+	DateFieldType FieldType = "date"
+)
+
+const dateLayout = "2006-01-02"
+
+// describes the documents of a dataset, i.e which fields they have and how each is searched
+type Schema struct {
+	// name of the dataset, also the key the documents are returned under in the API response
+	Name string `json:"name"`
+	// field uniquely identifying a document in the dataset
+	IDField string         `json:"id_field"`
+	Fields  []FieldMapping `json:"fields"`
+}
+
+type FieldMapping struct {
+	Name  string    `json:"name"`
+	Type  FieldType `json:"type"`
+	Array bool      `json:"array,omitempty"`
+	// analysed and added to the inverted index, only text fields can be indexed
+	Indexed bool `json:"indexed,omitempty"`
+	// returned in the API response
+	Stored bool `json:"stored,omitempty"`
+	// can be matched exactly with filter.<name>=value
+	Filterable bool `json:"filterable,omitempty"`
+	// can be ordered by with sort=<name> or sort=-<name>
+	Sortable bool `json:"sortable,omitempty"`
+	// analyzer used for indexing and querying the field, defaults to standard
+	Analyzer string `json:"analyzer,omitempty"`
+	// weight of a match in this field while scoring, defaults to 1
+	Boost float64 `json:"boost,omitempty"`
+	// name of the search query parameter for this field, defaults to the field name
+	QueryParam string `json:"query_param,omitempty"`
+	// left out of the response when it is false, 0, "" or an empty array, as omitempty does in json
+	OmitEmpty bool `json:"omit_empty,omitempty"`
+}
+
+//go:embed schemas/movies.json
+var moviesSchemaJSON []byte
+
+// schema of the TMDB movies dataset, used when no schema file is given
+func DefaultMovieSchema() *Schema {
+	schema, err := ParseSchema(moviesSchemaJSON)
+	if err != nil {
+		panic(err.Error())
+	}
+	return schema
+}
+
+// reads the schema from a json file, an empty path returns the movies schema
+func LoadSchema(filePath string) (*Schema, error) {
+	if filePath == "" {
+		return DefaultMovieSchema(), nil
+	}
+
+	jsonBytes, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the schema file: %w", err)
+	}
+	return ParseSchema(jsonBytes)
+}
+
+func ParseSchema(jsonBytes []byte) (*Schema, error) {
+	var schema Schema
+	if err := json.Unmarshal(jsonBytes, &schema); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal the schema: %w", err)
+	}
+	if err := schema.validate(); err != nil {
+		return nil, err
+	}
+
+	for i := range schema.Fields {
+		f := &schema.Fields[i]
+		if f.Boost == 0 {
+			f.Boost = 1
+		}
+		if f.Indexed && f.QueryParam == "" {
+			f.QueryParam = f.Name
+		}
+	}
+	return &schema, nil
+}
+
+func (s *Schema) validate() error {
+	if s.Name == "" {
+		return fmt.Errorf("schema name is required")
+	}
+	if len(s.Fields) == 0 {
+		return fmt.Errorf("schema %s has no fields", s.Name)
+	}
+
+	names := make(map[string]struct{}, len(s.Fields))
+	indexed := 0
+	for _, f := range s.Fields {
+		if f.Name == "" {
+			return fmt.Errorf("schema %s has a field without a name", s.Name)
+		}
+		if _, ok := names[f.Name]; ok {
+			return fmt.Errorf("field %s is defined more than once", f.Name)
+		}
+		names[f.Name] = struct{}{}
+
+		switch f.Type {
+		case TextFieldType, KeywordFieldType, IntegerFieldType, FloatFieldType, BooleanFieldType, DateFieldType:
+		default:
+			return fmt.Errorf("field %s has an unknown type: %q", f.Name, f.Type)
+		}
+		if f.Indexed {
+			if f.Type != TextFieldType {
+				return fmt.Errorf("field %s can't be indexed, only text fields can", f.Name)
+			}
+			indexed++
+		}
+		if f.Sortable && f.Array {
+			return fmt.Errorf("field %s can't be sortable since it is an array", f.Name)
+		}
+		if f.Boost < 0 {
+			return fmt.Errorf("field %s has a negative boost", f.Name)
+		}
+	}
+
+	if indexed == 0 {
+		return fmt.Errorf("schema %s has no indexed fields to search", s.Name)
+	}
+	if _, ok := names[s.IDField]; !ok {
+		return fmt.Errorf("id_field %q is not one of the fields", s.IDField)
+	}
+	return nil
+}
+
+func (s *Schema) Field(name string) (FieldMapping, bool) {
+	for _, f := range s.Fields {
+		if f.Name == name {
+			return f, true
+		}
+	}
+	return FieldMapping{}, false
+}
+
+func (s *Schema) IndexedFields() []FieldMapping {
+	fields := make([]FieldMapping, 0)
+	for _, f := range s.Fields {
+		if f.Indexed {
+			fields = append(fields, f)
+		}
+	}
+	return fields
+}
+
+// Normalise converts the raw values of a decoded json document to the types of
+// the schema: string, int64, float64, bool or a []interface{} of those. Fields
+// which aren't part of the schema are dropped.
+// The raw document should be decoded with json.Decoder.UseNumber so integers keep their precision.
+func (s *Schema) Normalise(raw map[string]interface{}) (map[string]interface{}, error) {
+	fields := make(map[string]interface{}, len(s.Fields))
+
+	for _, f := range s.Fields {
+		value, ok := raw[f.Name]
+		if !ok || value == nil {
+			continue
+		}
+
+		if !f.Array {
+			converted, err := convertValue(f, value)
+			if err != nil {
+				return nil, err
+			}
+			fields[f.Name] = converted
+			continue
+		}
+
+		values, ok := value.([]interface{})
+		if !ok {
+			return nil, fmt.Errorf("field %s must be an array, got: %v", f.Name, value)
+		}
+		converted := make([]interface{}, 0, len(values))
+		for _, v := range values {
+			c, err := convertValue(f, v)
+			if err != nil {
+				return nil, err
+			}
+			converted = append(converted, c)
+		}
+		fields[f.Name] = converted
+	}
+
+	if _, ok := fields[s.IDField]; !ok {
+		return nil, fmt.Errorf("document is missing the id field %s", s.IDField)
+	}
+	return fields, nil
+}
+
+// the stored fields of the document, i.e what the API returns
+func (s *Schema) StoredFields(fields map[string]interface{}) map[string]interface{} {
+	stored := make(map[string]interface{}, len(fields))
+	for _, f := range s.Fields {
+		value, ok := fields[f.Name]
+		if !ok || !f.Stored || (f.OmitEmpty && isEmpty(value)) {
+			continue
+		}
+		stored[f.Name] = value
+	}
+	return stored
+}
+
+// the zero value of a normalised value
+func isEmpty(value interface{}) bool {
+	switch v := value.(type) {
+	case string:
+		return v == ""
+	case int64:
+		return v == 0
+	case float64:
+		return v == 0
+	case bool:
+		return !v
+	case []interface{}:
+		return len(v) == 0
+	case nil:
+		return true
+	}
+	return false
+}
+
+// the id of the document as a string, so ids of any type can be looked up the same way
+func (s *Schema) DocumentID(fields map[string]interface{}) string {
+	return FormatValue(fields[s.IDField])
+}
+
+// formats a normalised value the same way it would be written in a query parameter
+func FormatValue(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(v)
+	case nil:
+		return ""
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+func convertValue(f FieldMapping, value interface{}) (interface{}, error) {
+	invalid := fmt.Errorf("field %s must be of type %s, got: %v", f.Name, f.Type, value)
+
+	switch f.Type {
+	case TextFieldType, KeywordFieldType:
+		v, ok := value.(string)
+		if !ok {
+			return nil, invalid
+		}
+		return v, nil
+
+	case DateFieldType:
+		v, ok := value.(string)
+		if !ok {
+			return nil, invalid
+		}
+		if v == "" {
+			return v, nil
+		}
+		if _, err := time.Parse(dateLayout, v); err != nil {
+			return nil, fmt.Errorf("field %s must be a date in the YYYY-MM-DD format, got: %s", f.Name, v)
+		}
+		return v, nil
+
+	case IntegerFieldType:
+		switch v := value.(type) {
+		case json.Number:
+			i, err := v.Int64()
+			if err != nil {
+				return nil, invalid
+			}
+			return i, nil
+		case float64:
+			if v != float64(int64(v)) {
+				return nil, invalid
+			}
+			return int64(v), nil
+		case int64:
+			return v, nil
+		case string:
+			i, err := strconv.ParseInt(strings.TrimSpace(v), 10, 64)
+			if err != nil {
+				return nil, invalid
+			}
+			return i, nil
+		}
+		return nil, invalid
+
+	case FloatFieldType:
+		switch v := value.(type) {
+		case json.Number:
+			f, err := v.Float64()
+			if err != nil {
+				return nil, invalid
+			}
+			return f, nil
+		case float64:
+			return v, nil
+		case int64:
+			return float64(v), nil
+		case string:
+			f, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+			if err != nil {
+				return nil, invalid
+			}
+			return f, nil
+		}
+		return nil, invalid
+
+	case BooleanFieldType:
+		switch v := value.(type) {
+		case bool:
+			return v, nil
+		case string:
+			b, err := strconv.ParseBool(strings.TrimSpace(v))
+			if err != nil {
+				return nil, invalid
+			}
+			return b, nil
+		}
+		return nil, invalid
+	}
+
+	return nil, invalid
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+	"textscout/api"
+	"textscout/common"
+	"textscout/internal/backend"
+	"textscout/internal/dataset"
+	"time"
+)
+
+// the flags of the command, an invalid one prints its usage and exits
+func newFlagSet(c command) *flag.FlagSet {
+	fs := flag.NewFlagSet(c.name, flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: textscout %s\n\n%s\n\nflags:\n", c.usage, c.summary)
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+// the config file and the flags overriding it, only the ones which are set override the config
+type configFlags struct {
+	path              string
+	host              string
+	port              int
+	searchTimeout     time.Duration
+	writeTimeout      time.Duration
+	maxBulkLineSize   int
+	dataDir           string
+	readTimeout       time.Duration
+	readHeaderTimeout time.Duration
+	responseTimeout   time.Duration
+	idleTimeout       time.Duration
+	maxHeaderBytes    int
+	shutdownTimeout   time.Duration
+	databaseURL       string
+}
+
+func (c *configFlags) register(fs *flag.FlagSet) {
+	fs.StringVar(&c.path, "config", "", "path to a yaml or toml config file, defaults to $"+common.ConfigFileEnv+". the environment and the flags override it")
+	fs.StringVar(&c.host, "host", "", "interface the server listens on, all of them by default")
+	fs.IntVar(&c.port, "port", 0, "port the server listens on, 8080 by default")
+	fs.DurationVar(&c.searchTimeout, "searchTimeout", 0, "how long a search may take, 5s by default")
+	fs.DurationVar(&c.writeTimeout, "writeTimeout", 0, "how long a write of documents may take, 5s by default")
+	fs.IntVar(&c.maxBulkLineSize, "maxBulkLineSize", 0, "longest line of a bulk documents request in bytes, 1MiB by default")
+	fs.StringVar(&c.dataDir, "dataDir", "", "directory the collections created through the api read their files from, ./data by default")
+	fs.DurationVar(&c.readTimeout, "readTimeout", 0, "how long reading a request may take, 1m by default")
+	fs.DurationVar(&c.readHeaderTimeout, "readHeaderTimeout", 0, "how long reading the headers of a request may take, 10s by default")
+	fs.DurationVar(&c.responseTimeout, "responseTimeout", 0, "how long handling a request and writing its response may take, 1m by default")
+	fs.DurationVar(&c.idleTimeout, "idleTimeout", 0, "how long a keep-alive connection may sit idle, 2m by default")
+	fs.IntVar(&c.maxHeaderBytes, "maxHeaderBytes", 0, "largest size of the headers of a request in bytes, 1MiB by default")
+	fs.DurationVar(&c.shutdownTimeout, "shutdownTimeout", 0, "how long the requests in flight have to finish on SIGINT or SIGTERM, 30s by default")
+	fs.StringVar(&c.databaseURL, "databaseURL", "", "postgres connection string, overrides DATABASE_URL and the postgres settings of the config file")
+}
+
+// merges the config file, the environment and the flags set, in that order, and validates the result
+func (c *configFlags) load(fs *flag.FlagSet) (*common.Config, error) {
+	config, err := common.LoadConfig(c.path)
+	if err != nil {
+		return nil, err
+	}
+	fs.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "host":
+			config.Server.Host = c.host
+		case "port":
+			config.Server.Port = c.port
+		case "searchTimeout":
+			config.Server.SearchTimeout = c.searchTimeout
+		case "writeTimeout":
+			config.Server.WriteTimeout = c.writeTimeout
+		case "maxBulkLineSize":
+			config.Server.MaxBulkLineSize = c.maxBulkLineSize
+		case "dataDir":
+			config.Server.DataDir = c.dataDir
+		case "readTimeout":
+			config.Server.ReadTimeout = c.readTimeout
+		case "readHeaderTimeout":
+			config.Server.ReadHeaderTimeout = c.readHeaderTimeout
+		case "responseTimeout":
+			config.Server.ResponseTimeout = c.responseTimeout
+		case "idleTimeout":
+			config.Server.IdleTimeout = c.idleTimeout
+		case "maxHeaderBytes":
+			config.Server.MaxHeaderBytes = c.maxHeaderBytes
+		case "shutdownTimeout":
+			config.Server.ShutdownTimeout = c.shutdownTimeout
+		case "databaseURL":
+			config.Postgres.URL = c.databaseURL
+		}
+	})
+	if err := config.Validate(); err != nil {
+		return config, fmt.Errorf("invalid config:\n%w", err)
+	}
+	return config, nil
+}
+
+// the dataset a command reads, the flag of its path is named by the command
+type datasetFlags struct {
+	path         string
+	format       string
+	csvHeaderMap string
+}
+
+func (d *datasetFlags) register(fs *flag.FlagSet, pathFlag string) {
+	fs.StringVar(&d.path, pathFlag, "", "path to the dataset file to read from")
+	fs.StringVar(&d.format, "format", "", "format of the dataset file. possible values are json (also ndjson), csv and parquet, detected from the file extension by default")
+	fs.StringVar(&d.csvHeaderMap, "csvHeaderMap", "", "csv headers to the schema fields their columns hold, i.e Title=title,Language=original_language. headers named after a field don't need to be listed")
+}
+
+func (d *datasetFlags) source() (dataset.Source, error) {
+	f, err := dataset.ParseFormat(d.format)
+	if err != nil {
+		return dataset.Source{}, err
+	}
+	headerMap, err := dataset.ParseHeaderMap(d.csvHeaderMap)
+	if err != nil {
+		return dataset.Source{}, err
+	}
+	return dataset.Source{Path: d.path, Format: f, HeaderMap: headerMap}, nil
+}
+
+// the backend a command searches, see api.CollectionSettings
+type backendFlags struct {
+	searchBy         string
+	trigramThreshold float64
+	syncFromDB       bool
+	sqlitePath       string
+	schemaPath       string
+}
+
+func (b *backendFlags) register(fs *flag.FlagSet, defaultSearchBy string) {
+	fs.StringVar(&b.searchBy, "searchBy", defaultSearchBy, "backend to search. possible values are "+strings.Join(backend.Names(), ", "))
+	fs.Float64Var(&b.trigramThreshold, "trigramThreshold", 0, "minimum word similarity, between 0 and 1, of a movie matched when searching by trigram. defaults to pg_trgm's 0.6")
+	fs.BoolVar(&b.syncFromDB, "syncFromDB", false, "with searchBy inmemIndex, build the index from the movies table instead of the dataset and keep it in sync with the changes made to the table")
+	fs.StringVar(&b.sqlitePath, "sqlitePath", "textscout.db", "path to the sqlite database file used with searchBy sqlite")
+	fs.StringVar(&b.schemaPath, "schema", "", "path to the json file describing the fields of the documents, defaults to the movies schema")
+}
+
+// the validated settings of the backend, along with the schema of its documents
+func (b *backendFlags) settings(source dataset.Source) (api.CollectionSettings, *common.Schema, error) {
+	settings := api.CollectionSettings{
+		SearchBy:         b.searchBy,
+		Source:           source,
+		SchemaPath:       b.schemaPath,
+		TrigramThreshold: b.trigramThreshold,
+		SyncFromDatabase: b.syncFromDB,
+		SQLitePath:       b.sqlitePath,
+	}
+	if err := settings.Validate(); err != nil {
+		return settings, nil, fmt.Errorf("%w: %v", errUsage, err)
+	}
+	schema, err := common.LoadSchema(b.schemaPath)
+	if err != nil {
+		return settings, nil, err
+	}
+	return settings, schema, nil
+}
+
+// the backend searched when none is named: the index built from the dataset if there is one, otherwise the database
+func (b *backendFlags) resolve(datasetFlags *datasetFlags) error {
+	if b.searchBy == "" && datasetFlags.path != "" {
+		b.searchBy = backend.InMemIndex
+	}
+	if b.searchBy == "" {
+		b.searchBy = backend.Database
+	}
+	if !backend.Registered(b.searchBy) {
+		return fmt.Errorf("%w: searchBy must be one of %s, got: %q", errUsage, strings.Join(backend.Names(), ", "), b.searchBy)
+	}
+	if b.searchBy == backend.InMemIndex && datasetFlags.path == "" && !b.syncFromDB {
+		return fmt.Errorf("%w: specify the dataset to build the index from with -index", errUsage)
+	}
+	return nil
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"textscout/internal/backend"
+	"textscout/internal/populate"
+)
+
+func runIngest(fs *flag.FlagSet, args []string) error {
+	var configFlags configFlags
+	var datasetFlags datasetFlags
+	var searchBy, sqlitePath string
+	configFlags.register(fs)
+	datasetFlags.register(fs, "filePath")
+	fs.StringVar(&searchBy, "searchBy", backend.Database, "where the movies are loaded, sqlite loads them into the sqlite database at sqlitePath and anything else into postgres")
+	fs.StringVar(&sqlitePath, "sqlitePath", "textscout.db", "path to the sqlite database file used with searchBy sqlite")
+	if rest := parseArgs(fs, args); len(rest) != 0 {
+		return fmt.Errorf("%w: ingest takes no args, got: %v", errUsage, rest)
+	}
+	if datasetFlags.path == "" {
+		return fmt.Errorf("%w: specify the filePath to read the data from", errUsage)
+	}
+
+	config, err := configFlags.load(fs)
+	if err != nil {
+		return err
+	}
+	source, err := datasetFlags.source()
+	if err != nil {
+		return err
+	}
+	u := &populate.InsertData{
+		FilePath:  source.Path,
+		Format:    source.Format,
+		HeaderMap: source.HeaderMap,
+		Config:    config,
+	}
+	if searchBy == backend.SQLite {
+		u.SQLitePath = sqlitePath
+	}
+	return u.InsertMovies()
+}
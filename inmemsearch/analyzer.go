@@ -0,0 +1,146 @@
+package inmemsearch
+
+import (
+	"fmt"
+	"sort"
+)
+
+// names of the registered analyzers
+const (
+	// tokenise + normalise + stopWordsRemoval + stemming, used for indexing and querying
+	StandardAnalyzer = "standard"
+	// tokenise + normalise, keeps the words as they are written
+	SimpleAnalyzer = "simple"
+	// the whole text as a single lowercased token
+	KeywordAnalyzer = "keyword"
+)
+
+type TokenFilter struct {
+	Name   string
+	Filter func([]Token) []Token
+}
+
+// turns a text into the tokens stored in or looked up from the index
+type Analyzer struct {
+	Name      string
+	Tokenizer func(string) []Token
+	Filters   []TokenFilter
+}
+
+// tokens produced by one step of the analyzer
+type AnalysisStage struct {
+	Name   string  `json:"name"`
+	Tokens []Token `json:"tokens"`
+}
+
+var (
+	normaliseTokenFilter = TokenFilter{Name: "normalise", Filter: func(tokens []Token) []Token {
+		return mapTerms(tokens, NormaliseFilter)
+	}}
+	stopWordsTokenFilter = TokenFilter{Name: "stopwords", Filter: removeStopWords}
+	stemmingTokenFilter  = TokenFilter{Name: "stemming", Filter: func(tokens []Token) []Token {
+		return mapTerms(tokens, StemmingFilter)
+	}}
+)
+
+var analyzers = map[string]*Analyzer{
+	StandardAnalyzer: {
+		Name:      StandardAnalyzer,
+		Tokenizer: TokenizeWithOffsets,
+		Filters:   []TokenFilter{normaliseTokenFilter, stopWordsTokenFilter, stemmingTokenFilter},
+	},
+	SimpleAnalyzer: {
+		Name:      SimpleAnalyzer,
+		Tokenizer: TokenizeWithOffsets,
+		Filters:   []TokenFilter{normaliseTokenFilter},
+	},
+	KeywordAnalyzer: {
+		Name:      KeywordAnalyzer,
+		Tokenizer: keywordTokenize,
+		Filters:   []TokenFilter{normaliseTokenFilter},
+	},
+}
+
+func GetAnalyzer(name string) (*Analyzer, error) {
+	if name == "" {
+		name = StandardAnalyzer
+	}
+	analyzer, ok := analyzers[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown analyzer: %s, possible values are %v", name, AnalyzerNames())
+	}
+	return analyzer, nil
+}
+
+func AnalyzerNames() []string {
+	names := make([]string, 0, len(analyzers))
+	for name := range analyzers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// runs the text through the tokenizer and every filter, returns the tokens after each step
+func (a *Analyzer) Stages(text string) []AnalysisStage {
+	tokens := a.Tokenizer(text)
+	stages := []AnalysisStage{{Name: "tokenize", Tokens: tokens}}
+
+	for _, f := range a.Filters {
+		tokens = f.Filter(tokens)
+		stages = append(stages, AnalysisStage{Name: f.Name, Tokens: tokens})
+	}
+	return stages
+}
+
+func (a *Analyzer) Analyze(text string) []Token {
+	tokens := a.Tokenizer(text)
+	for _, f := range a.Filters {
+		tokens = f.Filter(tokens)
+	}
+	return tokens
+}
+
+func (a *Analyzer) terms(text string) []string {
+	tokens := a.Analyze(text)
+	terms := make([]string, len(tokens))
+	for i, token := range tokens {
+		terms[i] = token.Term
+	}
+	return terms
+}
+
+// applies a filter which maps every term to exactly one new term, the positions and offsets are kept
+func mapTerms(tokens []Token, filter func([]string) []string) []Token {
+	terms := make([]string, len(tokens))
+	for i, token := range tokens {
+		terms[i] = token.Term
+	}
+
+	mapped := make([]Token, len(tokens))
+	for i, term := range filter(terms) {
+		mapped[i] = tokens[i]
+		mapped[i].Term = term
+	}
+	return mapped
+}
+
+// drops the stopwords, the remaining tokens keep their original positions
+func removeStopWords(tokens []Token) []Token {
+	stopWordsMap := getStopWords()
+	kept := make([]Token, 0, len(tokens))
+
+	for _, token := range tokens {
+		if _, ok := stopWordsMap[token.Term]; !ok {
+			kept = append(kept, token)
+		}
+	}
+	return kept
+}
+
+func keywordTokenize(text string) []Token {
+	if text == "" {
+		return []Token{}
+	}
+	return []Token{{Term: text, Position: 0, StartOffset: 0, EndOffset: len(text)}}
+}
@@ -1,76 +1,84 @@
 package inmemsearch
 
 import (
-	"encoding/json"
+	"fmt"
 	"io"
-	"log"
-	"os"
+	"strings"
 	"textscout/common"
+	"textscout/internal/dataset"
 )
 
 type Document struct {
-	ID            int
-	Adult         bool
-	BackdropPath  string
-	GenreIDs      []int32
-	MovieID       int32
-	Language      string
-	OriginalTitle string
-	Overview      string
-	Popularity    float64
-	PosterPath    string
-	ReleaseDate   string
-	MovieTitle    string
-	Video         bool
-	VoteAverage   float64
-	VoteCount     int64
+	ID int
+	// values of the schema fields, normalised by common.Schema.Normalise
+	Fields map[string]interface{}
 }
 
-func loadMovies(filePath string) ([]Document, error) {
-	fd, err := os.Open(filePath)
-	if err != nil {
-		log.Fatal("failed to open the file", err)
-		return []Document{}, err
+// streams the documents of the dataset and hands them over in batches, so only
+// the normalised fields of the documents are kept in memory rather than the whole file
+func loadDocuments(reader dataset.Reader, schema *common.Schema, batchSize int, add func([]Document)) error {
+	batch := make([]Document, 0, batchSize)
+	for id := 0; ; id++ {
+		var raw map[string]interface{}
+		err := reader.Next(&raw)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("document at position %d: %w", id, err)
+		}
+
+		doc, err := newDocument(id, raw, schema)
+		if err != nil {
+			return err
+		}
+		batch = append(batch, doc)
+		if len(batch) == batchSize {
+			add(batch)
+			batch = make([]Document, 0, batchSize)
+		}
+	}
+	if len(batch) != 0 {
+		add(batch)
 	}
-	defer fd.Close()
+	return nil
+}
 
-	// start reading the json file in-memory
-	jsonBytes, err := io.ReadAll(fd)
-	if err != nil {
-		log.Fatal("failed to read the file", err)
-		return []Document{}, err
+func marshalToDocs(raw []map[string]interface{}, schema *common.Schema) ([]Document, error) {
+	docs := make([]Document, 0, len(raw))
+
+	for idx, r := range raw {
+		doc, err := newDocument(idx, r, schema)
+		if err != nil {
+			return nil, err
+		}
+		docs = append(docs, doc)
 	}
+	return docs, nil
+}
 
-	var results common.Results
-	err = json.Unmarshal(jsonBytes, &results)
+func newDocument(id int, raw map[string]interface{}, schema *common.Schema) (Document, error) {
+	fields, err := schema.Normalise(raw)
 	if err != nil {
-		log.Fatal("failed to unmarshal the json", err)
+		return Document{}, fmt.Errorf("document at position %d: %w", id, err)
 	}
-	return marshalToDocs(results.Results), nil
+	return Document{
+		ID:     id,
+		Fields: fields,
+	}, nil
 }
 
-func marshalToDocs(movieData []common.MovieData) []Document {
-	docs := make([]Document, 0)
-
-	for idx, md := range movieData {
-		d := Document{
-			ID:            idx,
-			Adult:         md.Adult,
-			BackdropPath:  md.BackdropPath,
-			GenreIDs:      md.GenreIDs,
-			MovieID:       md.ID,
-			Language:      md.Language,
-			OriginalTitle: md.OriginalTitle,
-			Overview:      md.Overview,
-			Popularity:    md.Popularity,
-			PosterPath:    md.PosterPath,
-			ReleaseDate:   md.ReleaseDate,
-			MovieTitle:    md.MovieTitle,
-			Video:         md.Video,
-			VoteAverage:   md.VoteAverage,
-			VoteCount:     md.VoteCount,
+// the text of the field, array values are joined with spaces
+func (d Document) text(name string) string {
+	switch v := d.Fields[name].(type) {
+	case string:
+		return v
+	case []interface{}:
+		parts := make([]string, 0, len(v))
+		for _, item := range v {
+			parts = append(parts, common.FormatValue(item))
 		}
-		docs = append(docs, d)
+		return strings.Join(parts, " ")
 	}
-	return docs
+	return ""
 }
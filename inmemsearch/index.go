@@ -1,71 +1,147 @@
 package inmemsearch
 
 import (
-	"textscout/common"
+	"context"
+	"sort"
 )
 
-// choosen values for bitmap array lengths
-// generally this length depends on the max movie_id currently present since
-// that is how we are calculating its index in the array then its bitmap value
-const MAX_BIT_LEN int = 31
-const MAX_BITMAP_LEN int = 22581
-
 // inverted index to map each word to all the document IDs it occurs in
 type IndexMap struct {
 	DocFreq     int
 	PostingList []int
+	// how many times the word occurs in each field of the doc, aligned with the PostingList
+	FieldFreqs []map[string]int
 }
 type Index map[string]*IndexMap
 
-func (idx Index) Add(docs []Document) {
+// an indexed field of the schema along with its resolved analyzer
+type indexedField struct {
+	name     string
+	analyzer *Analyzer
+	boost    float64
+}
+
+func (idx Index) Add(docs []Document, fields []indexedField) {
 	for _, doc := range docs {
-		for _, token := range analyze(common.ConcatStrings(doc.MovieTitle, doc.Overview)) {
-			indexMap, ok := idx[token]
-			if !ok {
-				// init Index for each new token
-				idx[token] = &IndexMap{
-					DocFreq:     1,
-					PostingList: []int{doc.ID},
+		for _, f := range fields {
+			for _, token := range f.analyzer.terms(doc.text(f.name)) {
+				indexMap, ok := idx[token]
+				if !ok {
+					// init Index for each new token
+					idx[token] = &IndexMap{
+						DocFreq:     1,
+						PostingList: []int{doc.ID},
+						FieldFreqs:  []map[string]int{{f.name: 1}},
+					}
+					continue
 				}
-				continue
-			}
 
-			// avoids adding the same ID twice if the word is repeated more than once in the same sentence.
-			curIds := indexMap.PostingList
-			if len(curIds) != 0 && curIds[len(curIds)-1] == doc.ID {
-				// increment frequency
+				// avoids adding the same ID twice if the word is repeated more than once in the same sentence.
+				curIds := indexMap.PostingList
+				if len(curIds) != 0 && curIds[len(curIds)-1] == doc.ID {
+					// increment frequency
+					indexMap.DocFreq++
+					indexMap.FieldFreqs[len(curIds)-1][f.name]++
+					continue
+				}
+
+				// add the new docID and increment the frequency
+				indexMap.PostingList = append(curIds, doc.ID)
+				indexMap.FieldFreqs = append(indexMap.FieldFreqs, map[string]int{f.name: 1})
 				indexMap.DocFreq++
-				continue
 			}
+		}
+	}
 
-			// add the new docID and increment the frequency
-			indexMap.PostingList = append(curIds, doc.ID)
-			indexMap.DocFreq++
+}
+
+// returns the number of tokens in each field of every doc, indexed by the doc ID.
+// used by the scorer to normalise the term frequency by the field length.
+func (idx Index) fieldLengths(numDocs int) []map[string]int {
+	lengths := make([]map[string]int, numDocs)
+	for i := range lengths {
+		lengths[i] = make(map[string]int)
+	}
+
+	for _, indexMap := range idx {
+		for i, docID := range indexMap.PostingList {
+			for name, freq := range indexMap.FieldFreqs[i] {
+				lengths[docID][name] += freq
+			}
 		}
 	}
+	return lengths
+}
+
+// returns how many times the token occurs in each field of the doc
+func (idx Index) termFreqs(token string, docID int) map[string]int {
+	indexMap, ok := idx[token]
+	if !ok {
+		return nil
+	}
 
+	// posting lists are sorted by the doc ID since docs are added in order
+	i := sort.SearchInts(indexMap.PostingList, docID)
+	if i == len(indexMap.PostingList) || indexMap.PostingList[i] != docID {
+		return nil
+	}
+	return indexMap.FieldFreqs[i]
+}
+
+func (idx Index) SearchIntersection(clauses []clause) []int {
+	docIDs, _ := idx.match(context.Background(), clauses, false)
+	return docIDs
 }
 
-func (idx Index) SearchIntersection(query string) []int {
+// docIDs matching all the clauses, or any of them when union is set. the context is checked
+// between the clauses, a partial match isn't returned since it could miss clauses.
+func (idx Index) match(ctx context.Context, clauses []clause, union bool) ([]int, error) {
 	docIDs := make([]int, 0)
 
-	for _, token := range analyze(query) {
-		// get the docIDs list from inverted index for each token
+	for _, c := range clauses {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		// get the docIDs list from inverted index for each clause
 		// find the common IDs from all such list
-		indexMap, ok := idx[token]
+		postingList, ok := idx.clausePostingList(c)
 		if !ok {
 			// token doesn't exist, do we just return or return the found docIDs
 			continue
 		}
 		if len(docIDs) == 0 {
 			// init
-			docIDs = indexMap.PostingList
+			docIDs = postingList
 			continue
 		}
-		docIDs = idx.intersection(docIDs, indexMap.PostingList)
+		if union {
+			docIDs = idx.union(docIDs, postingList)
+		} else {
+			docIDs = idx.intersection(docIDs, postingList)
+		}
 	}
 
-	return docIDs
+	return docIDs, nil
+}
+
+// docIDs matching any of the tokens of the clause, false if none of them are in the index
+func (idx Index) clausePostingList(c clause) ([]int, bool) {
+	docIDs := make([]int, 0)
+	found := false
+
+	for _, token := range c {
+		indexMap, ok := idx[token]
+		if !ok {
+			continue
+		}
+		if !found {
+			docIDs = indexMap.PostingList
+			found = true
+			continue
+		}
+		docIDs = idx.union(docIDs, indexMap.PostingList)
+	}
+	return docIDs, found
 }
 
 func (idx Index) WordFreq(word string) int {
@@ -78,87 +154,50 @@ func (idx Index) WordFreq(word string) int {
 }
 
 // a=[0, 4] intersection b=[0,1] -> c=[0]
+// both posting lists are sorted by the doc ID, so they are merged in a single pass
 func (idx Index) intersection(seta, setb []int) []int {
-	intersection := make([]int, 0)
-	bitmap := make([]int, MAX_BITMAP_LEN)
-
-	// compute the bitmap first
-	for _, item := range seta {
-		// index to know where should we put the integer
-		// mask to calculate the actual mask
-		// example : https://go.dev/play/p/Wv-9Wxn-4Lj
-		index, mask := divmod(item, MAX_BIT_LEN)
-		bitMask := int(1 << mask)
-		bitmap[index] |= bitMask
-	}
-
-	// calculate the intersection
-	for _, item := range setb {
-		index, mask := divmod(item, MAX_BIT_LEN)
-		source := int(1 << mask)
-		target := bitmap[index]
-
-		if source&target != 0 {
-			intersection = append(intersection, item)
+	intersection := make([]int, 0, min(len(seta), len(setb)))
+	i, j := 0, 0
+	for i < len(seta) && j < len(setb) {
+		switch {
+		case seta[i] < setb[j]:
+			i++
+		case seta[i] > setb[j]:
+			j++
+		default:
+			intersection = append(intersection, seta[i])
+			i++
+			j++
 		}
 	}
-
 	return intersection
-
 }
 
-func (idx Index) SearchUnion(query string) []int {
-	docIDs := make([]int, 0)
-
-	for _, token := range analyze(query) {
-		// get the docIDs list from inverted index for each token
-		// find the common IDs from all such list
-		indexMap, ok := idx[token]
-		if !ok {
-			// token doesn't exist, do we just return or return the found docIDs
-			continue
-		}
-		if len(docIDs) == 0 {
-			// init
-			docIDs = indexMap.PostingList
-			continue
-		}
-		docIDs = idx.union(docIDs, indexMap.PostingList)
-	}
-
+func (idx Index) SearchUnion(clauses []clause) []int {
+	docIDs, _ := idx.match(context.Background(), clauses, true)
 	return docIDs
 }
 
 // a=[0, 4] union b=[0,1] -> c=[0, 1, 4]
+// sorted like the posting lists it merges
 func (idx Index) union(seta, setb []int) []int {
-	union := make([]int, 0)
-	bitmap := make([]int, MAX_BITMAP_LEN)
-
-	// compute the bitmap first
-	for _, item := range seta {
-		index, mask := divmod(item, MAX_BIT_LEN)
-		bitMask := int(1 << mask)
-		bitmap[index] |= bitMask
-		union = append(union, item)
-	}
-
-	// calculate the union
-	for _, item := range setb {
-		index, mask := divmod(item, MAX_BIT_LEN)
-		source := int(1 << mask)
-		target := bitmap[index]
-
-		// dont add the same id twice
-		if source&target == 0 {
-			union = append(union, item)
+	union := make([]int, 0, len(seta)+len(setb))
+	i, j := 0, 0
+	for i < len(seta) && j < len(setb) {
+		switch {
+		case seta[i] < setb[j]:
+			union = append(union, seta[i])
+			i++
+		case seta[i] > setb[j]:
+			union = append(union, setb[j])
+			j++
+		default:
+			// dont add the same id twice
+			union = append(union, seta[i])
+			i++
+			j++
 		}
 	}
-
-	return union
-}
-
-func divmod(numerator, denominator int) (quotient, remainder int) {
-	quotient = numerator / denominator
-	remainder = numerator % denominator
-	return
+	union = append(union, seta[i:]...)
+	return append(union, setb[j:]...)
 }
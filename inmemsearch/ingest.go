@@ -0,0 +1,154 @@
+package inmemsearch
+
+import (
+	"errors"
+	"sort"
+)
+
+var ErrDocumentExists = errors.New("document already exists")
+
+// AddDocument validates the raw document against the schema and indexes it,
+// ErrDocumentExists if a document with the same id is already indexed.
+// The raw document should be decoded with json.Decoder.UseNumber like the dataset.
+func (im *InMemSearch) AddDocument(raw map[string]interface{}) (string, error) {
+	fields, err := im.schema.Normalise(raw)
+	if err != nil {
+		return "", err
+	}
+	id := im.schema.DocumentID(fields)
+
+	im.mu.Lock()
+	defer im.mu.Unlock()
+	if _, ok := im.docIDs[id]; ok {
+		return id, ErrDocumentExists
+	}
+	im.insert(id, fields)
+	return id, nil
+}
+
+// UpsertDocument indexes the document or replaces the one with the same id,
+// true when it was created
+func (im *InMemSearch) UpsertDocument(raw map[string]interface{}) (string, bool, error) {
+	fields, err := im.schema.Normalise(raw)
+	if err != nil {
+		return "", false, err
+	}
+	id := im.schema.DocumentID(fields)
+
+	im.mu.Lock()
+	defer im.mu.Unlock()
+	docID, ok := im.docIDs[id]
+	if !ok {
+		im.insert(id, fields)
+		return id, true, nil
+	}
+
+	// the new version keeps the doc ID, so the doc IDs don't grow with every update
+	im.idx.removeDoc(im.docs[docID], im.fields)
+	doc := Document{ID: docID, Fields: fields}
+	im.docs[docID] = doc
+	im.scorer.fieldLens[docID] = im.idx.addDoc(doc, im.fields)
+	return id, false, nil
+}
+
+// DeleteDocument drops the document from the index, ErrDocumentNotFound if there is no such id
+func (im *InMemSearch) DeleteDocument(id string) error {
+	im.mu.Lock()
+	defer im.mu.Unlock()
+	docID, ok := im.docIDs[id]
+	if !ok {
+		return ErrDocumentNotFound
+	}
+
+	im.idx.removeDoc(im.docs[docID], im.fields)
+	im.docs[docID] = Document{ID: docID}
+	im.scorer.fieldLens[docID] = nil
+	im.scorer.numDocs--
+	delete(im.docIDs, id)
+	im.free = append(im.free, docID)
+	return nil
+}
+
+// takes the doc ID of a deleted doc when there is one, addDoc keeps the posting lists sorted.
+// must be called with the write lock held
+func (im *InMemSearch) insert(id string, fields map[string]interface{}) {
+	if n := len(im.free); n > 0 {
+		doc := Document{ID: im.free[n-1], Fields: fields}
+		im.free = im.free[:n-1]
+		im.docs[doc.ID] = doc
+		im.scorer.fieldLens[doc.ID] = im.idx.addDoc(doc, im.fields)
+		im.scorer.numDocs++
+		im.docIDs[id] = doc.ID
+		return
+	}
+
+	doc := Document{ID: len(im.docs), Fields: fields}
+	im.docs = append(im.docs, doc)
+	im.scorer.fieldLens = append(im.scorer.fieldLens, im.idx.addDoc(doc, im.fields))
+	im.scorer.numDocs++
+	im.docIDs[id] = doc.ID
+}
+
+// indexes a single doc, unlike Add its ID doesn't have to be the highest one.
+// returns the number of tokens in each of its fields.
+func (idx Index) addDoc(doc Document, fields []indexedField) map[string]int {
+	lengths := make(map[string]int)
+	freqs := make(map[string]map[string]int)
+	for _, f := range fields {
+		for _, token := range f.analyzer.terms(doc.text(f.name)) {
+			if freqs[token] == nil {
+				freqs[token] = make(map[string]int)
+			}
+			freqs[token][f.name]++
+			lengths[f.name]++
+		}
+	}
+
+	for token, fieldFreqs := range freqs {
+		indexMap, ok := idx[token]
+		if !ok {
+			indexMap = &IndexMap{}
+			idx[token] = indexMap
+		}
+
+		// keep the posting list sorted by the doc ID
+		i := sort.SearchInts(indexMap.PostingList, doc.ID)
+		indexMap.PostingList = append(indexMap.PostingList, 0)
+		copy(indexMap.PostingList[i+1:], indexMap.PostingList[i:])
+		indexMap.PostingList[i] = doc.ID
+		indexMap.FieldFreqs = append(indexMap.FieldFreqs, nil)
+		copy(indexMap.FieldFreqs[i+1:], indexMap.FieldFreqs[i:])
+		indexMap.FieldFreqs[i] = fieldFreqs
+
+		for _, freq := range fieldFreqs {
+			indexMap.DocFreq += freq
+		}
+	}
+	return lengths
+}
+
+// drops the doc from the posting lists of its tokens, tokens no doc has anymore are removed
+func (idx Index) removeDoc(doc Document, fields []indexedField) {
+	for _, f := range fields {
+		for _, token := range f.analyzer.terms(doc.text(f.name)) {
+			indexMap, ok := idx[token]
+			if !ok {
+				continue
+			}
+			i := sort.SearchInts(indexMap.PostingList, doc.ID)
+			if i == len(indexMap.PostingList) || indexMap.PostingList[i] != doc.ID {
+				// already removed while going through a repeated token
+				continue
+			}
+
+			for _, freq := range indexMap.FieldFreqs[i] {
+				indexMap.DocFreq -= freq
+			}
+			indexMap.PostingList = append(indexMap.PostingList[:i], indexMap.PostingList[i+1:]...)
+			indexMap.FieldFreqs = append(indexMap.FieldFreqs[:i], indexMap.FieldFreqs[i+1:]...)
+			if len(indexMap.PostingList) == 0 {
+				delete(idx, token)
+			}
+		}
+	}
+}
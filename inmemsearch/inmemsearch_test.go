@@ -1,13 +1,19 @@
 package inmemsearch
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
 	"testing"
 	"textscout/common"
 )
 
 func TestTextSearchANDOperation(t *testing.T) {
-	filePath := "/Users/rushiyadwade/Documents/go_dir/source/textscout/sample.json"
-	inMemIdx := GetInMemSearch(filePath)
+	filePath := "testdata/sample.json"
+	inMemIdx := GetInMemSearch(filePath, common.DefaultMovieSchema())
 	title := "Kong"
 	desc := "Godzilla"
 
@@ -20,8 +26,8 @@ func TestTextSearchANDOperation(t *testing.T) {
 }
 
 func TestTextSearchOROperation(t *testing.T) {
-	filePath := "/Users/rushiyadwade/Documents/go_dir/source/textscout/sample.json"
-	inMemIdx := GetInMemSearch(filePath)
+	filePath := "testdata/sample.json"
+	inMemIdx := GetInMemSearch(filePath, common.DefaultMovieSchema())
 	title := "Kong"
 	desc := "Godzilla"
 
@@ -32,3 +38,383 @@ func TestTextSearchOROperation(t *testing.T) {
 	}
 
 }
+
+func TestTextSearchRankedByScore(t *testing.T) {
+	filePath := "testdata/sample.json"
+	inMemIdx := GetInMemSearch(filePath, common.DefaultMovieSchema())
+
+	// Godzilla x Kong matches both words, so it must come first
+	matchedDocs := inMemIdx.Union(common.ConcatStrings("Kong", "Godzilla"))
+	expectedMovieID := int64(823464)
+	if len(matchedDocs) == 0 || matchedDocs[0].Fields["id"] != expectedMovieID {
+		t.Fatalf("expected first movie: %d, got: %+v", expectedMovieID, matchedDocs)
+	}
+
+}
+
+func TestTextSearchExplain(t *testing.T) {
+	filePath := "testdata/sample.json"
+	inMemIdx := GetInMemSearch(filePath, common.DefaultMovieSchema())
+
+	hits, analysis, err := inMemIdx.Search(SearchRequest{Query: common.ConcatStrings("Kong", "Godzilla"), Union: true, Explain: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// title and overview both use the standard analyzer
+	if len(analysis.Analyzers) != 1 {
+		t.Fatalf("expected a single analyzer, got: %+v", analysis.Analyzers)
+	}
+	expectedTokens := []string{"kong", "godzilla"}
+	tokens := analysis.Analyzers[0].Tokens
+	if len(tokens) != len(expectedTokens) {
+		t.Fatalf("expected tokens: %v, got: %v", expectedTokens, tokens)
+	}
+	for i, token := range expectedTokens {
+		if tokens[i] != token {
+			t.Errorf("expected token: %s, got: %s", token, tokens[i])
+		}
+	}
+
+	for _, hit := range hits {
+		if hit.Explanation == nil {
+			t.Fatalf("missing explanation for movie: %v", hit.Document.Fields["id"])
+		}
+		if hit.Explanation.Value != hit.Score {
+			t.Errorf("explanation value: %f doesn't match the score: %f", hit.Explanation.Value, hit.Score)
+		}
+
+		sum := 0.0
+		for _, detail := range hit.Explanation.Details {
+			sum += detail.Value
+		}
+		if math.Abs(sum-hit.Score) > 1e-9 {
+			t.Errorf("sum of the clauses: %f doesn't match the score: %f", sum, hit.Score)
+		}
+	}
+
+}
+
+func TestAnalyzerStages(t *testing.T) {
+	analyzer, err := GetAnalyzer(StandardAnalyzer)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	text := "The Kings of the Apes"
+	stages := analyzer.Stages(text)
+	expectedStages := []string{"tokenize", "normalise", "stopwords", "stemming"}
+	if len(stages) != len(expectedStages) {
+		t.Fatalf("expected stages: %v, got: %+v", expectedStages, stages)
+	}
+
+	final := stages[len(stages)-1].Tokens
+	expected := []Token{
+		{Term: "king", Position: 1, StartOffset: 4, EndOffset: 9},
+		{Term: "ape", Position: 4, StartOffset: 17, EndOffset: 21},
+	}
+	expectedSource := []string{"Kings", "Apes"}
+	if len(final) != len(expected) {
+		t.Fatalf("expected tokens: %+v, got: %+v", expected, final)
+	}
+	for i, token := range expected {
+		if final[i] != token {
+			t.Errorf("expected token: %+v, got: %+v", token, final[i])
+		}
+		if source := text[final[i].StartOffset:final[i].EndOffset]; source != expectedSource[i] {
+			t.Errorf("expected offsets to point at: %s, got: %s", expectedSource[i], source)
+		}
+	}
+
+	if _, err := GetAnalyzer("unknown"); err == nil {
+		t.Errorf("expected an error for an unknown analyzer")
+	}
+
+}
+
+func TestMoreLikeThis(t *testing.T) {
+	filePath := "testdata/sample.json"
+	inMemIdx := GetInMemSearch(filePath, common.DefaultMovieSchema())
+
+	// Godzilla x Kong shares its title words with Godzilla Minus One and Kong: Skull Island
+	sourceMovieID := int64(823464)
+	similarDocs, err := inMemIdx.MoreLikeThis("823464", DefaultMoreLikeThisOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	found := make(map[interface{}]bool)
+	for _, doc := range similarDocs {
+		if doc.Fields["id"] == sourceMovieID {
+			t.Errorf("source movie: %d must not be similar to itself", sourceMovieID)
+		}
+		found[doc.Fields["id"]] = true
+	}
+	for _, expectedMovieID := range []int64{940721, 293167} {
+		if !found[expectedMovieID] {
+			t.Errorf("expected movie: %d in the similar movies, got: %+v", expectedMovieID, similarDocs)
+		}
+	}
+
+	if _, err := inMemIdx.MoreLikeThis("-1", DefaultMoreLikeThisOptions()); !errors.Is(err, ErrDocumentNotFound) {
+		t.Errorf("expected: %v, got: %v", ErrDocumentNotFound, err)
+	}
+
+}
+
+func TestTextSearchFilterAndSort(t *testing.T) {
+	filePath := "testdata/sample.json"
+	inMemIdx := GetInMemSearch(filePath, common.DefaultMovieSchema())
+
+	// Godzilla Minus One is the only japanese movie
+	hits, _, err := inMemIdx.Search(SearchRequest{
+		Query:   common.ConcatStrings("Kong", "Godzilla"),
+		Union:   true,
+		Filters: map[string]string{"original_language": "ja"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(hits) != 1 || hits[0].Document.Fields["id"] != int64(940721) {
+		t.Errorf("expected only movie: 940721, got: %+v", hits)
+	}
+
+	hits, _, err = inMemIdx.Search(SearchRequest{
+		Query: common.ConcatStrings("Kong", "Godzilla"),
+		Union: true,
+		Sort:  "-vote_count",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectedOrder := []int64{293167, 823464, 940721}
+	if len(hits) != len(expectedOrder) {
+		t.Fatalf("expected movies: %v, got: %+v", expectedOrder, hits)
+	}
+	for i, id := range expectedOrder {
+		if hits[i].Document.Fields["id"] != id {
+			t.Errorf("expected movie: %d at position: %d, got: %v", id, i, hits[i].Document.Fields["id"])
+		}
+	}
+
+	if _, _, err := inMemIdx.Search(SearchRequest{Query: "kong", Sort: "overview"}); err == nil {
+		t.Errorf("expected an error sorting by a field which isn't sortable")
+	}
+	if _, _, err := inMemIdx.Search(SearchRequest{Query: "kong", Filters: map[string]string{"popularity": "1"}}); err == nil {
+		t.Errorf("expected an error filtering by a field which isn't filterable")
+	}
+
+}
+
+func TestCustomSchema(t *testing.T) {
+	schema, err := common.ParseSchema([]byte(`{
+		"name": "books",
+		"id_field": "isbn",
+		"fields": [
+			{"name": "isbn", "type": "keyword", "stored": true},
+			{"name": "name", "type": "text", "indexed": true, "stored": true, "analyzer": "simple"},
+			{"name": "pages", "type": "integer", "stored": true, "sortable": true}
+		]
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	docs, err := marshalToDocs([]map[string]interface{}{
+		{"isbn": "978-0", "name": "The Running Man", "pages": json.Number("219")},
+		{"isbn": "978-1", "name": "Running Blind", "pages": json.Number("350")},
+	}, schema)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fields, err := resolveFields(schema)
+	if err != nil {
+		t.Fatal(err)
+	}
+	index := make(Index)
+	index.Add(docs, fields)
+
+	// the simple analyzer neither stems nor drops stopwords
+	if index.WordFreq("running") != 2 || index.WordFreq("the") != 1 || index.WordFreq("run") != 0 {
+		t.Errorf("expected the unstemmed tokens in the index, got: %+v", index)
+	}
+
+	if _, err := marshalToDocs([]map[string]interface{}{{"isbn": "978-2", "pages": "many"}}, schema); err == nil {
+		t.Errorf("expected an error for a value not matching the field type")
+	}
+
+}
+
+func TestDocumentWrites(t *testing.T) {
+	inMemIdx := GetInMemSearch("testdata/sample.json", common.DefaultMovieSchema())
+	docCount := inMemIdx.DocCount()
+
+	id, err := inMemIdx.AddDocument(map[string]interface{}{"id": json.Number("1"), "title": "Mothra", "overview": "A giant moth meets Godzilla."})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := inMemIdx.AddDocument(map[string]interface{}{"id": id, "title": "Mothra"}); !errors.Is(err, ErrDocumentExists) {
+		t.Errorf("expected: %v, got: %v", ErrDocumentExists, err)
+	}
+	if _, err := inMemIdx.AddDocument(map[string]interface{}{"title": "Rodan"}); err == nil {
+		t.Errorf("expected an error for a document without an id")
+	}
+	if len(inMemIdx.Intersection("mothra")) != 1 || inMemIdx.DocCount() != docCount+1 {
+		t.Errorf("expected the added document to be searchable")
+	}
+
+	// the replaced document is searched by its new text only
+	_, created, err := inMemIdx.UpsertDocument(map[string]interface{}{"id": "1", "title": "Rodan", "overview": "A giant pteranodon."})
+	if err != nil || created {
+		t.Fatalf("expected the document to be updated, got created: %t err: %v", created, err)
+	}
+	if len(inMemIdx.Intersection("mothra")) != 0 || len(inMemIdx.Intersection("rodan")) != 1 {
+		t.Errorf("expected the updated document to replace the old one")
+	}
+	if len(inMemIdx.Intersection("godzilla")) != 2 {
+		t.Errorf("expected 2 godzilla movies, got: %d", len(inMemIdx.Intersection("godzilla")))
+	}
+
+	if err := inMemIdx.DeleteDocument("823464"); err != nil {
+		t.Fatal(err)
+	}
+	if err := inMemIdx.DeleteDocument("823464"); !errors.Is(err, ErrDocumentNotFound) {
+		t.Errorf("expected: %v, got: %v", ErrDocumentNotFound, err)
+	}
+	if docs := inMemIdx.Intersection("godzilla"); len(docs) != 1 || docs[0].Fields["id"] != int64(940721) {
+		t.Errorf("expected only godzilla minus one, got: %+v", docs)
+	}
+	if inMemIdx.DocCount() != docCount {
+		t.Errorf("expected doc count: %d, got: %d", docCount, inMemIdx.DocCount())
+	}
+
+	// the docs added after deletes take the doc IDs of the deleted ones
+	size := len(inMemIdx.docs)
+	for i := 0; i < 1000; i++ {
+		id := fmt.Sprint(1_000_000 + i)
+		if _, err := inMemIdx.AddDocument(map[string]interface{}{"id": json.Number(id), "title": fmt.Sprintf("Gamera %d", i)}); err != nil {
+			t.Fatal(err)
+		}
+		if err := inMemIdx.DeleteDocument(id); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(inMemIdx.docs) != size || len(inMemIdx.scorer.fieldLens) != size {
+		t.Errorf("expected %d docs after the churn, got: %d", size, len(inMemIdx.docs))
+	}
+	if _, err := inMemIdx.AddDocument(map[string]interface{}{"id": json.Number("823464"), "title": "Godzilla x Kong"}); err != nil {
+		t.Fatal(err)
+	}
+	if docs := inMemIdx.Intersection("godzilla"); len(docs) != 2 || len(inMemIdx.Intersection("gamera")) != 0 {
+		t.Errorf("expected the re-added godzilla movie in a reused slot, got: %+v", docs)
+	}
+	for _, indexMap := range inMemIdx.idx {
+		if !sort.IntsAreSorted(indexMap.PostingList) {
+			t.Fatalf("expected the posting lists to stay sorted, got: %v", indexMap.PostingList)
+		}
+	}
+}
+
+// done once its Err was checked n times, to stop a search part way
+type countdownContext struct {
+	context.Context
+	n int
+}
+
+func (c *countdownContext) Err() error {
+	c.n--
+	if c.n < 0 {
+		return context.DeadlineExceeded
+	}
+	return nil
+}
+
+func TestSearchContext(t *testing.T) {
+	inMemIdx := GetInMemSearch("testdata/sample.json", common.DefaultMovieSchema())
+	for i := 0; i < 3*cancelCheckInterval; i++ {
+		if _, err := inMemIdx.AddDocument(map[string]interface{}{"id": json.Number(fmt.Sprint(i + 1)), "title": fmt.Sprintf("Kaiju %d", i)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	hits, _, err := inMemIdx.SearchContext(context.Background(), SearchRequest{Query: "kaiju"})
+	if err != nil || len(hits) != 3*cancelCheckInterval {
+		t.Fatalf("expected %d hits, got: %d %v", 3*cancelCheckInterval, len(hits), err)
+	}
+
+	// done before the docs matching the query are known
+	hits, _, err = inMemIdx.SearchContext(&countdownContext{Context: context.Background()}, SearchRequest{Query: "kaiju"})
+	if !errors.Is(err, context.DeadlineExceeded) || len(hits) != 0 {
+		t.Errorf("expected no hits and the error of the context, got: %d %v", len(hits), err)
+	}
+
+	// done while scoring, after the clause and the three checks of the filtering
+	hits, _, err = inMemIdx.SearchContext(&countdownContext{Context: context.Background(), n: 5}, SearchRequest{Query: "kaiju"})
+	if !errors.Is(err, context.DeadlineExceeded) || len(hits) != cancelCheckInterval {
+		t.Errorf("expected the %d hits scored in time, got: %d %v", cancelCheckInterval, len(hits), err)
+	}
+	for i := 1; i < len(hits); i++ {
+		if hits[i].Score > hits[i-1].Score {
+			t.Fatalf("expected the partial hits to be ranked, got: %v before %v", hits[i-1].Score, hits[i].Score)
+		}
+	}
+}
+
+func TestMoreLikeThisContext(t *testing.T) {
+	inMemIdx := GetInMemSearch("testdata/sample.json", common.DefaultMovieSchema())
+	for i := 0; i <= 3*cancelCheckInterval; i++ {
+		if _, err := inMemIdx.AddDocument(map[string]interface{}{"id": json.Number(fmt.Sprint(i + 1)), "title": fmt.Sprintf("Kaiju %d", i)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// every kaiju but the source one, without a limit
+	opts := DefaultMoreLikeThisOptions()
+	opts.Limit = 0
+
+	docs, err := inMemIdx.MoreLikeThisContext(context.Background(), "1", opts)
+	if err != nil || len(docs) != 3*cancelCheckInterval {
+		t.Fatalf("expected %d similar docs, got: %d %v", 3*cancelCheckInterval, len(docs), err)
+	}
+
+	// done before the candidates are known
+	docs, err = inMemIdx.MoreLikeThisContext(&countdownContext{Context: context.Background()}, "1", opts)
+	if !errors.Is(err, context.DeadlineExceeded) || len(docs) != 0 {
+		t.Errorf("expected no docs and the error of the context, got: %d %v", len(docs), err)
+	}
+
+	// done while scoring, after the term and the four checks of the candidates, the source included
+	docs, err = inMemIdx.MoreLikeThisContext(&countdownContext{Context: context.Background(), n: 6}, "1", opts)
+	if !errors.Is(err, context.DeadlineExceeded) || len(docs) != cancelCheckInterval {
+		t.Errorf("expected the %d docs scored in time, got: %d %v", cancelCheckInterval, len(docs), err)
+	}
+}
+
+func TestSetOperationsLargeDocIDs(t *testing.T) {
+	// doc IDs past what a fixed size bitmap would hold, as with a large dataset or many writes
+	kong := make([]int, 0)
+	skull := make([]int, 0)
+	for id := 0; id < 1_000_000; id += 3 {
+		kong = append(kong, id)
+	}
+	for id := 0; id < 1_000_000; id += 5 {
+		skull = append(skull, id)
+	}
+	idx := Index{
+		"kong":  &IndexMap{PostingList: kong},
+		"skull": &IndexMap{PostingList: skull},
+	}
+	clauses := []clause{{"kong"}, {"skull"}}
+
+	both := idx.SearchIntersection(clauses)
+	if len(both) != 1_000_000/15+1 || both[len(both)-1] != 999_990 {
+		t.Errorf("expected every 15th doc ID, got: %d ending with %d", len(both), both[len(both)-1])
+	}
+	either := idx.SearchUnion(clauses)
+	if expected := len(kong) + len(skull) - len(both); len(either) != expected {
+		t.Errorf("expected %d doc IDs, got: %d", expected, len(either))
+	}
+	for i := 1; i < len(either); i++ {
+		if either[i] <= either[i-1] {
+			t.Fatalf("expected the union sorted without duplicates, got: %d after %d", either[i], either[i-1])
+		}
+	}
+}
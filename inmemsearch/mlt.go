@@ -0,0 +1,126 @@
+package inmemsearch
+
+import (
+	"context"
+	"errors"
+	"sort"
+)
+
+var ErrDocumentNotFound = errors.New("document not found")
+
+type MoreLikeThisOptions struct {
+	// how many of the most distinctive terms of the document are used to build the query
+	MaxQueryTerms int
+	// ignore terms which occur less than this many times in the document
+	MinTermFreq int
+	// ignore terms which occur in less than this many documents, a term only the
+	// source document has can't find anything similar
+	MinDocFreq int
+	// how many similar documents to return
+	Limit int
+}
+
+func DefaultMoreLikeThisOptions() MoreLikeThisOptions {
+	return MoreLikeThisOptions{
+		MaxQueryTerms: 25,
+		MinTermFreq:   1,
+		MinDocFreq:    2,
+		Limit:         10,
+	}
+}
+
+// MoreLikeThis picks the terms with the highest tf-idf from the indexed fields
+// of the document, i.e. the title and overview of a movie, and runs them as an
+// OR query weighted by their tf-idf. The document itself is excluded from the results.
+func (im *InMemSearch) MoreLikeThis(id string, opts MoreLikeThisOptions) ([]Document, error) {
+	return im.MoreLikeThisContext(context.Background(), id, opts)
+}
+
+// MoreLikeThisContext is MoreLikeThis stopping once the context is done, checked every
+// cancelCheckInterval docs like SearchContext. The error is then the one of the context,
+// with the docs ranked so far: none when it was done before the candidates were known.
+func (im *InMemSearch) MoreLikeThisContext(ctx context.Context, id string, opts MoreLikeThisOptions) ([]Document, error) {
+	im.mu.RLock()
+	defer im.mu.RUnlock()
+
+	docID, ok := im.docIDs[id]
+	if !ok {
+		return nil, ErrDocumentNotFound
+	}
+
+	terms := im.distinctiveTerms(im.docs[docID], opts)
+	if len(terms) == 0 {
+		return []Document{}, nil
+	}
+
+	docIDs := make([]int, 0)
+	for _, term := range terms {
+		if ctx.Err() != nil {
+			return []Document{}, ctx.Err()
+		}
+		postingList := im.idx[term.token].PostingList
+		if len(docIDs) == 0 {
+			docIDs = postingList
+			continue
+		}
+		docIDs = im.idx.union(docIDs, postingList)
+	}
+
+	candidates := make([]int, 0, len(docIDs))
+	for i, id := range docIDs {
+		if i%cancelCheckInterval == 0 && ctx.Err() != nil {
+			return []Document{}, ctx.Err()
+		}
+		if id != docID {
+			candidates = append(candidates, id)
+		}
+	}
+
+	hits, err := im.rankContext(ctx, candidates, terms, false)
+	if opts.Limit > 0 && len(hits) > opts.Limit {
+		hits = hits[:opts.Limit]
+	}
+	return im.hitsToDocs(hits), err
+}
+
+// returns the terms of the doc sorted by their tf-idf, boosted relative to the best term
+func (im *InMemSearch) distinctiveTerms(doc Document, opts MoreLikeThisOptions) []queryTerm {
+	termFreqs := make(map[string]int)
+	for _, f := range im.fields {
+		for _, token := range f.analyzer.terms(doc.text(f.name)) {
+			termFreqs[token]++
+		}
+	}
+
+	terms := make([]queryTerm, 0, len(termFreqs))
+	for token, freq := range termFreqs {
+		if freq < opts.MinTermFreq {
+			continue
+		}
+		idf, docFreq := im.scorer.idf(token)
+		if docFreq < opts.MinDocFreq {
+			continue
+		}
+		terms = append(terms, queryTerm{token: token, boost: float64(freq) * idf})
+	}
+
+	sort.Slice(terms, func(i, j int) bool {
+		if terms[i].boost == terms[j].boost {
+			return terms[i].token < terms[j].token
+		}
+		return terms[i].boost > terms[j].boost
+	})
+	if opts.MaxQueryTerms > 0 && len(terms) > opts.MaxQueryTerms {
+		terms = terms[:opts.MaxQueryTerms]
+	}
+
+	// the best term gets a boost of 1 and the rest relative to it
+	if len(terms) == 0 {
+		return terms
+	}
+	best := terms[0].boost
+	for i := range terms {
+		terms[i].boost /= best
+	}
+	return terms
+}
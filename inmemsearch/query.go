@@ -0,0 +1,193 @@
+package inmemsearch
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"textscout/common"
+)
+
+// tokens the query produced for the same word with the analyzers of the different
+// fields, a clause matches a doc when any of its tokens does
+type clause []string
+
+// how the query text was turned into the tokens used for matching and scoring
+type QueryAnalysis struct {
+	Text      string          `json:"text"`
+	Analyzers []AnalyzedQuery `json:"analyzers"`
+}
+
+// tokens one analyzer produced for the query, used for the listed fields
+type AnalyzedQuery struct {
+	Analyzer string   `json:"analyzer"`
+	Fields   []string `json:"fields"`
+	Tokens   []string `json:"tokens"`
+}
+
+// runs the query through the analyzer of every indexed field. tokens coming from
+// the same span of the query end up in the same clause.
+func (im *InMemSearch) analyzeQuery(query string) ([]clause, []queryTerm, QueryAnalysis) {
+	analysis := QueryAnalysis{Text: query, Analyzers: []AnalyzedQuery{}}
+	byAnalyzer := make(map[string]int)
+
+	type span struct{ start, end int }
+	spans := make([]span, 0)
+	spanTokens := make(map[span][]string)
+	seen := make(map[string]struct{})
+	terms := make([]queryTerm, 0)
+
+	for _, f := range im.fields {
+		if i, ok := byAnalyzer[f.analyzer.Name]; ok {
+			analysis.Analyzers[i].Fields = append(analysis.Analyzers[i].Fields, f.name)
+			continue
+		}
+
+		tokens := f.analyzer.Analyze(query)
+		analyzed := AnalyzedQuery{Analyzer: f.analyzer.Name, Fields: []string{f.name}, Tokens: make([]string, 0, len(tokens))}
+		for _, token := range tokens {
+			analyzed.Tokens = append(analyzed.Tokens, token.Term)
+
+			sp := span{token.StartOffset, token.EndOffset}
+			if _, ok := spanTokens[sp]; !ok {
+				spans = append(spans, sp)
+			}
+			if !containsString(spanTokens[sp], token.Term) {
+				spanTokens[sp] = append(spanTokens[sp], token.Term)
+			}
+			if _, ok := seen[token.Term]; !ok {
+				seen[token.Term] = struct{}{}
+				terms = append(terms, queryTerm{token: token.Term, boost: 1})
+			}
+		}
+		byAnalyzer[f.analyzer.Name] = len(analysis.Analyzers)
+		analysis.Analyzers = append(analysis.Analyzers, analyzed)
+	}
+
+	sort.SliceStable(spans, func(i, j int) bool {
+		return spans[i].start < spans[j].start
+	})
+	clauses := make([]clause, 0, len(spans))
+	for _, sp := range spans {
+		clauses = append(clauses, spanTokens[sp])
+	}
+	return clauses, terms, analysis
+}
+
+type filterSet []filter
+
+type filter struct {
+	field string
+	value string
+}
+
+func (im *InMemSearch) parseFilters(filters map[string]string) (filterSet, error) {
+	parsed := make(filterSet, 0, len(filters))
+	for name, value := range filters {
+		f, ok := im.schema.Field(name)
+		if !ok {
+			return nil, fmt.Errorf("unknown filter field: %s", name)
+		}
+		if !f.Filterable {
+			return nil, fmt.Errorf("field %s is not filterable", name)
+		}
+		parsed = append(parsed, filter{field: name, value: value})
+	}
+	return parsed, nil
+}
+
+// true when the doc has the value of every filter, an array field matches when any of its values does
+func (fs filterSet) match(doc Document) bool {
+	for _, f := range fs {
+		switch v := doc.Fields[f.field].(type) {
+		case []interface{}:
+			found := false
+			for _, item := range v {
+				if strings.EqualFold(common.FormatValue(item), f.value) {
+					found = true
+					break
+				}
+			}
+			if !found {
+				return false
+			}
+		case nil:
+			return false
+		default:
+			if !strings.EqualFold(common.FormatValue(v), f.value) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+type sortField struct {
+	field      string
+	descending bool
+}
+
+func (im *InMemSearch) parseSort(sortBy string) (*sortField, error) {
+	if sortBy == "" {
+		return nil, nil
+	}
+
+	s := &sortField{field: sortBy}
+	if strings.HasPrefix(sortBy, "-") {
+		s.field = sortBy[1:]
+		s.descending = true
+	}
+	f, ok := im.schema.Field(s.field)
+	if !ok {
+		return nil, fmt.Errorf("unknown sort field: %s", s.field)
+	}
+	if !f.Sortable {
+		return nil, fmt.Errorf("field %s is not sortable", s.field)
+	}
+	return s, nil
+}
+
+// orders the hits by the sort field, docs without a value for it go last.
+// a nil sortField keeps the order by score
+func (s *sortField) apply(hits []Hit) {
+	if s == nil {
+		return
+	}
+	sort.SliceStable(hits, func(i, j int) bool {
+		a, aok := hits[i].Document.Fields[s.field]
+		b, bok := hits[j].Document.Fields[s.field]
+		if !aok || !bok {
+			return aok && !bok
+		}
+		if s.descending {
+			return lessValue(b, a)
+		}
+		return lessValue(a, b)
+	})
+}
+
+func lessValue(a, b interface{}) bool {
+	switch av := a.(type) {
+	case int64:
+		bv, _ := b.(int64)
+		return av < bv
+	case float64:
+		bv, _ := b.(float64)
+		return av < bv
+	case string:
+		bv, _ := b.(string)
+		return av < bv
+	case bool:
+		bv, _ := b.(bool)
+		return !av && bv
+	}
+	return false
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
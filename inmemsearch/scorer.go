@@ -0,0 +1,128 @@
+package inmemsearch
+
+import (
+	"fmt"
+	"math"
+	"sort"
+)
+
+// tree describing how a score was computed, every node's value is derived from its details
+type Explanation struct {
+	Value       float64        `json:"value"`
+	Description string         `json:"description"`
+	Details     []*Explanation `json:"details,omitempty"`
+}
+
+type Hit struct {
+	Document    Document
+	Score       float64
+	Explanation *Explanation
+}
+
+// a query token along with how much its matches weigh, 1 unless the query boosts it
+type queryTerm struct {
+	token string
+	boost float64
+}
+
+func queryTerms(tokens []string) []queryTerm {
+	terms := make([]queryTerm, len(tokens))
+	for i, token := range tokens {
+		terms[i] = queryTerm{token: token, boost: 1}
+	}
+	return terms
+}
+
+type scorer struct {
+	idx       Index
+	numDocs   int
+	fieldLens []map[string]int
+	// a match in a boosted field, i.e the title, says more about the doc than one in the rest
+	fieldBoosts map[string]float64
+}
+
+func newScorer(idx Index, numDocs int, fields []indexedField) *scorer {
+	fieldBoosts := make(map[string]float64, len(fields))
+	for _, f := range fields {
+		fieldBoosts[f.name] = f.boost
+	}
+	return &scorer{
+		idx:         idx,
+		numDocs:     numDocs,
+		fieldLens:   idx.fieldLengths(numDocs),
+		fieldBoosts: fieldBoosts,
+	}
+}
+
+// inverse document frequency of the token, rarer tokens weigh more
+func (s *scorer) idf(token string) (float64, int) {
+	docFreq := 0
+	if indexMap, ok := s.idx[token]; ok {
+		docFreq = len(indexMap.PostingList)
+	}
+	return 1 + math.Log(float64(s.numDocs)/float64(docFreq+1)), docFreq
+}
+
+// tf-idf score of the doc for the query terms, summed over every term and field:
+// sqrt(freq) * idf * 1/sqrt(fieldLength) * fieldBoost * queryBoost
+// the explanation tree is only built when explain is set since it allocates a lot.
+func (s *scorer) score(docID int, terms []queryTerm, explain bool) (float64, *Explanation) {
+	total := 0.0
+	var details []*Explanation
+
+	for _, term := range terms {
+		token := term.token
+		freqs := s.idx.termFreqs(token, docID)
+		if len(freqs) == 0 {
+			continue
+		}
+		idf, docFreq := s.idf(token)
+
+		// iterate the fields in a fixed order so the explanation is stable
+		for _, name := range sortedFieldNames(freqs) {
+			freq := freqs[name]
+			fieldLen := s.fieldLens[docID][name]
+			tf := math.Sqrt(float64(freq))
+			norm := 1 / math.Sqrt(float64(fieldLen))
+			boost := s.fieldBoosts[name]
+			weight := tf * idf * norm * boost * term.boost
+			total += weight
+
+			if !explain {
+				continue
+			}
+			factors := []*Explanation{
+				{Value: tf, Description: fmt.Sprintf("tf, sqrt of termFreq=%d", freq)},
+				{Value: idf, Description: fmt.Sprintf("idf, 1 + ln(docCount=%d / (docFreq=%d + 1))", s.numDocs, docFreq)},
+				{Value: norm, Description: fmt.Sprintf("fieldNorm, 1 / sqrt(fieldLength=%d)", fieldLen)},
+				{Value: boost, Description: fmt.Sprintf("boost of field %s", name)},
+			}
+			if term.boost != 1 {
+				factors = append(factors, &Explanation{Value: term.boost, Description: fmt.Sprintf("boost of query term %s", token)})
+			}
+			details = append(details, &Explanation{
+				Value:       weight,
+				Description: fmt.Sprintf("weight(%s:%s), product of:", name, token),
+				Details:     factors,
+			})
+		}
+	}
+
+	if !explain {
+		return total, nil
+	}
+	return total, &Explanation{
+		Value:       total,
+		Description: fmt.Sprintf("score(doc=%d), sum of:", docID),
+		Details:     details,
+	}
+}
+
+func sortedFieldNames(freqs map[string]int) []string {
+	names := make([]string, 0, len(freqs))
+	for name := range freqs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -1,58 +1,260 @@
 package inmemsearch
 
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"sync"
+	"textscout/common"
+	"textscout/internal/dataset"
+)
+
 type InMemSearch struct {
-	idx       Index
-	movieDocs []Document
+	// guards the index and the docs, searches share it while writes take it exclusively
+	mu     sync.RWMutex
+	schema *common.Schema
+	fields []indexedField
+	idx    Index
+	docs   []Document
+	scorer *scorer
+	// id of the document in the dataset to the doc ID, i.e. the position of the doc in docs.
+	// a deleted doc is dropped from here and keeps its position in docs with nil fields until a new doc takes it
+	docIDs map[string]int
+	// doc IDs of the deleted docs, taken by the next docs added so docs doesn't grow with every write
+	free []int
+}
+
+// how many docs are matched, filtered or scored between two checks of the context of a search
+const cancelCheckInterval = 256
+
+type SearchRequest struct {
+	Query string
+	// match any of the query tokens instead of all of them
+	Union bool
+	// field name to the value it must have, only filterable fields are allowed
+	Filters map[string]string
+	// sortable field to order the hits by, prefixed with - for descending.
+	// the hits are ordered by the highest score first when empty
+	Sort string
+	// build the explanation of the score of every hit
+	Explain bool
 }
 
-func prepareIndex(filePath string) (Index, []Document, error) {
-	// build the inverted index by reading the json from this filepath
-	docs, err := loadMovies(filePath)
+// called with the number of documents of every batch added to the index while it is built
+type LoadProgress func(docs int)
+
+func prepareIndex(reader dataset.Reader, schema *common.Schema, progress LoadProgress) (Index, []Document, []indexedField, error) {
+	fields, err := resolveFields(schema)
 	if err != nil {
-		return nil, []Document{}, err
+		return nil, []Document{}, nil, err
 	}
 
-	// create the in-memory inverted index
+	// build the in-memory inverted index by streaming the dataset
 	index := make(Index)
-	index.Add(docs)
-	return index, docs, nil
+	docs := make([]Document, 0)
+	err = loadDocuments(reader, schema, dataset.DefaultBatchSize, func(batch []Document) {
+		index.Add(batch, fields)
+		docs = append(docs, batch...)
+		if progress != nil {
+			progress(len(batch))
+		}
+	})
+	if err != nil {
+		return nil, []Document{}, nil, err
+	}
+	return index, docs, fields, nil
 }
 
-func GetInMemSearch(filePath string) *InMemSearch {
-	index, mdocs, err := prepareIndex(filePath)
+func GetInMemSearch(filePath string, schema *common.Schema) *InMemSearch {
+	im, err := NewInMemSearch(filePath, schema)
 	if err != nil {
 		panic(err.Error())
 	}
+	return im
+}
+
+func NewInMemSearch(filePath string, schema *common.Schema) (*InMemSearch, error) {
+	return NewInMemSearchFromSource(dataset.Source{Path: filePath}, schema)
+}
+
+// builds the index from a dataset of any format, NewInMemSearch detects it from the file extension
+func NewInMemSearchFromSource(source dataset.Source, schema *common.Schema) (*InMemSearch, error) {
+	return NewInMemSearchFromSourceProgress(source, schema, nil)
+}
+
+// like NewInMemSearchFromSource, the progress is told about every batch of documents loaded
+func NewInMemSearchFromSourceProgress(source dataset.Source, schema *common.Schema, progress LoadProgress) (*InMemSearch, error) {
+	reader, err := dataset.Open(source, schema)
+	if err != nil {
+		log.Println("failed to open the dataset", err)
+		return nil, err
+	}
+	defer reader.Close()
+	return NewInMemSearchFromReaderProgress(reader, schema, progress)
+}
+
+// builds the index from the documents the reader returns until io.EOF, i.e. the rows of a table.
+// the reader is left open.
+func NewInMemSearchFromReader(reader dataset.Reader, schema *common.Schema) (*InMemSearch, error) {
+	return NewInMemSearchFromReaderProgress(reader, schema, nil)
+}
+
+// like NewInMemSearchFromReader, the progress is told about every batch of documents loaded
+func NewInMemSearchFromReaderProgress(reader dataset.Reader, schema *common.Schema, progress LoadProgress) (*InMemSearch, error) {
+	index, docs, fields, err := prepareIndex(reader, schema, progress)
+	if err != nil {
+		return nil, err
+	}
+	docIDs := make(map[string]int, len(docs))
+	for _, doc := range docs {
+		docIDs[schema.DocumentID(doc.Fields)] = doc.ID
+	}
 	return &InMemSearch{
-		idx:       index,
-		movieDocs: mdocs,
+		schema: schema,
+		fields: fields,
+		idx:    index,
+		docs:   docs,
+		scorer: newScorer(index, len(docs), fields),
+		docIDs: docIDs,
+	}, nil
+}
+
+// resolves the analyzer of every indexed field of the schema
+func resolveFields(schema *common.Schema) ([]indexedField, error) {
+	fields := make([]indexedField, 0)
+	for _, f := range schema.IndexedFields() {
+		analyzer, err := GetAnalyzer(f.Analyzer)
+		if err != nil {
+			return nil, fmt.Errorf("field %s: %w", f.Name, err)
+		}
+		fields = append(fields, indexedField{name: f.Name, analyzer: analyzer, boost: f.Boost})
 	}
+	return fields, nil
 }
 
-func (im *InMemSearch) Intersection(query string) []Document {
-	// search the index given some query
-	// query being the movie_title or movie_description
-	docIDs := im.idx.SearchIntersection(query)
-	docs := make([]Document, 0)
+func (im *InMemSearch) Schema() *common.Schema {
+	return im.schema
+}
 
-	for _, id := range docIDs {
-		md := im.movieDocs[id]
-		docs = append(docs, md)
+func (im *InMemSearch) DocCount() int {
+	im.mu.RLock()
+	defer im.mu.RUnlock()
+	return im.scorer.numDocs
+}
+
+// number of distinct terms in the index
+func (im *InMemSearch) TermCount() int {
+	im.mu.RLock()
+	defer im.mu.RUnlock()
+	return len(im.idx)
+}
+
+// approximate bytes held by the posting lists: the terms, the doc IDs and the field frequencies
+// aligned with them. the overhead of the maps isn't counted and the field names are the schema's.
+func (im *InMemSearch) PostingsBytes() int {
+	im.mu.RLock()
+	defer im.mu.RUnlock()
+	size := 0
+	for term, indexMap := range im.idx {
+		size += len(term) + cap(indexMap.PostingList)*strconv.IntSize/8
+		for _, freqs := range indexMap.FieldFreqs {
+			size += len(freqs) * strconv.IntSize / 8
+		}
 	}
+	return size
+}
 
-	return docs
+func (im *InMemSearch) Intersection(query string) []Document {
+	// search the index given some query
+	// query being the text of any of the indexed fields
+	hits, _, _ := im.Search(SearchRequest{Query: query})
+	return im.hitsToDocs(hits)
 }
 
 func (im *InMemSearch) Union(query string) []Document {
 	// search the index given some query
-	// query being the movie_title or movie_description
-	docIDs := im.idx.SearchUnion(query)
-	docs := make([]Document, 0)
+	// query being the text of any of the indexed fields
+	hits, _, _ := im.Search(SearchRequest{Query: query, Union: true})
+	return im.hitsToDocs(hits)
+}
+
+// Search matches the query against every indexed field, drops the docs not
+// passing the filters and returns the rest ranked by their score or the sort field.
+func (im *InMemSearch) Search(req SearchRequest) ([]Hit, QueryAnalysis, error) {
+	return im.SearchContext(context.Background(), req)
+}
+
+// SearchContext is Search stopping once the context is done, checked every cancelCheckInterval
+// docs. The error is then the one of the context, with the hits ranked so far: none when it was
+// done before the docs matching the query were known, otherwise the ones scored in time.
+func (im *InMemSearch) SearchContext(ctx context.Context, req SearchRequest) ([]Hit, QueryAnalysis, error) {
+	im.mu.RLock()
+	defer im.mu.RUnlock()
+
+	filters, err := im.parseFilters(req.Filters)
+	if err != nil {
+		return nil, QueryAnalysis{}, err
+	}
+	sortBy, err := im.parseSort(req.Sort)
+	if err != nil {
+		return nil, QueryAnalysis{}, err
+	}
+
+	clauses, terms, analysis := im.analyzeQuery(req.Query)
+	docIDs, err := im.idx.match(ctx, clauses, req.Union)
+	if err != nil {
+		return []Hit{}, analysis, err
+	}
 
-	for _, id := range docIDs {
-		md := im.movieDocs[id]
-		docs = append(docs, md)
+	matched := make([]int, 0, len(docIDs))
+	for i, id := range docIDs {
+		if i%cancelCheckInterval == 0 && ctx.Err() != nil {
+			return []Hit{}, analysis, ctx.Err()
+		}
+		if filters.match(im.docs[id]) {
+			matched = append(matched, id)
+		}
 	}
 
+	hits, err := im.rankContext(ctx, matched, terms, req.Explain)
+	sortBy.apply(hits)
+	return hits, analysis, err
+}
+
+// scores the matched docs and sorts them by the highest score first. once the context is done
+// the docs scored so far are still sorted and returned, with the error of the context
+func (im *InMemSearch) rankContext(ctx context.Context, docIDs []int, terms []queryTerm, explain bool) ([]Hit, error) {
+	var err error
+	hits := make([]Hit, 0, len(docIDs))
+	for i, id := range docIDs {
+		if i%cancelCheckInterval == 0 && ctx.Err() != nil {
+			err = ctx.Err()
+			break
+		}
+		score, explanation := im.scorer.score(id, terms, explain)
+		hits = append(hits, Hit{
+			Document:    im.docs[id],
+			Score:       score,
+			Explanation: explanation,
+		})
+	}
+
+	// ties keep the doc ID order so the results are deterministic
+	sort.SliceStable(hits, func(i, j int) bool {
+		if hits[i].Score == hits[j].Score {
+			return hits[i].Document.ID < hits[j].Document.ID
+		}
+		return hits[i].Score > hits[j].Score
+	})
+	return hits, err
+}
+
+func (im *InMemSearch) hitsToDocs(hits []Hit) []Document {
+	docs := make([]Document, 0, len(hits))
+	for _, hit := range hits {
+		docs = append(docs, hit.Document)
+	}
 	return docs
 }
@@ -3,23 +3,46 @@ package inmemsearch
 import (
 	"strings"
 	"unicode"
+	"unicode/utf8"
 )
 
+// a single term along with where it came from in the original text
+type Token struct {
+	Term     string `json:"term"`
+	Position int    `json:"position"`
+	// byte offsets of the term in the original text
+	StartOffset int `json:"start_offset"`
+	EndOffset   int `json:"end_offset"`
+}
+
+func isSeparator(r rune) bool {
+	return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+}
+
 func Tokenize(text string) []string {
-	return strings.FieldsFunc(text, func(r rune) bool {
-		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
-	})
+	return strings.FieldsFunc(text, isSeparator)
 }
 
-// applies the appropriate filters and returns the clean tokens list
-func analyze(text string) []string {
-	// tokenise the text
-	tokens := Tokenize(text)
-	// normalise the text
-	normalisedTokens := NormaliseFilter(tokens)
-	// remove the stopwords
-	cleanedTokens := StopWordsFilter(normalisedTokens)
-	// stemm the text
-	return StemmingFilter(cleanedTokens)
+// same split as Tokenize but keeps the position and offsets of every token
+func TokenizeWithOffsets(text string) []Token {
+	tokens := make([]Token, 0)
+	start := -1
+
+	for i := 0; i < len(text); {
+		r, size := utf8.DecodeRuneInString(text[i:])
+		if isSeparator(r) {
+			if start != -1 {
+				tokens = append(tokens, Token{Term: text[start:i], Position: len(tokens), StartOffset: start, EndOffset: i})
+				start = -1
+			}
+		} else if start == -1 {
+			start = i
+		}
+		i += size
+	}
+	if start != -1 {
+		tokens = append(tokens, Token{Term: text[start:], Position: len(tokens), StartOffset: start, EndOffset: len(text)})
+	}
 
+	return tokens
 }
@@ -0,0 +1,231 @@
+package backend
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"textscout/common"
+	textsearch "textscout/inmemsearch"
+	"textscout/internal/dataset"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+var (
+	// the request asks for something the backend can't do, i.e explain on the database
+	ErrUnsupported = errors.New("not supported by the backend")
+	// the request itself is wrong, i.e sorting by a field which isn't sortable
+	ErrInvalidRequest = errors.New("invalid request")
+	// the document doesn't fit the schema
+	ErrInvalidDocument = errors.New("invalid document")
+	// the search or write took longer than its deadline, or the statement_timeout of the database
+	ErrTimeout = errors.New("timed out")
+	// the backend can't be reached, i.e the database is down or refusing connections, the request may be retried
+	ErrUnavailable = errors.New("backend unavailable")
+)
+
+type Request struct {
+	// text of the query params of every indexed field, concatenated
+	Query string
+	// query param of an indexed field to its text, for the backends searching the fields one by one
+	Fields map[string]string
+	// match any of the query tokens instead of all of them
+	Union bool
+	// field name to the value it must have, only filterable fields are allowed
+	Filters map[string]string
+	// sortable field to order the hits by, prefixed with - for descending
+	Sort string
+	// build the explanation of the score of every hit
+	Explain bool
+	// cap on the number of hits, 0 leaves it to the backend
+	Limit int
+}
+
+type Hit struct {
+	ID string
+	// the fields of the document named after the schema
+	Fields map[string]interface{}
+	// 0 when the backend doesn't score the hits, they are still ranked by their order
+	Score float64
+	// set when the request asked to explain and the backend supports it
+	Explanation *textsearch.Explanation
+	// field name to its text with the matched words in <em>, for the backends which highlight
+	Highlights map[string]string
+}
+
+type Result struct {
+	// best ranked first
+	Hits []Hit
+	// how the query was analyzed, set when the request asked to explain
+	Analysis *textsearch.QueryAnalysis
+	// the search stopped at its deadline, the hits are the ones found in time
+	TimedOut bool
+}
+
+// Backend is a search engine a collection searches with. The request and hit semantics
+// are the same for all of them, a backend returns ErrUnsupported for the parts of
+// the request it can't honour instead of ignoring them. A search past the deadline of the
+// context returns ErrTimeout, along with the hits found in time in a TimedOut result when the
+// backend can stop part way, as the in-memory index does.
+type Backend interface {
+	Search(ctx context.Context, req Request) (Result, error)
+}
+
+// DocumentWriter is implemented by the backends whose documents can be written one by one
+type DocumentWriter interface {
+	// returns textsearch.ErrDocumentExists if a document with the same id is stored already
+	AddDocument(ctx context.Context, raw map[string]interface{}) (string, error)
+	// returns whether the document was created rather than replaced
+	UpsertDocument(ctx context.Context, raw map[string]interface{}) (string, bool, error)
+	// returns textsearch.ErrDocumentNotFound if there's no document with the id
+	DeleteDocument(ctx context.Context, id string) error
+}
+
+// SimilarFinder is implemented by the backends which can find the documents most like a stored one
+type SimilarFinder interface {
+	// returns textsearch.ErrDocumentNotFound if there's no document with the id, and ErrTimeout
+	// along with the documents found in time in a TimedOut result past the deadline of the context
+	Similar(ctx context.Context, id string, limit int) (Result, error)
+}
+
+// DocumentCounter is implemented by the backends which know how many documents they hold
+type DocumentCounter interface {
+	DocCount() int
+}
+
+// Pinger is implemented by the backends which depend on a database, to check it can be reached
+type Pinger interface {
+	Ping(ctx context.Context) error
+}
+
+// Stats is the size of what a backend holds, the parts it can't tell are 0
+type Stats struct {
+	Documents int
+	// distinct terms of the inverted index
+	Terms int
+	// approximate size of the posting lists of the inverted index
+	PostingsBytes int
+}
+
+// StatsReporter is implemented by the backends which can tell their size
+type StatsReporter interface {
+	Stats(ctx context.Context) (Stats, error)
+}
+
+// PoolReporter is implemented by the backends holding a pool of database connections,
+// the stats are nil when the backend has none
+type PoolReporter interface {
+	PoolStats() *pgxpool.Stat
+}
+
+// what a backend is built from, each backend reads the options it needs
+type Options struct {
+	Config *common.Config
+	// dataset the in-memory index is built from
+	Source dataset.Source
+	Schema *common.Schema
+	// minimum word similarity of a movie matched by the trigram backend, 0 uses its default
+	TrigramThreshold float64
+	// build the in-memory index from the movies table instead of the dataset and keep it in sync with it
+	SyncFromDatabase bool
+	// file of the sqlite database, textscout.db when empty
+	SQLitePath string
+	// told about every batch of documents loaded into the in-memory index, including the
+	// reloads of an index synced with the database. may be nil
+	Progress textsearch.LoadProgress
+}
+
+type Factory func(opts Options) (Backend, error)
+
+var (
+	factoriesMu sync.RWMutex
+	factories   = make(map[string]Factory)
+)
+
+// Register makes a backend available by its name, it panics if the name is taken.
+// The backends of this package register themselves from init.
+func Register(name string, factory Factory) {
+	factoriesMu.Lock()
+	defer factoriesMu.Unlock()
+	if _, ok := factories[name]; ok {
+		panic(fmt.Sprintf("backend %s is registered twice", name))
+	}
+	factories[name] = factory
+}
+
+// Names of the registered backends, sorted
+func Names() []string {
+	factoriesMu.RLock()
+	defer factoriesMu.RUnlock()
+	names := make([]string, 0, len(factories))
+	for name := range factories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func Registered(name string) bool {
+	factoriesMu.RLock()
+	defer factoriesMu.RUnlock()
+	_, ok := factories[name]
+	return ok
+}
+
+// New builds the backend registered with the name, an empty name is the database
+func New(name string, opts Options) (Backend, error) {
+	if name == "" {
+		name = Database
+	}
+	factoriesMu.RLock()
+	factory, ok := factories[name]
+	factoriesMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("search_by must be one of %s, got: %q", strings.Join(Names(), ", "), name)
+	}
+	if opts.Schema == nil {
+		opts.Schema = common.DefaultMovieSchema()
+	}
+	return factory(opts)
+}
+
+// applies the limit of the request to the hits
+func limitHits(hits []Hit, limit int) []Hit {
+	if limit > 0 && len(hits) > limit {
+		return hits[:limit]
+	}
+	return hits
+}
+
+// the movie with the field names of the movies schema, the databases only store movies
+// so the hits of all of them are built from their rows converted to common.MovieData
+func movieHit(movie common.MovieData, score float64) Hit {
+	genreIDs := make([]interface{}, 0, len(movie.GenreIDs))
+	for _, id := range movie.GenreIDs {
+		genreIDs = append(genreIDs, int64(id))
+	}
+	return Hit{
+		ID:    strconv.Itoa(int(movie.ID)),
+		Score: score,
+		Fields: map[string]interface{}{
+			"adult":             movie.Adult,
+			"backdrop_path":     movie.BackdropPath,
+			"genre_ids":         genreIDs,
+			"id":                int64(movie.ID),
+			"original_language": movie.Language,
+			"original_title":    movie.OriginalTitle,
+			"overview":          movie.Overview,
+			"popularity":        movie.Popularity,
+			"poster_path":       movie.PosterPath,
+			"release_date":      movie.ReleaseDate,
+			"title":             movie.MovieTitle,
+			"video":             movie.Video,
+			"vote_average":      movie.VoteAverage,
+			"vote_count":        movie.VoteCount,
+		},
+	}
+}
@@ -0,0 +1,269 @@
+package backend
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+	"textscout/common"
+	textsearch "textscout/inmemsearch"
+	"textscout/internal/database"
+	"textscout/internal/dataset"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+const sampleFilePath = "../../inmemsearch/testdata/sample.json"
+
+func TestRegistry(t *testing.T) {
+	for _, name := range []string{InMemIndex, Database, PostgresFTS, Trigram, SQLite} {
+		if !Registered(name) {
+			t.Errorf("expected the backend %s to be registered", name)
+		}
+	}
+	if _, err := New("elastic", Options{}); err == nil {
+		t.Errorf("expected an error for an unknown backend")
+	}
+}
+
+func TestInMem(t *testing.T) {
+	b, err := New(InMemIndex, Options{Source: dataset.Source{Path: sampleFilePath}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	// godzilla matches two movies, the limit keeps the best ranked one
+	result, err := b.Search(ctx, Request{Query: "godzilla", Limit: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Hits) != 1 {
+		t.Fatalf("expected 1 hit, got: %d", len(result.Hits))
+	}
+	if result.Hits[0].ID != "823464" && result.Hits[0].ID != "940721" {
+		t.Errorf("expected a godzilla movie, got: %s", result.Hits[0].ID)
+	}
+	if result.Hits[0].Score <= 0 || result.Analysis != nil {
+		t.Errorf("expected a scored hit without the analysis, got: %+v", result)
+	}
+
+	result, err = b.Search(ctx, Request{Query: "godzilla", Explain: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Analysis == nil || result.Hits[0].Explanation == nil {
+		t.Errorf("expected the analysis and explanations, got: %+v", result)
+	}
+
+	if _, err := b.Search(ctx, Request{Query: "godzilla", Sort: "overview"}); !errors.Is(err, ErrInvalidRequest) {
+		t.Errorf("expected ErrInvalidRequest for an unsortable field, got: %v", err)
+	}
+}
+
+// answers the LIKE queries from a fixed list of movies
+type fakeQuerier struct {
+	database.Querier
+	byTitle []database.GetMovieByTitleRow
+	byDesc  []database.GetMovieByDescRow
+	calls   []string
+	// the limit of the last query
+	limit int32
+}
+
+func (q *fakeQuerier) GetMovieByTitle(ctx context.Context, arg database.GetMovieByTitleParams) ([]database.GetMovieByTitleRow, error) {
+	q.calls, q.limit = append(q.calls, "title"), arg.Limit
+	return q.byTitle, nil
+}
+
+func (q *fakeQuerier) GetMovieByDesc(ctx context.Context, arg database.GetMovieByDescParams) ([]database.GetMovieByDescRow, error) {
+	q.calls, q.limit = append(q.calls, "desc"), arg.Limit
+	return q.byDesc, nil
+}
+
+func (q *fakeQuerier) GetMovieByTitleAndDesc(ctx context.Context, arg database.GetMovieByTitleAndDescParams) ([]database.GetMovieByTitleAndDescRow, error) {
+	q.calls, q.limit = append(q.calls, "both"), arg.Limit
+	return []database.GetMovieByTitleAndDescRow{database.GetMovieByTitleAndDescRow(q.byTitle[0])}, nil
+}
+
+func TestLike(t *testing.T) {
+	kong := database.GetMovieByTitleRow{MovieID: 293167, MovieTitle: "Kong: Skull Island"}
+	godzilla := database.GetMovieByTitleRow{MovieID: 823464, MovieTitle: "Godzilla x Kong: The New Empire"}
+	querier := &fakeQuerier{byTitle: []database.GetMovieByTitleRow{kong, godzilla}, byDesc: []database.GetMovieByDescRow{database.GetMovieByDescRow(godzilla)}}
+	b := &Like{NewPostgres(querier, nil, common.DefaultMovieSchema())}
+	ctx := context.Background()
+
+	result, err := b.Search(ctx, Request{Fields: map[string]string{"title": "kong", "desc": "godzilla"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Hits) != 1 || querier.calls[0] != "both" {
+		t.Errorf("expected the movies matching both, got: %+v", result.Hits)
+	}
+
+	// or searches the fields one by one, godzilla is found by both but returned once
+	querier.calls = nil
+	result, err = b.Search(ctx, Request{Fields: map[string]string{"title": "kong", "desc": "godzilla"}, Union: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Hits) != 2 || len(querier.calls) != 2 {
+		t.Errorf("expected 2 hits from 2 queries, got: %d from %v", len(result.Hits), querier.calls)
+	}
+	if result.Hits[0].ID != "293167" || result.Hits[0].Fields["title"] != "Kong: Skull Island" {
+		t.Errorf("expected the fields of the movie, got: %+v", result.Hits[0])
+	}
+
+	result, err = b.Search(ctx, Request{Fields: map[string]string{"title": "kong"}, Limit: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Hits) != 1 || querier.limit != 1 {
+		t.Errorf("expected the limit to keep 1 hit, got: %d with the limit %d", len(result.Hits), querier.limit)
+	}
+	// the limit of the request is the one of the query, above the default too
+	if _, err := b.Search(ctx, Request{Fields: map[string]string{"title": "kong"}, Limit: 20}); err != nil || querier.limit != 20 {
+		t.Errorf("expected the limit 20 to be queried, got: %d %v", querier.limit, err)
+	}
+	if _, err := b.Search(ctx, Request{Fields: map[string]string{"title": "kong"}}); err != nil || querier.limit != databaseResultLimit {
+		t.Errorf("expected the default limit %d to be queried, got: %d %v", databaseResultLimit, querier.limit, err)
+	}
+
+	if _, err := b.Search(ctx, Request{Fields: map[string]string{"title": "kong"}, Explain: true}); !errors.Is(err, ErrUnsupported) {
+		t.Errorf("expected ErrUnsupported for explain, got: %v", err)
+	}
+	if _, err := (&FTS{b.Postgres}).Search(ctx, Request{Query: "kong", Union: true}); !errors.Is(err, ErrUnsupported) {
+		t.Errorf("expected ErrUnsupported for or on the full text search, got: %v", err)
+	}
+}
+
+// serves the movies table from a map for the replica
+type fakeTable struct {
+	database.Querier
+	movies map[int32]movieRow
+}
+
+func (q *fakeTable) ListMoviesAfter(ctx context.Context, arg database.ListMoviesAfterParams) ([]database.ListMoviesAfterRow, error) {
+	page := make([]database.ListMoviesAfterRow, 0)
+	for id := arg.AfterMovieID + 1; len(page) < int(arg.MaxResults) && id < 1000; id++ {
+		if movie, ok := q.movies[id]; ok {
+			page = append(page, database.ListMoviesAfterRow(movie))
+		}
+	}
+	return page, nil
+}
+
+func (q *fakeTable) GetMovieByMovieID(ctx context.Context, movieID int32) (database.GetMovieByMovieIDRow, error) {
+	movie, ok := q.movies[movieID]
+	if !ok {
+		return database.GetMovieByMovieIDRow{}, pgx.ErrNoRows
+	}
+	return movie, nil
+}
+
+func TestReplica(t *testing.T) {
+	table := &fakeTable{movies: map[int32]movieRow{
+		1: {MovieID: 1, MovieTitle: "Godzilla", MovieOverview: pgtype.Text{String: "a giant lizard", Valid: true}},
+		2: {MovieID: 2, MovieTitle: "Kong: Skull Island", ReleaseDate: pgtype.Text{String: "2017-03-08", Valid: true}},
+	}}
+	r := &replica{db: NewPostgres(table, nil, common.DefaultMovieSchema())}
+	r.owner = &InMem{replica: r}
+
+	index, err := textsearch.NewInMemSearchFromReader(&movieReader{ctx: context.Background(), querier: table}, r.db.schema)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.owner.index.Store(index)
+	if index.DocCount() != 2 {
+		t.Fatalf("expected 2 movies loaded from the table, got: %d", index.DocCount())
+	}
+
+	search := func(query string) []Hit {
+		result, err := r.owner.Search(context.Background(), Request{Query: query})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return result.Hits
+	}
+
+	// an updated movie is read again, a deleted one dropped
+	table.movies[1] = movieRow{MovieID: 1, MovieTitle: "Godzilla Minus One"}
+	delete(table.movies, 2)
+	for _, id := range []string{"1", "2"} {
+		if err := r.apply(context.Background(), id); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if hits := search("minus"); len(hits) != 1 || hits[0].ID != "1" {
+		t.Errorf("expected the updated movie, got: %+v", hits)
+	}
+	if hits := search("kong"); len(hits) != 0 {
+		t.Errorf("expected the deleted movie to be gone, got: %+v", hits)
+	}
+	// a change to a movie deleted already is applied once more without failing
+	if err := r.apply(context.Background(), "2"); err != nil {
+		t.Errorf("expected deleting a missing movie to succeed, got: %v", err)
+	}
+}
+
+func TestSQLite(t *testing.T) {
+	b, err := New(SQLite, Options{SQLitePath: filepath.Join(t.TempDir(), "movies.db")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.(*SQLiteFTS).Close()
+	ctx := context.Background()
+
+	// the documents are decoded from json, so the numbers are float64
+	writer := b.(DocumentWriter)
+	for _, raw := range []map[string]interface{}{
+		{"id": 293167.0, "title": "Kong: Skull Island", "overview": "Explore the home of the king of the apes"},
+		{"id": 940721.0, "title": "Godzilla Minus One", "overview": "Postwar Japan is at its lowest point"},
+	} {
+		if _, err := writer.AddDocument(ctx, raw); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := writer.AddDocument(ctx, map[string]interface{}{"id": 940721.0, "title": "Godzilla"}); !errors.Is(err, textsearch.ErrDocumentExists) {
+		t.Errorf("expected ErrDocumentExists, got: %v", err)
+	}
+
+	result, err := b.Search(ctx, Request{Query: "kong"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Hits) != 1 || result.Hits[0].ID != "293167" {
+		t.Fatalf("expected Kong: Skull Island, got: %+v", result.Hits)
+	}
+	if !strings.Contains(result.Hits[0].Highlights["title"], "<em>Kong</em>") || result.Hits[0].Highlights["overview"] != "" {
+		t.Errorf("expected only the title to be highlighted, got: %v", result.Hits[0].Highlights)
+	}
+
+	result, _ = b.Search(ctx, Request{Query: "skull japan", Union: true})
+	if len(result.Hits) != 2 {
+		t.Errorf("expected 2 hits for either word, got: %d", len(result.Hits))
+	}
+	if _, err := b.Search(ctx, Request{Query: "kong", Explain: true}); !errors.Is(err, ErrUnsupported) {
+		t.Errorf("expected ErrUnsupported for explain, got: %v", err)
+	}
+
+	if err := writer.DeleteDocument(ctx, "293167"); err != nil {
+		t.Fatal(err)
+	}
+	if err := writer.DeleteDocument(ctx, "293167"); !errors.Is(err, textsearch.ErrDocumentNotFound) {
+		t.Errorf("expected ErrDocumentNotFound, got: %v", err)
+	}
+	if count := b.(DocumentCounter).DocCount(); count != 1 {
+		t.Errorf("expected 1 movie left, got: %d", count)
+	}
+}
+
+// the backends implement the optional interfaces the handlers look for
+var (
+	_ DocumentWriter = (*InMem)(nil)
+	_ DocumentWriter = (*Postgres)(nil)
+	_ DocumentWriter = (*SQLiteFTS)(nil)
+	_ SimilarFinder  = (*InMem)(nil)
+)
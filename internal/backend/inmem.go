@@ -0,0 +1,188 @@
+package backend
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	textsearch "textscout/inmemsearch"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const InMemIndex = "inmemIndex"
+
+func init() {
+	Register(InMemIndex, func(opts Options) (Backend, error) {
+		if opts.SyncFromDatabase {
+			return newReplica(opts)
+		}
+		if opts.Source.Path == "" {
+			return nil, fmt.Errorf("file_path is required to build the in-memory index")
+		}
+		index, err := textsearch.NewInMemSearchFromSourceProgress(opts.Source, opts.Schema, opts.Progress)
+		if err != nil {
+			return nil, err
+		}
+		return NewInMem(index), nil
+	})
+}
+
+// InMem searches the in-memory inverted index, it supports every part of a request
+type InMem struct {
+	// swapped for a rebuilt one when a replica resyncs with the movies table
+	index atomic.Pointer[textsearch.InMemSearch]
+	// set when the index replicates the movies table, the writes then go to postgres
+	replica *replica
+}
+
+func NewInMem(index *textsearch.InMemSearch) *InMem {
+	b := &InMem{}
+	b.index.Store(index)
+	return b
+}
+
+func (b *InMem) Index() *textsearch.InMemSearch {
+	return b.index.Load()
+}
+
+func (b *InMem) Search(ctx context.Context, req Request) (Result, error) {
+	index := b.index.Load()
+	hits, analysis, err := index.SearchContext(ctx, textsearch.SearchRequest{
+		Query:   req.Query,
+		Union:   req.Union,
+		Filters: req.Filters,
+		Sort:    req.Sort,
+		Explain: req.Explain,
+	})
+	timedOut := errors.Is(err, context.DeadlineExceeded)
+	if err != nil && !timedOut {
+		if ctx.Err() != nil {
+			return Result{}, err
+		}
+		// the index only fails on filters and sorts it doesn't know
+		return Result{}, fmt.Errorf("%w: %s", ErrInvalidRequest, err)
+	}
+
+	result := Result{Hits: limitHits(indexHits(index, hits), req.Limit), TimedOut: timedOut}
+	if req.Explain {
+		result.Analysis = &analysis
+	}
+	if timedOut {
+		return result, fmt.Errorf("%w: the in-memory search stopped after %d hits: %w", ErrTimeout, len(hits), err)
+	}
+	return result, nil
+}
+
+func (b *InMem) Similar(ctx context.Context, id string, limit int) (Result, error) {
+	opts := textsearch.DefaultMoreLikeThisOptions()
+	if limit > 0 {
+		opts.Limit = limit
+	}
+	index := b.index.Load()
+	docs, err := index.MoreLikeThisContext(ctx, id, opts)
+	timedOut := errors.Is(err, context.DeadlineExceeded)
+	if err != nil && !timedOut {
+		return Result{}, err
+	}
+	hits := make([]Hit, 0, len(docs))
+	for _, doc := range docs {
+		hits = append(hits, Hit{ID: index.Schema().DocumentID(doc.Fields), Fields: doc.Fields})
+	}
+	if timedOut {
+		return Result{Hits: hits, TimedOut: true}, fmt.Errorf("%w: the similar documents stopped after %d hits: %w", ErrTimeout, len(hits), err)
+	}
+	return Result{Hits: hits}, nil
+}
+
+func (b *InMem) DocCount() int {
+	return b.index.Load().DocCount()
+}
+
+func (b *InMem) Stats(ctx context.Context) (Stats, error) {
+	index := b.index.Load()
+	return Stats{Documents: index.DocCount(), Terms: index.TermCount(), PostingsBytes: index.PostingsBytes()}, nil
+}
+
+// the pool of the movies table a replica follows
+func (b *InMem) PoolStats() *pgxpool.Stat {
+	if b.replica != nil {
+		return b.replica.db.PoolStats()
+	}
+	return nil
+}
+
+// the movies table a replica follows must be reachable, the index alone always is
+func (b *InMem) Ping(ctx context.Context) error {
+	if b.replica != nil {
+		return b.replica.db.Ping(ctx)
+	}
+	return nil
+}
+
+// a replica writes to postgres first and then applies the change to the index right away,
+// rather than waiting for its notification, so the writer searches what it wrote
+
+func (b *InMem) AddDocument(ctx context.Context, raw map[string]interface{}) (string, error) {
+	if b.replica != nil {
+		id, err := b.replica.db.AddDocument(ctx, raw)
+		if err != nil {
+			return id, err
+		}
+		return id, b.replica.apply(ctx, id)
+	}
+	id, err := b.index.Load().AddDocument(raw)
+	return id, invalidUnlessConflict(err)
+}
+
+func (b *InMem) UpsertDocument(ctx context.Context, raw map[string]interface{}) (string, bool, error) {
+	if b.replica != nil {
+		id, created, err := b.replica.db.UpsertDocument(ctx, raw)
+		if err != nil {
+			return id, created, err
+		}
+		return id, created, b.replica.apply(ctx, id)
+	}
+	id, created, err := b.index.Load().UpsertDocument(raw)
+	return id, created, invalidUnlessConflict(err)
+}
+
+func (b *InMem) DeleteDocument(ctx context.Context, id string) error {
+	if b.replica != nil {
+		if err := b.replica.db.DeleteDocument(ctx, id); err != nil {
+			return err
+		}
+		return b.replica.apply(ctx, id)
+	}
+	return b.index.Load().DeleteDocument(id)
+}
+
+// stops following the movies table, a no-op unless the index is a replica
+func (b *InMem) Close() error {
+	if b.replica != nil {
+		b.replica.stop()
+	}
+	return nil
+}
+
+// the index returns the schema errors as they are, anything but a conflict is the document's fault
+func invalidUnlessConflict(err error) error {
+	if err == nil || errors.Is(err, textsearch.ErrDocumentExists) {
+		return err
+	}
+	return fmt.Errorf("%w: %s", ErrInvalidDocument, err)
+}
+
+func indexHits(index *textsearch.InMemSearch, hits []textsearch.Hit) []Hit {
+	schema := index.Schema()
+	converted := make([]Hit, 0, len(hits))
+	for _, hit := range hits {
+		converted = append(converted, Hit{
+			ID:          schema.DocumentID(hit.Document.Fields),
+			Fields:      hit.Document.Fields,
+			Score:       hit.Score,
+			Explanation: hit.Explanation,
+		})
+	}
+	return converted
+}
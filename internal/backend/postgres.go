@@ -0,0 +1,457 @@
+package backend
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"textscout/common"
+	textsearch "textscout/inmemsearch"
+	"textscout/internal/database"
+	"textscout/internal/populate"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const (
+	Database    = "database"
+	PostgresFTS = "postgresFTS"
+	Trigram     = "trigram"
+)
+
+// how many movies the database searches return unless the request sets a limit
+const databaseResultLimit = 5
+
+// pg_trgm's own default for word_similarity_threshold
+const defaultTrigramThreshold = 0.6
+
+// postgres error codes the backends tell apart
+const (
+	uniqueViolation = "23505"
+	// the statement_timeout, or a cancelled query
+	queryCanceled = "57014"
+)
+
+func init() {
+	Register(Database, func(opts Options) (Backend, error) {
+		p, err := connect(opts)
+		if err != nil {
+			return nil, err
+		}
+		return &Like{p}, nil
+	})
+	Register(PostgresFTS, func(opts Options) (Backend, error) {
+		p, err := connect(opts)
+		if err != nil {
+			return nil, err
+		}
+		return &FTS{p}, nil
+	})
+	Register(Trigram, func(opts Options) (Backend, error) {
+		p, err := connect(opts)
+		if err != nil {
+			return nil, err
+		}
+		return &TrigramSimilarity{Postgres: p, threshold: opts.TrigramThreshold}, nil
+	})
+}
+
+func connect(opts Options) (*Postgres, error) {
+	if opts.Schema.Name != common.DefaultMovieSchema().Name {
+		return nil, fmt.Errorf("the database only stores movies, schema %s can only be searched by the inmemIndex", opts.Schema.Name)
+	}
+	if opts.Config == nil {
+		return nil, fmt.Errorf("the database config is required to search the database")
+	}
+	pgDB, err := database.NewPostgres(opts.Config.Postgres)
+	if err != nil {
+		return nil, err
+	}
+	return NewPostgres(database.New(pgDB.DB), pgDB.DB, opts.Schema), nil
+}
+
+// Postgres is what the backends searching the movies table share, the documents
+// are written to it as movie rows
+type Postgres struct {
+	querier database.Querier
+	// used for the queries which need a transaction, nil when only querying
+	db     *pgxpool.Pool
+	schema *common.Schema
+}
+
+func NewPostgres(querier database.Querier, db *pgxpool.Pool, schema *common.Schema) *Postgres {
+	return &Postgres{querier: querier, db: db, schema: schema}
+}
+
+// closes the connection pool, the backend can't be used after
+func (p *Postgres) Close() error {
+	if p.db != nil {
+		p.db.Close()
+	}
+	return nil
+}
+
+func (p *Postgres) Ping(ctx context.Context) error {
+	if p.db == nil {
+		return nil
+	}
+	if err := p.db.Ping(ctx); err != nil {
+		return databaseError("failed to ping the database", err)
+	}
+	return nil
+}
+
+func (p *Postgres) PoolStats() *pgxpool.Stat {
+	if p.db == nil {
+		return nil
+	}
+	return p.db.Stat()
+}
+
+// the terms are the ones of postgres' own indexes, they aren't counted
+func (p *Postgres) Stats(ctx context.Context) (Stats, error) {
+	count, err := p.querier.CountMovies(ctx)
+	if err != nil {
+		return Stats{}, databaseError("failed to count the movies", err)
+	}
+	return Stats{Documents: int(count)}, nil
+}
+
+func (p *Postgres) limit(req Request) int32 {
+	if req.Limit > 0 {
+		return int32(req.Limit)
+	}
+	return databaseResultLimit
+}
+
+// the database neither explains, sorts nor filters
+func unsupported(req Request, union bool) error {
+	if req.Explain || req.Sort != "" || len(req.Filters) != 0 {
+		return fmt.Errorf("%w: explain, sort and filters are only supported when searching by the inmemIndex", ErrUnsupported)
+	}
+	if req.Union && !union {
+		return fmt.Errorf("%w: the or default_operator is only supported when searching by the inmemIndex or the database", ErrUnsupported)
+	}
+	return nil
+}
+
+// Like matches the title and overview with LIKE, the movies aren't ranked.
+// at most the limit of the request, databaseResultLimit by default, are found for every field searched.
+type Like struct {
+	*Postgres
+}
+
+func (b *Like) Search(ctx context.Context, req Request) (Result, error) {
+	if err := unsupported(req, true); err != nil {
+		return Result{}, err
+	}
+	title, desc := req.Fields["title"], req.Fields["desc"]
+
+	limit := b.limit(req)
+	var movies []movieRow
+	if title != "" && desc != "" && !req.Union {
+		// search by both and return the results
+		rows, err := b.querier.GetMovieByTitleAndDesc(ctx, database.GetMovieByTitleAndDescParams{
+			Column1: pgtype.Text{String: title, Valid: true},
+			Column2: pgtype.Text{String: desc, Valid: true},
+			Limit:   limit,
+		})
+		if err != nil {
+			return Result{}, databaseError("failed to search the movies", err)
+		}
+		for _, row := range rows {
+			movies = append(movies, movieRow(row))
+		}
+	} else {
+		// search by either, a movie found by both is returned once
+		if title != "" {
+			rows, err := b.querier.GetMovieByTitle(ctx, database.GetMovieByTitleParams{
+				Column1: pgtype.Text{String: title, Valid: true},
+				Limit:   limit,
+			})
+			if err != nil {
+				return Result{}, databaseError("failed to search the movies", err)
+			}
+			for _, row := range rows {
+				movies = append(movies, movieRow(row))
+			}
+		}
+		if desc != "" {
+			rows, err := b.querier.GetMovieByDesc(ctx, database.GetMovieByDescParams{
+				Column1: pgtype.Text{String: desc, Valid: true},
+				Limit:   limit,
+			})
+			if err != nil {
+				return Result{}, databaseError("failed to search the movies", err)
+			}
+			byDesc := make([]movieRow, 0, len(rows))
+			for _, row := range rows {
+				byDesc = append(byDesc, movieRow(row))
+			}
+			movies = appendMissing(movies, byDesc)
+		}
+	}
+
+	hits := make([]Hit, 0, len(movies))
+	for _, movie := range movies {
+		hits = append(hits, movieHit(movieData(movie), 0))
+	}
+	return Result{Hits: limitHits(hits, int(limit))}, nil
+}
+
+func appendMissing(movies []movieRow, more []movieRow) []movieRow {
+	seen := make(map[int32]bool, len(movies))
+	for _, movie := range movies {
+		seen[movie.MovieID] = true
+	}
+	for _, movie := range more {
+		if !seen[movie.MovieID] {
+			movies = append(movies, movie)
+		}
+	}
+	return movies
+}
+
+// FTS is the full text search of the title and overview, the query is in the websearch
+// syntax, i.e "kong" -godzilla or skull. the best ranked movies come first.
+type FTS struct {
+	*Postgres
+}
+
+func (b *FTS) Search(ctx context.Context, req Request) (Result, error) {
+	if err := unsupported(req, false); err != nil {
+		return Result{}, err
+	}
+	rows, err := b.querier.SearchMoviesFTS(ctx, database.SearchMoviesFTSParams{
+		Query:      req.Query,
+		MaxResults: b.limit(req),
+	})
+	if err != nil {
+		return Result{}, databaseError("failed to search by full text", err)
+	}
+
+	hits := make([]Hit, 0, len(rows))
+	for _, row := range rows {
+		hits = append(hits, movieHit(movieData(ftsMovie(row)), float64(row.Rank)))
+	}
+	return Result{Hits: hits}, nil
+}
+
+// TrigramSimilarity is the typo tolerant search of the title and overview, a movie matches when a run
+// of words of its title or overview is similar enough to the query, i.e godzila matches godzilla.
+// the most similar come first.
+type TrigramSimilarity struct {
+	*Postgres
+	// minimum word similarity of a matched movie, 0 uses defaultTrigramThreshold
+	threshold float64
+}
+
+func (b *TrigramSimilarity) Search(ctx context.Context, req Request) (Result, error) {
+	if err := unsupported(req, false); err != nil {
+		return Result{}, err
+	}
+	if b.db == nil {
+		return Result{}, fmt.Errorf("the trigram search needs a connection pool")
+	}
+	threshold := defaultTrigramThreshold
+	if b.threshold > 0 {
+		threshold = b.threshold
+	}
+
+	// the <% operator only uses the index with the threshold of the session, so it is
+	// set local to a transaction and the other connections of the pool keep theirs
+	tx, err := b.db.Begin(ctx)
+	if err != nil {
+		return Result{}, databaseError("failed to start the trigram search", err)
+	}
+	defer tx.Rollback(ctx)
+
+	queries := database.New(tx)
+	if err := queries.SetTrigramThreshold(ctx, threshold); err != nil {
+		return Result{}, databaseError("failed to set the trigram threshold", err)
+	}
+	rows, err := queries.SearchMoviesTrigram(ctx, database.SearchMoviesTrigramParams{
+		Query:      req.Query,
+		MaxResults: b.limit(req),
+	})
+	if err != nil {
+		return Result{}, databaseError("failed to search by trigram similarity", err)
+	}
+
+	hits := make([]Hit, 0, len(rows))
+	for _, row := range rows {
+		hits = append(hits, movieHit(movieData(trigramMovie(row)), row.Score))
+	}
+	return Result{Hits: hits}, nil
+}
+
+// the columns of a movie the queries select, the search_vector stays in the database.
+// the rows of the other queries selecting them convert to it as they have the same fields
+type movieRow = database.GetMovieByMovieIDRow
+
+// the movie of a row ranked by the full text search
+func ftsMovie(row database.SearchMoviesFTSRow) movieRow {
+	return movieRow{
+		Adult:              row.Adult,
+		BackdropPath:       row.BackdropPath,
+		GenreIds:           row.GenreIds,
+		MovieID:            row.MovieID,
+		MovieLanguage:      row.MovieLanguage,
+		MovieOriginalTitle: row.MovieOriginalTitle,
+		MovieOverview:      row.MovieOverview,
+		Popularity:         row.Popularity,
+		PosterPath:         row.PosterPath,
+		ReleaseDate:        row.ReleaseDate,
+		MovieTitle:         row.MovieTitle,
+		Video:              row.Video,
+		VoteAverage:        row.VoteAverage,
+		VoteCount:          row.VoteCount,
+	}
+}
+
+// the movie of a row ranked by the trigram similarity
+func trigramMovie(row database.SearchMoviesTrigramRow) movieRow {
+	return movieRow{
+		Adult:              row.Adult,
+		BackdropPath:       row.BackdropPath,
+		GenreIds:           row.GenreIds,
+		MovieID:            row.MovieID,
+		MovieLanguage:      row.MovieLanguage,
+		MovieOriginalTitle: row.MovieOriginalTitle,
+		MovieOverview:      row.MovieOverview,
+		Popularity:         row.Popularity,
+		PosterPath:         row.PosterPath,
+		ReleaseDate:        row.ReleaseDate,
+		MovieTitle:         row.MovieTitle,
+		Video:              row.Video,
+		VoteAverage:        row.VoteAverage,
+		VoteCount:          row.VoteCount,
+	}
+}
+
+// the movie of a row, the null columns are the zero values
+func movieData(row movieRow) common.MovieData {
+	return common.MovieData{
+		Adult:         row.Adult.Bool,
+		BackdropPath:  row.BackdropPath.String,
+		GenreIDs:      row.GenreIds,
+		ID:            row.MovieID,
+		Language:      row.MovieLanguage.String,
+		OriginalTitle: row.MovieOriginalTitle.String,
+		Overview:      row.MovieOverview.String,
+		Popularity:    row.Popularity.Float64,
+		PosterPath:    row.PosterPath.String,
+		ReleaseDate:   row.ReleaseDate.String,
+		MovieTitle:    row.MovieTitle,
+		Video:         row.Video.Bool,
+		VoteAverage:   row.VoteAverage.Float64,
+		VoteCount:     row.VoteCount.Int64,
+	}
+}
+
+func (p *Postgres) AddDocument(ctx context.Context, raw map[string]interface{}) (string, error) {
+	arg, err := p.movieParams(raw)
+	if err != nil {
+		return "", err
+	}
+	id := strconv.Itoa(int(arg.MovieID))
+
+	_, err = p.querier.GetMovieByMovieID(ctx, arg.MovieID)
+	if err == nil {
+		return id, textsearch.ErrDocumentExists
+	}
+	if !errors.Is(err, pgx.ErrNoRows) {
+		return id, databaseError("failed to look up the movie", err)
+	}
+	err = p.querier.AddMovie(ctx, arg)
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == uniqueViolation {
+		// inserted by someone else since it was looked up
+		return id, textsearch.ErrDocumentExists
+	}
+	if err != nil {
+		return id, databaseError("failed to insert the movie", err)
+	}
+	return id, nil
+}
+
+func (p *Postgres) UpsertDocument(ctx context.Context, raw map[string]interface{}) (string, bool, error) {
+	arg, err := p.movieParams(raw)
+	if err != nil {
+		return "", false, err
+	}
+	id := strconv.Itoa(int(arg.MovieID))
+
+	var created bool
+	p.querier.UpsertMovie(ctx, []database.UpsertMovieParams{database.UpsertMovieParams(arg)}).QueryRow(func(_ int, inserted bool, upsertErr error) {
+		// no rows when the stored movie has the same values, which is still an update
+		if upsertErr != nil && !errors.Is(upsertErr, pgx.ErrNoRows) {
+			err = databaseError("failed to upsert the movie", upsertErr)
+		}
+		created = inserted
+	})
+	return id, created, err
+}
+
+func (p *Postgres) DeleteDocument(ctx context.Context, id string) error {
+	movieID, err := strconv.ParseInt(id, 10, 32)
+	if err != nil {
+		return fmt.Errorf("%w: the movie id must be an integer, got: %s", textsearch.ErrDocumentNotFound, id)
+	}
+
+	deleted, err := p.querier.DeleteMovie(ctx, int32(movieID))
+	if err != nil {
+		return databaseError("failed to delete the movie", err)
+	}
+	if deleted == 0 {
+		return textsearch.ErrDocumentNotFound
+	}
+	return nil
+}
+
+// wraps the error of a query with ErrTimeout or ErrUnavailable when it is one, so a slow
+// or unreachable database can be told from a broken query
+func databaseError(msg string, err error) error {
+	var pgErr *pgconn.PgError
+	isPgErr := errors.As(err, &pgErr)
+	switch {
+	case errors.Is(err, context.DeadlineExceeded), pgconn.Timeout(err), isPgErr && pgErr.Code == queryCanceled:
+		return fmt.Errorf("%w: %s: %w", ErrTimeout, msg, err)
+	case isPgErr && unavailableCode(pgErr.Code):
+		return fmt.Errorf("%w: %s: %w", ErrUnavailable, msg, err)
+	case !isPgErr && unreachable(err):
+		return fmt.Errorf("%w: %s: %w", ErrUnavailable, msg, err)
+	}
+	return fmt.Errorf("%s: %w", msg, err)
+}
+
+// connection exceptions, too many connections, or the server shutting down or starting up
+func unavailableCode(code string) bool {
+	return strings.HasPrefix(code, "08") || code == "53300" || code == "57P01" || code == "57P02" || code == "57P03"
+}
+
+// the connection couldn't be made or was lost
+func unreachable(err error) bool {
+	var connectErr *pgconn.ConnectError
+	var netErr net.Error
+	return errors.As(err, &connectErr) || errors.As(err, &netErr) || errors.Is(err, io.ErrUnexpectedEOF)
+}
+
+// validates the document against the movies schema and converts it to its row
+func (p *Postgres) movieParams(raw map[string]interface{}) (database.AddMovieParams, error) {
+	fields, err := p.schema.Normalise(raw)
+	if err != nil {
+		return database.AddMovieParams{}, fmt.Errorf("%w: %s", ErrInvalidDocument, err)
+	}
+	movieData, err := populate.MovieFromFields(fields)
+	if err != nil {
+		return database.AddMovieParams{}, fmt.Errorf("%w: %s", ErrInvalidDocument, err)
+	}
+	return populate.MovieParams(movieData), nil
+}
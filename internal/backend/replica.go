@@ -0,0 +1,253 @@
+package backend
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"strconv"
+	"sync"
+	textsearch "textscout/inmemsearch"
+	"textscout/internal/database"
+	"textscout/internal/dataset"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// channel the movies table notifies its changes on, see migration 0005_movie_changes
+const movieChangesChannel = "movie_changes"
+
+// payload of a truncate, every movie is gone
+const allMoviesChanged = "*"
+
+// how long applying one change may take
+const applyTimeout = 5 * time.Second
+
+// longest wait between two attempts to reload the index after losing the changes
+const maxResyncBackoff = time.Minute
+
+var errMoviesTruncated = errors.New("the movies table was truncated")
+
+// replica keeps an in-memory index in sync with the movies table, which is the source of truth.
+// the index is loaded from the table and then updated with the changes the table notifies.
+// when a change can't be applied or the connection is lost, the changes may have been missed,
+// so the index is loaded again and swapped in.
+type replica struct {
+	db    *Postgres
+	owner *InMem
+	// told about the movies loaded every time the index is reloaded
+	progress textsearch.LoadProgress
+
+	cancel   context.CancelFunc
+	done     chan struct{}
+	stopOnce sync.Once
+}
+
+func newReplica(opts Options) (Backend, error) {
+	p, err := connect(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	r := &replica{db: p, progress: opts.Progress, cancel: cancel, done: make(chan struct{})}
+	b := &InMem{replica: r}
+	r.owner = b
+
+	conn, err := r.resync(ctx)
+	if err != nil {
+		cancel()
+		p.db.Close()
+		return nil, err
+	}
+	go r.follow(ctx, conn)
+	return b, nil
+}
+
+// listens for the changes and then loads the index from the table. the changes made while
+// it loads wait on the connection and are applied after, applying one twice is harmless.
+func (r *replica) resync(ctx context.Context) (*pgx.Conn, error) {
+	conn, err := pgx.ConnectConfig(ctx, r.db.db.Config().ConnConfig.Copy())
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to listen for the movie changes: %w", err)
+	}
+	if _, err := conn.Exec(ctx, "LISTEN "+movieChangesChannel); err != nil {
+		conn.Close(context.Background())
+		return nil, fmt.Errorf("failed to listen for the movie changes: %w", err)
+	}
+
+	start := time.Now()
+	reader := &movieReader{ctx: ctx, querier: r.db.querier, after: math.MinInt32}
+	index, err := textsearch.NewInMemSearchFromReaderProgress(reader, r.db.schema, r.progress)
+	if err != nil {
+		conn.Close(context.Background())
+		return nil, fmt.Errorf("failed to load the movies: %w", err)
+	}
+	r.owner.index.Store(index)
+	log.Printf("loaded %d movies from the database into the index in %s", index.DocCount(), time.Since(start))
+	return conn, nil
+}
+
+func (r *replica) follow(ctx context.Context, conn *pgx.Conn) {
+	defer close(r.done)
+	for {
+		err := r.consume(ctx, conn)
+		conn.Close(context.Background())
+		if ctx.Err() != nil {
+			return
+		}
+		log.Printf("stopped following the movie changes, reloading the index: %+v", err)
+
+		if conn = r.reconnect(ctx); conn == nil {
+			return
+		}
+	}
+}
+
+// reloads the index until it succeeds or the replica is stopped, nil once stopped
+func (r *replica) reconnect(ctx context.Context) *pgx.Conn {
+	backoff := time.Second
+	for {
+		conn, err := r.resync(ctx)
+		if err == nil {
+			return conn
+		}
+		if ctx.Err() != nil {
+			return nil
+		}
+		log.Printf("failed to reload the index, retrying in %s: %+v", backoff, err)
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(backoff):
+		}
+		if backoff < maxResyncBackoff {
+			backoff *= 2
+		}
+	}
+}
+
+// applies the changes as they are notified, returns once one can't be applied
+func (r *replica) consume(ctx context.Context, conn *pgx.Conn) error {
+	for {
+		notification, err := conn.WaitForNotification(ctx)
+		if err != nil {
+			return err
+		}
+		if notification.Payload == allMoviesChanged {
+			return errMoviesTruncated
+		}
+
+		applyCtx, cancel := context.WithTimeout(ctx, applyTimeout)
+		err = r.apply(applyCtx, notification.Payload)
+		cancel()
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// reads the movie and indexes it, or drops it from the index when it is no longer stored
+func (r *replica) apply(ctx context.Context, id string) error {
+	movieID, err := strconv.ParseInt(id, 10, 32)
+	if err != nil {
+		return fmt.Errorf("unexpected movie id %q in the changes", id)
+	}
+	index := r.owner.index.Load()
+
+	movie, err := r.db.querier.GetMovieByMovieID(ctx, int32(movieID))
+	if errors.Is(err, pgx.ErrNoRows) {
+		if err := index.DeleteDocument(id); err != nil && !errors.Is(err, textsearch.ErrDocumentNotFound) {
+			return err
+		}
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read the changed movie %s: %w", id, err)
+	}
+	if _, _, err := index.UpsertDocument(movieDocument(movie)); err != nil {
+		return fmt.Errorf("failed to index the changed movie %s: %w", id, err)
+	}
+	return nil
+}
+
+func (r *replica) stop() {
+	r.stopOnce.Do(func() {
+		r.cancel()
+		<-r.done
+		r.db.db.Close()
+	})
+}
+
+// movieReader reads the movies table in pages in the order of their movie_id, so the
+// index can be built from it like from a dataset file
+type movieReader struct {
+	ctx     context.Context
+	querier database.Querier
+	page    []database.ListMoviesAfterRow
+	pos     int
+	// movie_id of the last movie read
+	after int32
+	done  bool
+}
+
+func (r *movieReader) Next(v interface{}) error {
+	if r.pos == len(r.page) {
+		if r.done {
+			return io.EOF
+		}
+		page, err := r.querier.ListMoviesAfter(r.ctx, database.ListMoviesAfterParams{
+			AfterMovieID: r.after,
+			MaxResults:   dataset.DefaultBatchSize,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to read the movies after %d: %w", r.after, err)
+		}
+		r.done = len(page) < dataset.DefaultBatchSize
+		if len(page) == 0 {
+			return io.EOF
+		}
+		r.page, r.pos = page, 0
+		r.after = page[len(page)-1].MovieID
+	}
+
+	doc, ok := v.(*map[string]interface{})
+	if !ok {
+		return fmt.Errorf("movies can only be read into a *map[string]interface{}, got: %T", v)
+	}
+	*doc = movieDocument(movieRow(r.page[r.pos]))
+	r.pos++
+	return nil
+}
+
+func (r *movieReader) Close() error {
+	return nil
+}
+
+// the fields of the movie as a document of the movies schema, the null columns are left out
+func movieDocument(m movieRow) map[string]interface{} {
+	fields := movieHit(movieData(m), 0).Fields
+	nulls := map[string]bool{
+		"adult":             !m.Adult.Valid,
+		"backdrop_path":     !m.BackdropPath.Valid,
+		"genre_ids":         m.GenreIds == nil,
+		"original_language": !m.MovieLanguage.Valid,
+		"original_title":    !m.MovieOriginalTitle.Valid,
+		"overview":          !m.MovieOverview.Valid,
+		"popularity":        !m.Popularity.Valid,
+		"poster_path":       !m.PosterPath.Valid,
+		"release_date":      !m.ReleaseDate.Valid,
+		"video":             !m.Video.Valid,
+		"vote_average":      !m.VoteAverage.Valid,
+		"vote_count":        !m.VoteCount.Valid,
+	}
+	for name, null := range nulls {
+		if null {
+			delete(fields, name)
+		}
+	}
+	return fields
+}
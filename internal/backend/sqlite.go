@@ -0,0 +1,158 @@
+package backend
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"textscout/common"
+	textsearch "textscout/inmemsearch"
+	"textscout/internal/populate"
+	"textscout/internal/sqlite"
+)
+
+const SQLite = "sqlite"
+
+// where the sqlite database is kept unless the options set a path
+const defaultSQLitePath = "textscout.db"
+
+func init() {
+	Register(SQLite, func(opts Options) (Backend, error) {
+		if opts.Schema.Name != common.DefaultMovieSchema().Name {
+			return nil, fmt.Errorf("the sqlite database only stores movies, schema %s can only be searched by the inmemIndex", opts.Schema.Name)
+		}
+		path := opts.SQLitePath
+		if path == "" {
+			path = defaultSQLitePath
+		}
+		db, err := sqlite.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		return NewSQLiteFTS(db, opts.Schema), nil
+	})
+}
+
+// SQLiteFTS is the full text search of the title and overview of the movies in an embedded
+// sqlite database, loaded with insertData like postgres. the movies are ranked by bm25
+// and the hits carry the title and overview with the matched words highlighted.
+type SQLiteFTS struct {
+	db     *sqlite.DB
+	schema *common.Schema
+}
+
+func NewSQLiteFTS(db *sqlite.DB, schema *common.Schema) *SQLiteFTS {
+	return &SQLiteFTS{db: db, schema: schema}
+}
+
+// closes the database, the backend can't be used after
+func (b *SQLiteFTS) Close() error {
+	return b.db.Close()
+}
+
+func (b *SQLiteFTS) Search(ctx context.Context, req Request) (Result, error) {
+	if err := unsupported(req, true); err != nil {
+		return Result{}, err
+	}
+	limit := req.Limit
+	if limit <= 0 {
+		limit = databaseResultLimit
+	}
+	rows, err := b.db.Search(ctx, req.Query, req.Union, limit)
+	if err != nil && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		// the driver interrupts the query, its error doesn't say why
+		return Result{}, fmt.Errorf("%w: failed to search sqlite: %w", ErrTimeout, err)
+	}
+	if err != nil {
+		return Result{}, fmt.Errorf("failed to search sqlite: %w", err)
+	}
+
+	hits := make([]Hit, 0, len(rows))
+	for _, row := range rows {
+		hit := movieHit(row.Movie, row.Score)
+		// a snippet of a field without a match is only its start, so it isn't a highlight
+		hit.Highlights = map[string]string{}
+		if strings.Contains(row.TitleSnippet, "<em>") {
+			hit.Highlights["title"] = row.TitleSnippet
+		}
+		if strings.Contains(row.OverviewSnippet, "<em>") {
+			hit.Highlights["overview"] = row.OverviewSnippet
+		}
+		hits = append(hits, hit)
+	}
+	return Result{Hits: hits}, nil
+}
+
+func (b *SQLiteFTS) Stats(ctx context.Context) (Stats, error) {
+	count, err := b.db.CountMovies(ctx)
+	if err != nil {
+		return Stats{}, fmt.Errorf("failed to count the movies: %w", err)
+	}
+	return Stats{Documents: count}, nil
+}
+
+func (b *SQLiteFTS) DocCount() int {
+	count, err := b.db.CountMovies(context.Background())
+	if err != nil {
+		return 0
+	}
+	return count
+}
+
+func (b *SQLiteFTS) AddDocument(ctx context.Context, raw map[string]interface{}) (string, error) {
+	movie, err := b.movie(raw)
+	if err != nil {
+		return "", err
+	}
+	id := strconv.Itoa(int(movie.ID))
+
+	err = b.db.AddMovie(ctx, movie)
+	if errors.Is(err, sqlite.ErrMovieExists) {
+		return id, textsearch.ErrDocumentExists
+	}
+	return id, err
+}
+
+func (b *SQLiteFTS) UpsertDocument(ctx context.Context, raw map[string]interface{}) (string, bool, error) {
+	movie, err := b.movie(raw)
+	if err != nil {
+		return "", false, err
+	}
+	id := strconv.Itoa(int(movie.ID))
+
+	counts, err := b.db.UpsertMovies(ctx, []common.MovieData{movie})
+	if err != nil {
+		return id, false, err
+	}
+	return id, counts.Inserted == 1, nil
+}
+
+func (b *SQLiteFTS) DeleteDocument(ctx context.Context, id string) error {
+	movieID, err := strconv.ParseInt(id, 10, 32)
+	if err != nil {
+		return fmt.Errorf("%w: the movie id must be an integer, got: %s", textsearch.ErrDocumentNotFound, id)
+	}
+
+	deleted, err := b.db.DeleteMovie(ctx, int32(movieID))
+	if err != nil {
+		return err
+	}
+	if !deleted {
+		return textsearch.ErrDocumentNotFound
+	}
+	return nil
+}
+
+// validates the document against the movies schema and converts it to the movie stored
+func (b *SQLiteFTS) movie(raw map[string]interface{}) (common.MovieData, error) {
+	fields, err := b.schema.Normalise(raw)
+	if err != nil {
+		return common.MovieData{}, fmt.Errorf("%w: %s", ErrInvalidDocument, err)
+	}
+	movie, err := populate.MovieFromFields(fields)
+	if err != nil {
+		return common.MovieData{}, fmt.Errorf("%w: %s", ErrInvalidDocument, err)
+	}
+	return movie, nil
+}
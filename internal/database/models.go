@@ -24,4 +24,5 @@ type Movie struct {
 	Video              pgtype.Bool
 	VoteAverage        pgtype.Float8
 	VoteCount          pgtype.Int8
+	SearchVector       interface{}
 }
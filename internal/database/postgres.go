@@ -3,6 +3,7 @@ package database
 import (
 	"context"
 	"fmt"
+	"textscout/common"
 	"time"
 
 	"github.com/jackc/pgx/v5/pgxpool"
@@ -12,28 +13,48 @@ type Postgres struct {
 	DB *pgxpool.Pool
 }
 
-func NewPostgres(dbname, user, password string) (*Postgres, error) {
-	connStr := fmt.Sprintf("postgresql://%s:%s@localhost/%s?sslmode=disable", user, password, dbname)
-	dbpool, err := pgxpool.New(context.Background(), connStr)
+// how long to wait for postgres to answer when the config doesn't say
+const (
+	defaultConnectTimeout = 10 * time.Second
+	defaultPingInterval   = time.Second
+)
 
+func NewPostgres(config common.ConnConfig) (*Postgres, error) {
+	poolConfig, err := config.PoolConfig()
+	if err != nil {
+		return nil, err
+	}
+	dbpool, err := pgxpool.NewWithConfig(context.Background(), poolConfig)
 	if err != nil {
 		return nil, err
 	}
 
-	// try connecting to the database
-	ticker := time.NewTicker(time.Second)
-	timeoutExceeded := time.NewTimer(10 * time.Second)
+	connectTimeout, pingInterval := config.ConnectTimeout, config.PingInterval
+	if connectTimeout == 0 {
+		connectTimeout = defaultConnectTimeout
+	}
+	if pingInterval == 0 {
+		pingInterval = defaultPingInterval
+	}
+
+	// try connecting to the database until it answers or the timeout passes, a ping
+	// hanging on an unreachable host is cut short by the timeout too
+	ctx, cancel := context.WithTimeout(context.Background(), connectTimeout)
+	defer cancel()
+	if err = dbpool.Ping(ctx); err == nil {
+		return &Postgres{DB: dbpool}, nil
+	}
+	ticker := time.NewTicker(pingInterval)
+	defer ticker.Stop()
 
 	for {
 		select {
-		case <-timeoutExceeded.C:
-			ticker.Stop()
-			timeoutExceeded.Stop()
-			return nil, fmt.Errorf("connection timeout")
+		case <-ctx.Done():
+			dbpool.Close()
+			return nil, fmt.Errorf("connection timeout, postgres didn't answer within %s: %w", connectTimeout, err)
 
 		case <-ticker.C:
-			if err := dbpool.Ping(context.Background()); err == nil {
-				timeoutExceeded.Stop()
+			if err = dbpool.Ping(ctx); err == nil {
 				return &Postgres{DB: dbpool}, nil
 			}
 		}
@@ -6,15 +6,21 @@ package database
 
 import (
 	"context"
-
-	"github.com/jackc/pgx/v5/pgtype"
 )
 
 type Querier interface {
 	AddMovie(ctx context.Context, arg AddMovieParams) error
-	GetMovieByDesc(ctx context.Context, dollar_1 pgtype.Text) ([]Movie, error)
-	GetMovieByTitle(ctx context.Context, dollar_1 pgtype.Text) ([]Movie, error)
-	GetMovieByTitleAndDesc(ctx context.Context, arg GetMovieByTitleAndDescParams) ([]Movie, error)
+	CountMovies(ctx context.Context) (int64, error)
+	DeleteMovie(ctx context.Context, movieID int32) (int64, error)
+	GetMovieByDesc(ctx context.Context, arg GetMovieByDescParams) ([]GetMovieByDescRow, error)
+	GetMovieByMovieID(ctx context.Context, movieID int32) (GetMovieByMovieIDRow, error)
+	GetMovieByTitle(ctx context.Context, arg GetMovieByTitleParams) ([]GetMovieByTitleRow, error)
+	GetMovieByTitleAndDesc(ctx context.Context, arg GetMovieByTitleAndDescParams) ([]GetMovieByTitleAndDescRow, error)
+	ListMoviesAfter(ctx context.Context, arg ListMoviesAfterParams) ([]ListMoviesAfterRow, error)
+	SearchMoviesFTS(ctx context.Context, arg SearchMoviesFTSParams) ([]SearchMoviesFTSRow, error)
+	SearchMoviesTrigram(ctx context.Context, arg SearchMoviesTrigramParams) ([]SearchMoviesTrigramRow, error)
+	SetTrigramThreshold(ctx context.Context, threshold float64) error
+	UpsertMovie(ctx context.Context, arg []UpsertMovieParams) *UpsertMovieBatchResults
 }
 
 var _ Querier = (*Queries)(nil)
@@ -57,21 +57,65 @@ func (q *Queries) AddMovie(ctx context.Context, arg AddMovieParams) error {
 	return err
 }
 
+const countMovies = `-- name: CountMovies :one
+SELECT count(*) FROM movies
+`
+
+func (q *Queries) CountMovies(ctx context.Context) (int64, error) {
+	row := q.db.QueryRow(ctx, countMovies)
+	var count int64
+	err := row.Scan(&count)
+	return count, err
+}
+
+const deleteMovie = `-- name: DeleteMovie :execrows
+DELETE FROM movies WHERE movie_id = $1
+`
+
+func (q *Queries) DeleteMovie(ctx context.Context, movieID int32) (int64, error) {
+	result, err := q.db.Exec(ctx, deleteMovie, movieID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
 const getMovieByDesc = `-- name: GetMovieByDesc :many
-SELECT id, adult, backdrop_path, genre_ids, movie_id, movie_language, movie_original_title, movie_overview, popularity, poster_path, release_date, movie_title, video, vote_average, vote_count FROM movies WHERE LOWER(movie_overview) LIKE LOWER('%' || $1 || '%') LIMIT 5
+SELECT adult, backdrop_path, genre_ids, movie_id, movie_language, movie_original_title, movie_overview, popularity, poster_path, release_date, movie_title, video, vote_average, vote_count FROM movies WHERE LOWER(movie_overview) LIKE LOWER('%' || $1 || '%') LIMIT $2
 `
 
-func (q *Queries) GetMovieByDesc(ctx context.Context, dollar_1 pgtype.Text) ([]Movie, error) {
-	rows, err := q.db.Query(ctx, getMovieByDesc, dollar_1)
+type GetMovieByDescParams struct {
+	Column1 pgtype.Text
+	Limit   int32
+}
+
+type GetMovieByDescRow struct {
+	Adult              pgtype.Bool
+	BackdropPath       pgtype.Text
+	GenreIds           []int32
+	MovieID            int32
+	MovieLanguage      pgtype.Text
+	MovieOriginalTitle pgtype.Text
+	MovieOverview      pgtype.Text
+	Popularity         pgtype.Float8
+	PosterPath         pgtype.Text
+	ReleaseDate        pgtype.Text
+	MovieTitle         string
+	Video              pgtype.Bool
+	VoteAverage        pgtype.Float8
+	VoteCount          pgtype.Int8
+}
+
+func (q *Queries) GetMovieByDesc(ctx context.Context, arg GetMovieByDescParams) ([]GetMovieByDescRow, error) {
+	rows, err := q.db.Query(ctx, getMovieByDesc, arg.Column1, arg.Limit)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
-	var items []Movie
+	var items []GetMovieByDescRow
 	for rows.Next() {
-		var i Movie
+		var i GetMovieByDescRow
 		if err := rows.Scan(
-			&i.ID,
 			&i.Adult,
 			&i.BackdropPath,
 			&i.GenreIds,
@@ -97,21 +141,85 @@ func (q *Queries) GetMovieByDesc(ctx context.Context, dollar_1 pgtype.Text) ([]M
 	return items, nil
 }
 
+const getMovieByMovieID = `-- name: GetMovieByMovieID :one
+SELECT adult, backdrop_path, genre_ids, movie_id, movie_language, movie_original_title, movie_overview, popularity, poster_path, release_date, movie_title, video, vote_average, vote_count FROM movies WHERE movie_id = $1 LIMIT 1
+`
+
+type GetMovieByMovieIDRow struct {
+	Adult              pgtype.Bool
+	BackdropPath       pgtype.Text
+	GenreIds           []int32
+	MovieID            int32
+	MovieLanguage      pgtype.Text
+	MovieOriginalTitle pgtype.Text
+	MovieOverview      pgtype.Text
+	Popularity         pgtype.Float8
+	PosterPath         pgtype.Text
+	ReleaseDate        pgtype.Text
+	MovieTitle         string
+	Video              pgtype.Bool
+	VoteAverage        pgtype.Float8
+	VoteCount          pgtype.Int8
+}
+
+func (q *Queries) GetMovieByMovieID(ctx context.Context, movieID int32) (GetMovieByMovieIDRow, error) {
+	row := q.db.QueryRow(ctx, getMovieByMovieID, movieID)
+	var i GetMovieByMovieIDRow
+	err := row.Scan(
+		&i.Adult,
+		&i.BackdropPath,
+		&i.GenreIds,
+		&i.MovieID,
+		&i.MovieLanguage,
+		&i.MovieOriginalTitle,
+		&i.MovieOverview,
+		&i.Popularity,
+		&i.PosterPath,
+		&i.ReleaseDate,
+		&i.MovieTitle,
+		&i.Video,
+		&i.VoteAverage,
+		&i.VoteCount,
+	)
+	return i, err
+}
+
 const getMovieByTitle = `-- name: GetMovieByTitle :many
-SELECT id, adult, backdrop_path, genre_ids, movie_id, movie_language, movie_original_title, movie_overview, popularity, poster_path, release_date, movie_title, video, vote_average, vote_count FROM movies WHERE LOWER(movie_title) LIKE LOWER('%' || $1 || '%') LIMIT 5
+SELECT adult, backdrop_path, genre_ids, movie_id, movie_language, movie_original_title, movie_overview, popularity, poster_path, release_date, movie_title, video, vote_average, vote_count FROM movies WHERE LOWER(movie_title) LIKE LOWER('%' || $1 || '%') LIMIT $2
 `
 
-func (q *Queries) GetMovieByTitle(ctx context.Context, dollar_1 pgtype.Text) ([]Movie, error) {
-	rows, err := q.db.Query(ctx, getMovieByTitle, dollar_1)
+type GetMovieByTitleParams struct {
+	Column1 pgtype.Text
+	Limit   int32
+}
+
+type GetMovieByTitleRow struct {
+	Adult              pgtype.Bool
+	BackdropPath       pgtype.Text
+	GenreIds           []int32
+	MovieID            int32
+	MovieLanguage      pgtype.Text
+	MovieOriginalTitle pgtype.Text
+	MovieOverview      pgtype.Text
+	Popularity         pgtype.Float8
+	PosterPath         pgtype.Text
+	ReleaseDate        pgtype.Text
+	MovieTitle         string
+	Video              pgtype.Bool
+	VoteAverage        pgtype.Float8
+	VoteCount          pgtype.Int8
+}
+
+func (q *Queries) GetMovieByTitle(ctx context.Context, arg GetMovieByTitleParams) ([]GetMovieByTitleRow, error) {
+	rows, err := q.db.Query(ctx, getMovieByTitle, arg.Column1, arg.Limit)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
-	var items []Movie
+	var items []GetMovieByTitleRow
 	for rows.Next() {
-		var i Movie
+		var i GetMovieByTitleRow
 		if err := rows.Scan(
-			&i.ID,
 			&i.Adult,
 			&i.BackdropPath,
 			&i.GenreIds,
@@ -138,25 +246,42 @@ func (q *Queries) GetMovieByTitle(ctx context.Context, dollar_1 pgtype.Text) ([]
 }
 
 const getMovieByTitleAndDesc = `-- name: GetMovieByTitleAndDesc :many
-SELECT id, adult, backdrop_path, genre_ids, movie_id, movie_language, movie_original_title, movie_overview, popularity, poster_path, release_date, movie_title, video, vote_average, vote_count FROM movies WHERE LOWER(movie_title) LIKE LOWER('%' || $1 || '%') AND LOWER(movie_overview) LIKE LOWER('%' || $2 || '%') LIMIT 5
+SELECT adult, backdrop_path, genre_ids, movie_id, movie_language, movie_original_title, movie_overview, popularity, poster_path, release_date, movie_title, video, vote_average, vote_count FROM movies WHERE LOWER(movie_title) LIKE LOWER('%' || $1 || '%') AND LOWER(movie_overview) LIKE LOWER('%' || $2 || '%') LIMIT $3
 `
 
 type GetMovieByTitleAndDescParams struct {
 	Column1 pgtype.Text
 	Column2 pgtype.Text
+	Limit   int32
 }
 
-func (q *Queries) GetMovieByTitleAndDesc(ctx context.Context, arg GetMovieByTitleAndDescParams) ([]Movie, error) {
-	rows, err := q.db.Query(ctx, getMovieByTitleAndDesc, arg.Column1, arg.Column2)
+type GetMovieByTitleAndDescRow struct {
+	Adult              pgtype.Bool
+	BackdropPath       pgtype.Text
+	GenreIds           []int32
+	MovieID            int32
+	MovieLanguage      pgtype.Text
+	MovieOriginalTitle pgtype.Text
+	MovieOverview      pgtype.Text
+	Popularity         pgtype.Float8
+	PosterPath         pgtype.Text
+	ReleaseDate        pgtype.Text
+	MovieTitle         string
+	Video              pgtype.Bool
+	VoteAverage        pgtype.Float8
+	VoteCount          pgtype.Int8
+}
+
+func (q *Queries) GetMovieByTitleAndDesc(ctx context.Context, arg GetMovieByTitleAndDescParams) ([]GetMovieByTitleAndDescRow, error) {
+	rows, err := q.db.Query(ctx, getMovieByTitleAndDesc, arg.Column1, arg.Column2, arg.Limit)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
-	var items []Movie
+	var items []GetMovieByTitleAndDescRow
 	for rows.Next() {
-		var i Movie
+		var i GetMovieByTitleAndDescRow
 		if err := rows.Scan(
-			&i.ID,
 			&i.Adult,
 			&i.BackdropPath,
 			&i.GenreIds,
@@ -181,3 +306,211 @@ func (q *Queries) GetMovieByTitleAndDesc(ctx context.Context, arg GetMovieByTitl
 	}
 	return items, nil
 }
+
+const listMoviesAfter = `-- name: ListMoviesAfter :many
+SELECT adult, backdrop_path, genre_ids, movie_id, movie_language, movie_original_title, movie_overview, popularity, poster_path, release_date, movie_title, video, vote_average, vote_count FROM movies WHERE movie_id > $1 ORDER BY movie_id LIMIT $2
+`
+
+type ListMoviesAfterParams struct {
+	AfterMovieID int32
+	MaxResults   int32
+}
+
+type ListMoviesAfterRow struct {
+	Adult              pgtype.Bool
+	BackdropPath       pgtype.Text
+	GenreIds           []int32
+	MovieID            int32
+	MovieLanguage      pgtype.Text
+	MovieOriginalTitle pgtype.Text
+	MovieOverview      pgtype.Text
+	Popularity         pgtype.Float8
+	PosterPath         pgtype.Text
+	ReleaseDate        pgtype.Text
+	MovieTitle         string
+	Video              pgtype.Bool
+	VoteAverage        pgtype.Float8
+	VoteCount          pgtype.Int8
+}
+
+func (q *Queries) ListMoviesAfter(ctx context.Context, arg ListMoviesAfterParams) ([]ListMoviesAfterRow, error) {
+	rows, err := q.db.Query(ctx, listMoviesAfter, arg.AfterMovieID, arg.MaxResults)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ListMoviesAfterRow
+	for rows.Next() {
+		var i ListMoviesAfterRow
+		if err := rows.Scan(
+			&i.Adult,
+			&i.BackdropPath,
+			&i.GenreIds,
+			&i.MovieID,
+			&i.MovieLanguage,
+			&i.MovieOriginalTitle,
+			&i.MovieOverview,
+			&i.Popularity,
+			&i.PosterPath,
+			&i.ReleaseDate,
+			&i.MovieTitle,
+			&i.Video,
+			&i.VoteAverage,
+			&i.VoteCount,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const searchMoviesFTS = `-- name: SearchMoviesFTS :many
+SELECT movies.adult, movies.backdrop_path, movies.genre_ids, movies.movie_id, movies.movie_language, movies.movie_original_title, movies.movie_overview, movies.popularity, movies.poster_path, movies.release_date, movies.movie_title, movies.video, movies.vote_average, movies.vote_count,
+    ts_rank_cd(movies.search_vector, query) AS rank
+FROM movies, websearch_to_tsquery('english', $1::text) AS query
+WHERE movies.search_vector @@ query
+ORDER BY rank DESC, movies.movie_id
+LIMIT $2
+`
+
+type SearchMoviesFTSParams struct {
+	Query      string
+	MaxResults int32
+}
+
+type SearchMoviesFTSRow struct {
+	Adult              pgtype.Bool
+	BackdropPath       pgtype.Text
+	GenreIds           []int32
+	MovieID            int32
+	MovieLanguage      pgtype.Text
+	MovieOriginalTitle pgtype.Text
+	MovieOverview      pgtype.Text
+	Popularity         pgtype.Float8
+	PosterPath         pgtype.Text
+	ReleaseDate        pgtype.Text
+	MovieTitle         string
+	Video              pgtype.Bool
+	VoteAverage        pgtype.Float8
+	VoteCount          pgtype.Int8
+	Rank               float32
+}
+
+func (q *Queries) SearchMoviesFTS(ctx context.Context, arg SearchMoviesFTSParams) ([]SearchMoviesFTSRow, error) {
+	rows, err := q.db.Query(ctx, searchMoviesFTS, arg.Query, arg.MaxResults)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []SearchMoviesFTSRow
+	for rows.Next() {
+		var i SearchMoviesFTSRow
+		if err := rows.Scan(
+			&i.Adult,
+			&i.BackdropPath,
+			&i.GenreIds,
+			&i.MovieID,
+			&i.MovieLanguage,
+			&i.MovieOriginalTitle,
+			&i.MovieOverview,
+			&i.Popularity,
+			&i.PosterPath,
+			&i.ReleaseDate,
+			&i.MovieTitle,
+			&i.Video,
+			&i.VoteAverage,
+			&i.VoteCount,
+			&i.Rank,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const searchMoviesTrigram = `-- name: SearchMoviesTrigram :many
+SELECT movies.adult, movies.backdrop_path, movies.genre_ids, movies.movie_id, movies.movie_language, movies.movie_original_title, movies.movie_overview, movies.popularity, movies.poster_path, movies.release_date, movies.movie_title, movies.video, movies.vote_average, movies.vote_count,
+    GREATEST(word_similarity(LOWER($1::text), LOWER(movies.movie_title)),
+        word_similarity(LOWER($1::text), LOWER(movies.movie_overview)))::float8 AS score
+FROM movies
+WHERE LOWER($1::text) <% LOWER(movies.movie_title)
+    OR LOWER($1::text) <% LOWER(movies.movie_overview)
+ORDER BY score DESC, similarity(LOWER(movies.movie_title), LOWER($1::text)) DESC, movies.movie_id
+LIMIT $2
+`
+
+type SearchMoviesTrigramParams struct {
+	Query      string
+	MaxResults int32
+}
+
+type SearchMoviesTrigramRow struct {
+	Adult              pgtype.Bool
+	BackdropPath       pgtype.Text
+	GenreIds           []int32
+	MovieID            int32
+	MovieLanguage      pgtype.Text
+	MovieOriginalTitle pgtype.Text
+	MovieOverview      pgtype.Text
+	Popularity         pgtype.Float8
+	PosterPath         pgtype.Text
+	ReleaseDate        pgtype.Text
+	MovieTitle         string
+	Video              pgtype.Bool
+	VoteAverage        pgtype.Float8
+	VoteCount          pgtype.Int8
+	Score              float64
+}
+
+func (q *Queries) SearchMoviesTrigram(ctx context.Context, arg SearchMoviesTrigramParams) ([]SearchMoviesTrigramRow, error) {
+	rows, err := q.db.Query(ctx, searchMoviesTrigram, arg.Query, arg.MaxResults)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []SearchMoviesTrigramRow
+	for rows.Next() {
+		var i SearchMoviesTrigramRow
+		if err := rows.Scan(
+			&i.Adult,
+			&i.BackdropPath,
+			&i.GenreIds,
+			&i.MovieID,
+			&i.MovieLanguage,
+			&i.MovieOriginalTitle,
+			&i.MovieOverview,
+			&i.Popularity,
+			&i.PosterPath,
+			&i.ReleaseDate,
+			&i.MovieTitle,
+			&i.Video,
+			&i.VoteAverage,
+			&i.VoteCount,
+			&i.Score,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const setTrigramThreshold = `-- name: SetTrigramThreshold :exec
+SELECT set_config('pg_trgm.word_similarity_threshold', $1::float8::text, true)
+`
+
+func (q *Queries) SetTrigramThreshold(ctx context.Context, threshold float64) error {
+	_, err := q.db.Exec(ctx, setTrigramThreshold, threshold)
+	return err
+}
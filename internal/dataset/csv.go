@@ -0,0 +1,161 @@
+package dataset
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"textscout/common"
+	"time"
+)
+
+// layouts the dates of a csv are commonly written in, they are stored as YYYY-MM-DD
+var dateLayouts = []string{
+	"2006-01-02",
+	"2006/01/02",
+	"02-01-2006",
+	"01/02/2006",
+	"2006-01-02 15:04:05",
+	time.RFC3339,
+}
+
+// csvReader reads a csv with a header row, one document per row. Every column is
+// mapped to a schema field by its header and its text parsed to the type of the field.
+type csvReader struct {
+	file   *os.File
+	reader *csv.Reader
+	schema *common.Schema
+	// schema field of every column, nil for the columns which aren't part of the schema
+	columns []*common.FieldMapping
+}
+
+func openCSV(source Source, schema *common.Schema) (*csvReader, error) {
+	if schema == nil {
+		schema = common.DefaultMovieSchema()
+	}
+	fd, err := os.Open(source.Path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open the file: %w", err)
+	}
+
+	r := &csvReader{file: fd, reader: csv.NewReader(bufio.NewReaderSize(fd, 1<<20)), schema: schema}
+	r.reader.ReuseRecord = true
+	header, err := r.reader.Read()
+	if err != nil {
+		fd.Close()
+		return nil, fmt.Errorf("failed to read the csv header: %w", err)
+	}
+	if r.columns, err = mapColumns(header, source.HeaderMap, schema); err != nil {
+		fd.Close()
+		return nil, err
+	}
+	return r, nil
+}
+
+func mapColumns(header []string, headerMap map[string]string, schema *common.Schema) ([]*common.FieldMapping, error) {
+	columns := make([]*common.FieldMapping, len(header))
+	mapped := 0
+	for i, h := range header {
+		// excel starts the file with a byte order mark
+		h = strings.TrimSpace(strings.TrimPrefix(h, "\ufeff"))
+		name, ok := headerMap[h]
+		if !ok {
+			name = strings.ReplaceAll(strings.ToLower(h), " ", "_")
+		}
+		f, ok := schema.Field(name)
+		if !ok {
+			if _, listed := headerMap[h]; listed {
+				return nil, fmt.Errorf("csv header %s is mapped to %s which isn't a field of the schema %s", h, name, schema.Name)
+			}
+			continue
+		}
+		columns[i] = &f
+		mapped++
+	}
+	if mapped == 0 {
+		return nil, fmt.Errorf("none of the csv headers %v are fields of the schema %s", header, schema.Name)
+	}
+	return columns, nil
+}
+
+func (r *csvReader) Close() error {
+	return r.file.Close()
+}
+
+func (r *csvReader) Next(v interface{}) error {
+	record, err := r.reader.Read()
+	if err == io.EOF {
+		return io.EOF
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read the csv: %w", err)
+	}
+	line, _ := r.reader.FieldPos(0)
+
+	raw := make(map[string]interface{}, len(record))
+	for i, cell := range record {
+		if i >= len(r.columns) || r.columns[i] == nil {
+			continue
+		}
+		value, err := parseCell(*r.columns[i], strings.TrimSpace(cell))
+		if err != nil {
+			return fmt.Errorf("line %d: %w", line, err)
+		}
+		if value != nil {
+			raw[r.columns[i].Name] = value
+		}
+	}
+
+	// converts the text of the numbers and booleans
+	doc, err := r.schema.Normalise(raw)
+	if err != nil {
+		return fmt.Errorf("line %d: %w", line, err)
+	}
+	return assign(doc, v)
+}
+
+// the text of the cell in the shape Normalise expects, nil for an empty cell.
+// arrays are either json, i.e [28, 12], or values separated by | or ,
+func parseCell(f common.FieldMapping, cell string) (interface{}, error) {
+	if cell == "" {
+		return nil, nil
+	}
+	if !f.Array {
+		return parseScalar(f, cell)
+	}
+
+	if strings.HasPrefix(cell, "[") {
+		var values []interface{}
+		dec := json.NewDecoder(strings.NewReader(cell))
+		dec.UseNumber()
+		if err := dec.Decode(&values); err != nil {
+			return nil, fmt.Errorf("field %s must be an array, got: %s", f.Name, cell)
+		}
+		return values, nil
+	}
+
+	values := make([]interface{}, 0)
+	for _, part := range strings.FieldsFunc(cell, func(r rune) bool { return r == '|' || r == ',' }) {
+		value, err := parseScalar(f, strings.TrimSpace(part))
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+	}
+	return values, nil
+}
+
+func parseScalar(f common.FieldMapping, cell string) (interface{}, error) {
+	if f.Type != common.DateFieldType {
+		return cell, nil
+	}
+	for _, layout := range dateLayouts {
+		if t, err := time.Parse(layout, cell); err == nil {
+			return t.Format("2006-01-02"), nil
+		}
+	}
+	return nil, fmt.Errorf("field %s must be a date, got: %s", f.Name, cell)
+}
@@ -0,0 +1,105 @@
+package dataset
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"textscout/common"
+)
+
+// how many documents are read before they are handed over to the index or the database
+const DefaultBatchSize = 1000
+
+type Format string
+
+const (
+	// the TMDB dumps, a json array of documents or ndjson
+	JSONFormat    Format = "json"
+	CSVFormat     Format = "csv"
+	ParquetFormat Format = "parquet"
+)
+
+// a dataset file and how to read it
+type Source struct {
+	Path string `json:"file_path,omitempty"`
+	// detected from the extension of the path when empty, json unless it is .csv or .parquet
+	Format Format `json:"format,omitempty"`
+	// csv header to the name of the schema field its column holds. headers named
+	// after a field, ignoring case and with spaces as underscores, don't need to be listed
+	HeaderMap map[string]string `json:"csv_header_map,omitempty"`
+}
+
+// Reader streams the documents of a dataset
+type Reader interface {
+	// decodes the next document into v, io.EOF once there are no more documents.
+	// a *map[string]interface{} gets the values as they are read, json.Number for the
+	// numbers of a json file, anything else is filled as if the document was json.
+	Next(v interface{}) error
+	Close() error
+}
+
+// ParseFormat validates the name of a format, an empty one is detected from the file extension
+func ParseFormat(name string) (Format, error) {
+	switch f := Format(strings.ToLower(name)); f {
+	case "", JSONFormat, CSVFormat, ParquetFormat:
+		return f, nil
+	}
+	return "", fmt.Errorf("format must be json, csv or parquet, got: %q", name)
+}
+
+// ParseHeaderMap parses header=field pairs separated by commas, i.e "Title=title,Language=original_language"
+func ParseHeaderMap(pairs string) (map[string]string, error) {
+	headerMap := make(map[string]string)
+	if strings.TrimSpace(pairs) == "" {
+		return headerMap, nil
+	}
+	for _, pair := range strings.Split(pairs, ",") {
+		header, field, ok := strings.Cut(pair, "=")
+		if !ok || strings.TrimSpace(header) == "" || strings.TrimSpace(field) == "" {
+			return nil, fmt.Errorf("expected header=field, got: %q", pair)
+		}
+		headerMap[strings.TrimSpace(header)] = strings.TrimSpace(field)
+	}
+	return headerMap, nil
+}
+
+func (s Source) format() Format {
+	if s.Format != "" {
+		return s.Format
+	}
+	switch strings.ToLower(filepath.Ext(s.Path)) {
+	case ".csv":
+		return CSVFormat
+	case ".parquet":
+		return ParquetFormat
+	}
+	return JSONFormat
+}
+
+// Open starts reading the dataset, the schema is used to parse the text of the csv
+// cells to the types of the fields.
+func Open(source Source, schema *common.Schema) (Reader, error) {
+	switch source.format() {
+	case CSVFormat:
+		return openCSV(source, schema)
+	case ParquetFormat:
+		return openParquet(source.Path)
+	case JSONFormat:
+		return openJSON(source.Path)
+	}
+	return nil, fmt.Errorf("unknown format: %q", source.Format)
+}
+
+// hands over a document read as a map to the v of Reader.Next
+func assign(doc map[string]interface{}, v interface{}) error {
+	if m, ok := v.(*map[string]interface{}); ok {
+		*m = doc
+		return nil
+	}
+	jsonBytes, err := json.Marshal(doc)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(jsonBytes, v)
+}
@@ -0,0 +1,293 @@
+package dataset
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"textscout/common"
+	"time"
+
+	"github.com/xitongsys/parquet-go-source/local"
+	"github.com/xitongsys/parquet-go/writer"
+)
+
+func TestReader(t *testing.T) {
+	datasets := map[string]string{
+		"tmdb":   `{"page": 1, "results": [{"id": 1, "title": "Godzilla"}, {"id": 2, "title": "Kong"}], "total_pages": 1}`,
+		"array":  `[{"id": 1, "title": "Godzilla"}, {"id": 2, "title": "Kong"}]`,
+		"ndjson": "{\"id\": 1, \"title\": \"Godzilla\"}\n\n{\"id\": 2, \"title\": \"Kong\"}\n",
+	}
+
+	for name, content := range datasets {
+		filePath := filepath.Join(t.TempDir(), name+".json")
+		if err := os.WriteFile(filePath, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		reader, err := Open(Source{Path: filePath}, nil)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+
+		docs := make([]map[string]interface{}, 0)
+		for {
+			var doc map[string]interface{}
+			err := reader.Next(&doc)
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Fatalf("%s: %v", name, err)
+			}
+			docs = append(docs, doc)
+		}
+		reader.Close()
+
+		if len(docs) != 2 {
+			t.Fatalf("%s: expected 2 documents, got: %+v", name, docs)
+		}
+		if docs[0]["id"] != json.Number("1") || docs[1]["title"] != "Kong" {
+			t.Errorf("%s: expected godzilla and kong, got: %+v", name, docs)
+		}
+	}
+
+}
+
+func TestCSVReader(t *testing.T) {
+	content := "\ufeffMovie ID,title,Genres,release_date,vote_average,adult\n" +
+		"1,Godzilla,28|878,05/16/2014,6.3,false\n" +
+		"2,\"Kong, Skull Island\",[28],2017-03-08,,\n"
+	filePath := filepath.Join(t.TempDir(), "movies.csv")
+	if err := os.WriteFile(filePath, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	source := Source{Path: filePath, HeaderMap: map[string]string{"Movie ID": "id", "Genres": "genre_ids"}}
+	reader, err := Open(source, common.DefaultMovieSchema())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+
+	var doc map[string]interface{}
+	if err := reader.Next(&doc); err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]interface{}{
+		"id":           int64(1),
+		"title":        "Godzilla",
+		"genre_ids":    []interface{}{int64(28), int64(878)},
+		"release_date": "2014-05-16",
+		"vote_average": 6.3,
+		"adult":        false,
+	}
+	if !reflect.DeepEqual(doc, expected) {
+		t.Errorf("expected: %+v, got: %+v", expected, doc)
+	}
+
+	// the movie data is filled as if the row was json
+	var movieData common.MovieData
+	if err := reader.Next(&movieData); err != nil {
+		t.Fatal(err)
+	}
+	if movieData.ID != 2 || movieData.MovieTitle != "Kong, Skull Island" || len(movieData.GenreIDs) != 1 || movieData.VoteAverage != 0 {
+		t.Errorf("expected kong: skull island, got: %+v", movieData)
+	}
+	if err := reader.Next(&doc); err != io.EOF {
+		t.Errorf("expected: %v, got: %v", io.EOF, err)
+	}
+
+	if _, err := Open(Source{Path: filePath, HeaderMap: map[string]string{"Genres": "genres"}}, common.DefaultMovieSchema()); err == nil {
+		t.Errorf("expected an error mapping a header to a field which isn't in the schema")
+	}
+
+}
+
+func TestParquetReader(t *testing.T) {
+	type movie struct {
+		ID       int64   `parquet:"name=id, type=INT64"`
+		Title    string  `parquet:"name=title, type=BYTE_ARRAY, convertedtype=UTF8"`
+		GenreIDs []int32 `parquet:"name=genre_ids, type=LIST, valuetype=INT32"`
+		Overview *string `parquet:"name=overview, type=BYTE_ARRAY, convertedtype=UTF8, repetitiontype=OPTIONAL"`
+	}
+	filePath := filepath.Join(t.TempDir(), "movies.parquet")
+	fw, err := local.NewLocalFileWriter(filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pw, err := writer.NewParquetWriter(fw, new(movie), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	overview := "Godzilla and Kong team up"
+	for _, m := range []movie{
+		{ID: 823464, Title: "Godzilla x Kong: The New Empire", GenreIDs: []int32{28, 878}, Overview: &overview},
+		{ID: 293167, Title: "Kong: Skull Island"},
+	} {
+		if err := pw.Write(m); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := pw.WriteStop(); err != nil {
+		t.Fatal(err)
+	}
+	fw.Close()
+
+	reader, err := Open(Source{Path: filePath}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+
+	var doc map[string]interface{}
+	if err := reader.Next(&doc); err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]interface{}{
+		"id":        int64(823464),
+		"title":     "Godzilla x Kong: The New Empire",
+		"genre_ids": []interface{}{int64(28), int64(878)},
+		"overview":  overview,
+	}
+	if !reflect.DeepEqual(doc, expected) {
+		t.Errorf("expected: %+v, got: %+v", expected, doc)
+	}
+
+	var movieData common.MovieData
+	if err := reader.Next(&movieData); err != nil {
+		t.Fatal(err)
+	}
+	if movieData.ID != 293167 || movieData.Overview != "" {
+		t.Errorf("expected kong: skull island without an overview, got: %+v", movieData)
+	}
+	if err := reader.Next(&doc); err != io.EOF {
+		t.Errorf("expected: %v, got: %v", io.EOF, err)
+	}
+
+}
+
+func TestParquetReaderListEncodings(t *testing.T) {
+	// written by arrow laid out like pyarrow: genre_ids is a LIST of list and item groups as
+	// before pyarrow 13, keywords one of list and element groups
+	reader, err := Open(Source{Path: "testdata/movies_arrow_lists.parquet"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+
+	expected := []map[string]interface{}{
+		{"id": int64(823464), "title": "Godzilla x Kong: The New Empire", "genre_ids": []interface{}{int64(28), int64(878)}, "keywords": []interface{}{"kaiju", "hollow earth"}},
+		// a null element is left out, a null list is missing
+		{"id": int64(293167), "title": "Kong: Skull Island", "genre_ids": []interface{}{int64(12)}, "keywords": []interface{}{}},
+		{"id": int64(940721), "title": "Godzilla Minus One", "keywords": []interface{}{"postwar japan"}},
+	}
+	for _, expectedDoc := range expected {
+		var doc map[string]interface{}
+		if err := reader.Next(&doc); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(doc, expectedDoc) {
+			t.Errorf("expected: %+v, got: %+v", expectedDoc, doc)
+		}
+	}
+	if err := reader.Next(&map[string]interface{}{}); err != io.EOF {
+		t.Errorf("expected: %v, got: %v", io.EOF, err)
+	}
+
+	// a map isn't silently left out
+	type movie struct {
+		ID      int64            `parquet:"name=id, type=INT64"`
+		Ratings map[string]int32 `parquet:"name=ratings, type=MAP, convertedtype=MAP, keytype=BYTE_ARRAY, keyconvertedtype=UTF8, valuetype=INT32"`
+	}
+	filePath := filepath.Join(t.TempDir(), "ratings.parquet")
+	fw, err := local.NewLocalFileWriter(filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pw, err := writer.NewParquetWriter(fw, new(movie), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := pw.Write(movie{ID: 823464, Ratings: map[string]int32{"imdb": 6}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := pw.WriteStop(); err != nil {
+		t.Fatal(err)
+	}
+	fw.Close()
+
+	reader, err = Open(Source{Path: filePath}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+	if err := reader.Next(&map[string]interface{}{}); err == nil || !strings.Contains(err.Error(), "ratings") {
+		t.Errorf("expected an error naming the ratings column, got: %v", err)
+	}
+}
+
+func TestParquetReaderTypes(t *testing.T) {
+	// written by arrow with the types of pyarrow: vote_average a FLOAT, release_date a DATE and
+	// released_at and updated_at TIMESTAMPs in micros and nanos. the last movie has them null
+	reader, err := Open(Source{Path: "testdata/movies_arrow_types.parquet"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+
+	expected := []map[string]interface{}{
+		{"id": int64(823464), "title": "Godzilla x Kong: The New Empire", "vote_average": 7.9, "release_date": "2024-03-27", "released_at": "2024-03-27", "updated_at": "2024-04-01"},
+		{"id": int64(293167), "title": "Kong: Skull Island", "vote_average": 6.5, "release_date": "2017-03-08", "released_at": "2017-03-08", "updated_at": "1969-12-31"},
+		{"id": int64(940721), "title": "Godzilla Minus One"},
+	}
+	for _, expectedDoc := range expected {
+		var doc map[string]interface{}
+		if err := reader.Next(&doc); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(doc, expectedDoc) {
+			t.Errorf("expected: %+v, got: %+v", expectedDoc, doc)
+		}
+	}
+
+	// the files written before the logical types only have the converted ones
+	type movie struct {
+		ID          int64   `parquet:"name=id, type=INT64"`
+		VoteAverage float32 `parquet:"name=vote_average, type=FLOAT"`
+		ReleaseDate int32   `parquet:"name=release_date, type=INT32, convertedtype=DATE"`
+		ReleasedAt  int64   `parquet:"name=released_at, type=INT64, convertedtype=TIMESTAMP_MILLIS"`
+	}
+	filePath := filepath.Join(t.TempDir(), "movies.parquet")
+	fw, err := local.NewLocalFileWriter(filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pw, err := writer.NewParquetWriter(fw, new(movie), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	released := time.Date(2023, 11, 3, 9, 0, 0, 0, time.UTC)
+	if err := pw.Write(movie{ID: 940721, VoteAverage: 7.6, ReleaseDate: int32(released.Unix() / 86400), ReleasedAt: released.UnixMilli()}); err != nil {
+		t.Fatal(err)
+	}
+	if err := pw.WriteStop(); err != nil {
+		t.Fatal(err)
+	}
+	fw.Close()
+
+	reader, err = Open(Source{Path: filePath}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+	var movieData common.MovieData
+	if err := reader.Next(&movieData); err != nil {
+		t.Fatal(err)
+	}
+	if movieData.VoteAverage != 7.6 || movieData.ReleaseDate != "2023-11-03" {
+		t.Errorf("expected the vote average 7.6 released on 2023-11-03, got: %+v", movieData)
+	}
+}
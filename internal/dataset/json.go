@@ -0,0 +1,169 @@
+package dataset
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+)
+
+// jsonReader streams the documents of a json dataset one at a time instead of
+// reading the whole file in memory. It accepts:
+// 1. the TMDB dumps, an object with the documents in its results array, i.e {"page": 1, "results": [...]}
+// 2. a json array of documents
+// 3. ndjson, one document per line
+type jsonReader struct {
+	file *os.File
+	dec  *json.Decoder
+	// reading the elements of an array, the results array or a top-level one
+	inArray bool
+	// the array is the results of an object whose remaining keys are skipped after it
+	inResults bool
+	// first document of a ndjson file, read while looking for the results array
+	pending json.RawMessage
+	done    bool
+}
+
+func openJSON(filePath string) (*jsonReader, error) {
+	fd, err := os.Open(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open the file: %w", err)
+	}
+
+	r := &jsonReader{file: fd, dec: json.NewDecoder(bufio.NewReaderSize(fd, 1<<20))}
+	// keeps the precision of the integers when decoding into an interface{}
+	r.dec.UseNumber()
+	if err := r.start(); err != nil {
+		fd.Close()
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *jsonReader) Close() error {
+	return r.file.Close()
+}
+
+// works out the shape of the file from its first value
+func (r *jsonReader) start() error {
+	tok, err := r.dec.Token()
+	if err == io.EOF {
+		// an empty file has no documents
+		r.done = true
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read the json: %w", err)
+	}
+
+	switch tok {
+	case json.Delim('['):
+		r.inArray = true
+		return nil
+	case json.Delim('{'):
+	default:
+		return fmt.Errorf("expected a json object or array, got: %v", tok)
+	}
+
+	// either the object holding the results array or the first document of a ndjson file.
+	// the keys read before results are kept in case it turns out to be a document.
+	first := make(map[string]json.RawMessage)
+	for r.dec.More() {
+		tok, err := r.dec.Token()
+		if err != nil {
+			return fmt.Errorf("failed to read the json: %w", err)
+		}
+		key, _ := tok.(string)
+
+		if key == "results" {
+			tok, err := r.dec.Token()
+			if err != nil {
+				return fmt.Errorf("failed to read the json: %w", err)
+			}
+			if tok != json.Delim('[') {
+				return fmt.Errorf("expected results to be an array, got: %v", tok)
+			}
+			r.inArray = true
+			r.inResults = true
+			return nil
+		}
+
+		var value json.RawMessage
+		if err := r.dec.Decode(&value); err != nil {
+			return fmt.Errorf("failed to read the json: %w", err)
+		}
+		first[key] = value
+	}
+	if _, err := r.dec.Token(); err != nil {
+		return fmt.Errorf("failed to read the json: %w", err)
+	}
+
+	r.pending, err = json.Marshal(first)
+	return err
+}
+
+// Next decodes the next document into v, io.EOF once there are no more documents.
+// Numbers decoded into an interface{} are json.Number.
+func (r *jsonReader) Next(v interface{}) error {
+	if r.done {
+		return io.EOF
+	}
+
+	if r.pending != nil {
+		pending := r.pending
+		r.pending = nil
+		dec := json.NewDecoder(bytes.NewReader(pending))
+		dec.UseNumber()
+		return dec.Decode(v)
+	}
+
+	if !r.inArray {
+		// ndjson, the decoder reads one value after another whatever whitespace is between them
+		if !r.dec.More() {
+			r.done = true
+			return io.EOF
+		}
+		if err := r.dec.Decode(v); err != nil {
+			return fmt.Errorf("failed to read the json: %w", err)
+		}
+		return nil
+	}
+
+	if r.dec.More() {
+		if err := r.dec.Decode(v); err != nil {
+			return fmt.Errorf("failed to read the json: %w", err)
+		}
+		return nil
+	}
+
+	// end of the array
+	r.done = true
+	if _, err := r.dec.Token(); err != nil {
+		return fmt.Errorf("failed to read the json: %w", err)
+	}
+	if r.inResults {
+		if err := r.skipObject(); err != nil {
+			return err
+		}
+	}
+	return io.EOF
+}
+
+// skips the keys of the object left after the results array, i.e the total_pages of the TMDB dumps
+func (r *jsonReader) skipObject() error {
+	for r.dec.More() {
+		if _, err := r.dec.Token(); err != nil {
+			return fmt.Errorf("failed to read the json: %w", err)
+		}
+		var value json.RawMessage
+		if err := r.dec.Decode(&value); err != nil {
+			return fmt.Errorf("failed to read the json: %w", err)
+		}
+	}
+	if _, err := r.dec.Token(); err != nil {
+		return fmt.Errorf("failed to read the json: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,221 @@
+package dataset
+
+import (
+	"fmt"
+	"io"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/xitongsys/parquet-go-source/local"
+	pqcommon "github.com/xitongsys/parquet-go/common"
+	"github.com/xitongsys/parquet-go/parquet"
+	"github.com/xitongsys/parquet-go/reader"
+	"github.com/xitongsys/parquet-go/source"
+)
+
+// parquetReader reads the rows of a parquet file in batches, one document per row.
+// the columns are named after the schema fields and already typed, lists are arrays.
+type parquetReader struct {
+	file   source.ParquetFile
+	reader *reader.ParquetReader
+	// name of the column of every field of the row struct parquet-go builds
+	names map[string]string
+	// unit of the date and timestamp columns by the field of the row struct, they are read as numbers
+	times   map[string]timeUnit
+	rows    []interface{}
+	pos     int
+	remains int64
+}
+
+func openParquet(filePath string) (*parquetReader, error) {
+	fr, err := local.NewLocalFileReader(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open the file: %w", err)
+	}
+	pr, err := reader.NewParquetReader(fr, nil, 4)
+	if err != nil {
+		fr.Close()
+		return nil, fmt.Errorf("failed to read the parquet footer: %w", err)
+	}
+
+	// parquet-go names the fields of the row struct in go style, i.e Genre_ids for genre_ids
+	sh := pr.SchemaHandler
+	names := make(map[string]string)
+	root := sh.GetRootInName()
+	for inPath, exPath := range sh.InPathToExPath {
+		inParts := strings.Split(inPath, pqcommon.PAR_GO_PATH_DELIMITER)
+		exParts := strings.Split(exPath, pqcommon.PAR_GO_PATH_DELIMITER)
+		if len(inParts) == 2 && inParts[0] == root {
+			names[inParts[1]] = exParts[1]
+		}
+	}
+
+	times := make(map[string]timeUnit)
+	for i, element := range sh.SchemaElements {
+		inParts := strings.Split(sh.IndexMap[int32(i)], pqcommon.PAR_GO_PATH_DELIMITER)
+		if element.GetNumChildren() > 0 || len(inParts) < 2 || inParts[0] != root {
+			continue
+		}
+		// the leaf of the column, the element of a list of dates as well
+		if unit := columnTimeUnit(element); unit != notTime {
+			times[inParts[1]] = unit
+		}
+	}
+
+	return &parquetReader{file: fr, reader: pr, names: names, times: times, remains: pr.GetNumRows()}, nil
+}
+
+// how a date or timestamp column counts the time since the epoch
+type timeUnit int
+
+const (
+	notTime timeUnit = iota
+	days
+	millis
+	micros
+	nanos
+)
+
+// the unit of the logical type of the column or, for the files written before there were
+// logical types, of its converted type
+func columnTimeUnit(element *parquet.SchemaElement) timeUnit {
+	if logical := element.LogicalType; logical != nil {
+		if logical.DATE != nil {
+			return days
+		}
+		if logical.TIMESTAMP != nil && logical.TIMESTAMP.Unit != nil {
+			switch unit := logical.TIMESTAMP.Unit; {
+			case unit.MILLIS != nil:
+				return millis
+			case unit.MICROS != nil:
+				return micros
+			case unit.NANOS != nil:
+				return nanos
+			}
+		}
+	}
+	if element.ConvertedType != nil {
+		switch *element.ConvertedType {
+		case parquet.ConvertedType_DATE:
+			return days
+		case parquet.ConvertedType_TIMESTAMP_MILLIS:
+			return millis
+		case parquet.ConvertedType_TIMESTAMP_MICROS:
+			return micros
+		}
+	}
+	return notTime
+}
+
+// the day of the time in the YYYY-MM-DD layout the csv dates are stored in, in UTC
+func (u timeUnit) format(v int64) string {
+	var t time.Time
+	switch u {
+	case days:
+		t = time.Unix(v*24*60*60, 0)
+	case millis:
+		t = time.UnixMilli(v)
+	case micros:
+		t = time.UnixMicro(v)
+	case nanos:
+		t = time.Unix(0, v)
+	}
+	return t.UTC().Format("2006-01-02")
+}
+
+func (r *parquetReader) Close() error {
+	r.reader.ReadStop()
+	return r.file.Close()
+}
+
+func (r *parquetReader) Next(v interface{}) error {
+	if r.pos == len(r.rows) {
+		if r.remains == 0 {
+			return io.EOF
+		}
+		num := int64(DefaultBatchSize)
+		if r.remains < num {
+			num = r.remains
+		}
+		rows, err := r.reader.ReadByNumber(int(num))
+		if err != nil {
+			return fmt.Errorf("failed to read the parquet rows: %w", err)
+		}
+		if len(rows) == 0 {
+			return io.EOF
+		}
+		r.rows, r.pos = rows, 0
+		r.remains -= int64(len(rows))
+	}
+
+	row := reflect.ValueOf(r.rows[r.pos])
+	r.rows[r.pos] = nil
+	r.pos++
+
+	doc := make(map[string]interface{}, row.NumField())
+	for i := 0; i < row.NumField(); i++ {
+		name, ok := r.names[row.Type().Field(i).Name]
+		if !ok {
+			continue
+		}
+		value, err := parquetValue(row.Field(i), r.times[row.Type().Field(i).Name])
+		if err != nil {
+			return fmt.Errorf("failed to read the column %s: %w", name, err)
+		}
+		if value != nil {
+			doc[name] = value
+		}
+	}
+	return assign(doc, v)
+}
+
+// converts a value of the row struct to the types Normalise expects, nil for a missing
+// optional value. parquet-go only turns the LIST groups whose element is named element into
+// slices, the groups of pyarrow before 13 (list and item) or of the legacy 2-level lists are
+// structs of a single field, unwrapped to the value of that field. any other group or a map
+// is an error rather than being left out. the numbers of a date or timestamp column are
+// formatted as dates, a FLOAT as the shortest float64 printing the same as the float32.
+func parquetValue(v reflect.Value, unit timeUnit) (interface{}, error) {
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() {
+			return nil, nil
+		}
+		return parquetValue(v.Elem(), unit)
+	case reflect.Slice:
+		values := make([]interface{}, 0, v.Len())
+		for i := 0; i < v.Len(); i++ {
+			value, err := parquetValue(v.Index(i), unit)
+			if err != nil {
+				return nil, err
+			}
+			if value != nil {
+				values = append(values, value)
+			}
+		}
+		return values, nil
+	case reflect.Struct:
+		if v.NumField() == 1 {
+			return parquetValue(v.Field(0), unit)
+		}
+	case reflect.String:
+		return v.String(), nil
+	case reflect.Bool:
+		return v.Bool(), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if unit != notTime {
+			return unit.format(v.Int()), nil
+		}
+		return v.Int(), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return int64(v.Uint()), nil
+	case reflect.Float32:
+		// float64(7.9f) is 7.900000095367432
+		return strconv.ParseFloat(strconv.FormatFloat(v.Float(), 'g', -1, 32), 64)
+	case reflect.Float64:
+		return v.Float(), nil
+	}
+	return nil, fmt.Errorf("unsupported parquet type %s, nested groups and maps can't be read", v.Type())
+}
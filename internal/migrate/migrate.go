@@ -0,0 +1,255 @@
+package migrate
+
+import (
+	"context"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// the migrations are numbered, i.e 0003_search_vector.up.sql and 0003_search_vector.down.sql,
+// and applied in the order of their version. an applied migration must not be edited, the
+// change goes into a new one instead.
+//
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+// returned by the function run by inTx when there's nothing left to do for the version
+var errAlreadyDone = errors.New("already done")
+
+var migrationFileRegex = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+// any number, it only has to be the same for every migrate run so two of them don't race
+const advisoryLockID = 4617328
+
+const createMigrationsTable = `CREATE TABLE IF NOT EXISTS schema_migrations (
+    version BIGINT PRIMARY KEY,
+    name TEXT NOT NULL,
+    applied_at TIMESTAMPTZ NOT NULL DEFAULT now()
+)`
+
+type Migration struct {
+	Version int64
+	Name    string
+	Up      string
+	Down    string
+}
+
+type Status struct {
+	Migration
+	// nil while the migration is pending
+	AppliedAt *time.Time
+}
+
+// Migrations reads the migrations embedded in the binary, sorted by version
+func Migrations() ([]Migration, error) {
+	return load(migrationFiles, "migrations")
+}
+
+func load(fsys fs.FS, dir string) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := make(map[int64]*Migration)
+	for _, entry := range entries {
+		match := migrationFileRegex.FindStringSubmatch(entry.Name())
+		if match == nil {
+			return nil, fmt.Errorf("migration %s must be named <version>_<name>.up.sql or <version>_<name>.down.sql", entry.Name())
+		}
+		version, err := strconv.ParseInt(match[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("migration %s: %w", entry.Name(), err)
+		}
+		content, err := fs.ReadFile(fsys, dir+"/"+entry.Name())
+		if err != nil {
+			return nil, err
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = m
+		} else if m.Name != match[2] {
+			return nil, fmt.Errorf("migrations %s and %s have the same version %d", m.Name, match[2], version)
+		}
+		if match[3] == "up" {
+			m.Up = string(content)
+		} else {
+			m.Down = string(content)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" || m.Down == "" {
+			return nil, fmt.Errorf("migration %d_%s must have both an up and a down file", m.Version, m.Name)
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+	return migrations, nil
+}
+
+// Migrator applies the migrations to a database and records them in the schema_migrations table
+type Migrator struct {
+	db         *pgxpool.Pool
+	migrations []Migration
+}
+
+func New(db *pgxpool.Pool) (*Migrator, error) {
+	migrations, err := Migrations()
+	if err != nil {
+		return nil, err
+	}
+	return &Migrator{db: db, migrations: migrations}, nil
+}
+
+// Up applies the pending migrations in order, each in its own transaction. It stops at the
+// first one which fails and returns the ones applied before it.
+func (m *Migrator) Up(ctx context.Context) ([]Migration, error) {
+	if _, err := m.db.Exec(ctx, createMigrationsTable); err != nil {
+		return nil, fmt.Errorf("failed to create the schema_migrations table: %w", err)
+	}
+
+	applied := make([]Migration, 0)
+	for _, migration := range m.migrations {
+		done, err := m.inTx(ctx, migration.Version, func(tx pgx.Tx, isApplied bool) error {
+			if isApplied {
+				return errAlreadyDone
+			}
+			if _, err := tx.Exec(ctx, migration.Up); err != nil {
+				return err
+			}
+			_, err := tx.Exec(ctx, "INSERT INTO schema_migrations (version, name) VALUES ($1, $2)", migration.Version, migration.Name)
+			return err
+		})
+		if err != nil {
+			return applied, fmt.Errorf("failed to apply the migration %d_%s: %w", migration.Version, migration.Name, err)
+		}
+		if done {
+			applied = append(applied, migration)
+		}
+	}
+	return applied, nil
+}
+
+// Down rolls back the last steps applied migrations, the latest first
+func (m *Migrator) Down(ctx context.Context, steps int) ([]Migration, error) {
+	statuses, err := m.Status(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	rolledBack := make([]Migration, 0)
+	for i := len(statuses) - 1; i >= 0 && len(rolledBack) < steps; i-- {
+		migration := statuses[i].Migration
+		if statuses[i].AppliedAt == nil {
+			continue
+		}
+		if migration.Down == "" {
+			return rolledBack, fmt.Errorf("migration %d was applied by a newer binary, it can't be rolled back by this one", migration.Version)
+		}
+		done, err := m.inTx(ctx, migration.Version, func(tx pgx.Tx, isApplied bool) error {
+			if !isApplied {
+				return errAlreadyDone
+			}
+			if _, err := tx.Exec(ctx, migration.Down); err != nil {
+				return err
+			}
+			_, err := tx.Exec(ctx, "DELETE FROM schema_migrations WHERE version = $1", migration.Version)
+			return err
+		})
+		if err != nil {
+			return rolledBack, fmt.Errorf("failed to roll back the migration %d_%s: %w", migration.Version, migration.Name, err)
+		}
+		if done {
+			rolledBack = append(rolledBack, migration)
+		}
+	}
+	return rolledBack, nil
+}
+
+// Status lists every migration, embedded or recorded as applied, and when it was applied
+func (m *Migrator) Status(ctx context.Context) ([]Status, error) {
+	if _, err := m.db.Exec(ctx, createMigrationsTable); err != nil {
+		return nil, fmt.Errorf("failed to create the schema_migrations table: %w", err)
+	}
+	rows, err := m.db.Query(ctx, "SELECT version, name, applied_at FROM schema_migrations")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	applied := make(map[int64]Status)
+	for rows.Next() {
+		var s Status
+		var appliedAt time.Time
+		if err := rows.Scan(&s.Version, &s.Name, &appliedAt); err != nil {
+			return nil, err
+		}
+		s.AppliedAt = &appliedAt
+		applied[s.Version] = s
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	statuses := make([]Status, 0, len(m.migrations))
+	for _, migration := range m.migrations {
+		s := Status{Migration: migration}
+		if a, ok := applied[migration.Version]; ok {
+			s.AppliedAt = a.AppliedAt
+			delete(applied, migration.Version)
+		}
+		statuses = append(statuses, s)
+	}
+	// applied by a newer binary, only the version and name are known
+	for _, s := range applied {
+		statuses = append(statuses, s)
+	}
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].Version < statuses[j].Version
+	})
+	return statuses, nil
+}
+
+// runs fn in a transaction holding the migrations lock, with whether the version is applied
+// as seen once the lock is held. reports false when fn returns errAlreadyDone, as happens
+// when another migrate run got to the version first.
+func (m *Migrator) inTx(ctx context.Context, version int64, fn func(tx pgx.Tx, isApplied bool) error) (bool, error) {
+	tx, err := m.db.Begin(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx, "SELECT pg_advisory_xact_lock($1)", advisoryLockID); err != nil {
+		return false, err
+	}
+	var isApplied bool
+	if err := tx.QueryRow(ctx, "SELECT EXISTS (SELECT 1 FROM schema_migrations WHERE version = $1)", version).Scan(&isApplied); err != nil {
+		return false, err
+	}
+
+	if err := fn(tx, isApplied); err == errAlreadyDone {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return false, err
+	}
+	return true, nil
+}
@@ -0,0 +1,67 @@
+package migrate
+
+import (
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestMigrations(t *testing.T) {
+	migrations, err := Migrations()
+	if err != nil {
+		t.Fatalf("failed to load the embedded migrations: %+v", err)
+	}
+	if len(migrations) == 0 {
+		t.Fatalf("expected the embedded migrations, got none")
+	}
+	for i, m := range migrations {
+		if m.Version != int64(i+1) {
+			t.Errorf("expected migration %d to have the version %d, got: %d", i, i+1, m.Version)
+		}
+		if strings.TrimSpace(m.Up) == "" || strings.TrimSpace(m.Down) == "" {
+			t.Errorf("expected migration %d_%s to have both an up and a down", m.Version, m.Name)
+		}
+	}
+	if !strings.Contains(migrations[0].Up, "CREATE TABLE IF NOT EXISTS movies") {
+		t.Errorf("expected the first migration to create the movies table, got: %s", migrations[0].Up)
+	}
+}
+
+func TestLoad(t *testing.T) {
+	fsys := fstest.MapFS{
+		"m/0002_b.up.sql":   {Data: []byte("up b")},
+		"m/0002_b.down.sql": {Data: []byte("down b")},
+		"m/0001_a.up.sql":   {Data: []byte("up a")},
+		"m/0001_a.down.sql": {Data: []byte("down a")},
+	}
+	migrations, err := load(fsys, "m")
+	if err != nil {
+		t.Fatalf("failed to load the migrations: %+v", err)
+	}
+	if len(migrations) != 2 || migrations[0].Name != "a" || migrations[1].Name != "b" {
+		t.Errorf("expected the migrations a and b in order, got: %+v", migrations)
+	}
+	if migrations[1].Up != "up b" || migrations[1].Down != "down b" {
+		t.Errorf("expected the up and down of b, got: %+v", migrations[1])
+	}
+
+	// a migration needs both files
+	delete(fsys, "m/0002_b.down.sql")
+	if _, err := load(fsys, "m"); err == nil {
+		t.Errorf("expected an error for a migration without a down file")
+	}
+
+	// two migrations can't share a version
+	fsys["m/0002_b.down.sql"] = &fstest.MapFile{Data: []byte("down b")}
+	fsys["m/0002_c.up.sql"] = &fstest.MapFile{Data: []byte("up c")}
+	if _, err := load(fsys, "m"); err == nil {
+		t.Errorf("expected an error for two migrations with the same version")
+	}
+
+	// files not following the naming are rejected instead of being skipped
+	delete(fsys, "m/0002_c.up.sql")
+	fsys["m/notes.sql"] = &fstest.MapFile{Data: []byte("")}
+	if _, err := load(fsys, "m"); err == nil {
+		t.Errorf("expected an error for a misnamed migration")
+	}
+}
@@ -16,4 +16,4 @@ CREATE TABLE IF NOT EXISTS movies (
     video BOOLEAN,
     vote_average DOUBLE PRECISION,
     vote_count BIGINT
-);
\ No newline at end of file
+);
@@ -0,0 +1 @@
+DROP INDEX IF EXISTS movies_movie_id_idx;
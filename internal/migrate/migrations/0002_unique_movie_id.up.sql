@@ -0,0 +1,4 @@
+-- a movie is stored once, loading the dataset again updates it instead.
+-- a database loaded before this index existed has to be deduplicated first:
+-- DELETE FROM movies a USING movies b WHERE a.movie_id = b.movie_id AND a.id < b.id;
+CREATE UNIQUE INDEX IF NOT EXISTS movies_movie_id_idx ON movies (movie_id);
@@ -0,0 +1,7 @@
+-- weighted document searched by the postgresFTS backend, a match in the title ranks above one in the overview
+ALTER TABLE movies ADD COLUMN IF NOT EXISTS search_vector tsvector GENERATED ALWAYS AS (
+    setweight(to_tsvector('english', coalesce(movie_title, '')), 'A') ||
+    setweight(to_tsvector('english', coalesce(movie_overview, '')), 'B')
+) STORED;
+
+CREATE INDEX IF NOT EXISTS movies_search_vector_idx ON movies USING GIN (search_vector);
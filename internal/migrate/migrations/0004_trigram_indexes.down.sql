@@ -0,0 +1,3 @@
+-- the extension is left installed, other tables of the database may use it
+DROP INDEX IF EXISTS movies_movie_overview_trgm_idx;
+DROP INDEX IF EXISTS movies_movie_title_trgm_idx;
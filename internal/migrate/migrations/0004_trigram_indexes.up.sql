@@ -0,0 +1,4 @@
+-- trigram indexes for the trigram backend, they also serve the LOWER(..) LIKE '%..%' queries of the database backend
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+CREATE INDEX IF NOT EXISTS movies_movie_title_trgm_idx ON movies USING GIN (LOWER(movie_title) gin_trgm_ops);
+CREATE INDEX IF NOT EXISTS movies_movie_overview_trgm_idx ON movies USING GIN (LOWER(movie_overview) gin_trgm_ops);
@@ -0,0 +1,26 @@
+-- tells the in-memory replicas which movies changed. the payload is only the movie_id,
+-- a replica reads the row itself since a payload is limited to 8000 bytes.
+-- a truncate is sent as * and makes the replicas reload the whole table.
+CREATE OR REPLACE FUNCTION notify_movie_change() RETURNS trigger AS $$
+BEGIN
+    IF TG_OP = 'TRUNCATE' THEN
+        PERFORM pg_notify('movie_changes', '*');
+    ELSIF TG_OP = 'DELETE' THEN
+        PERFORM pg_notify('movie_changes', OLD.movie_id::text);
+    ELSE
+        PERFORM pg_notify('movie_changes', NEW.movie_id::text);
+        IF TG_OP = 'UPDATE' AND OLD.movie_id <> NEW.movie_id THEN
+            PERFORM pg_notify('movie_changes', OLD.movie_id::text);
+        END IF;
+    END IF;
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS movies_notify_change ON movies;
+CREATE TRIGGER movies_notify_change AFTER INSERT OR UPDATE OR DELETE ON movies
+    FOR EACH ROW EXECUTE FUNCTION notify_movie_change();
+
+DROP TRIGGER IF EXISTS movies_notify_truncate ON movies;
+CREATE TRIGGER movies_notify_truncate AFTER TRUNCATE ON movies
+    FOR EACH STATEMENT EXECUTE FUNCTION notify_movie_change();
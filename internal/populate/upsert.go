@@ -3,108 +3,262 @@ package populate
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
 	"log"
-	"os"
 	"textscout/common"
 	"textscout/internal/database"
+	"textscout/internal/dataset"
+	"textscout/internal/sqlite"
 	"time"
 
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/jackc/pgx/v5/pgxpool"
 )
 
-// reads the json from the filepath and inserts into postgres
+// streams the dataset from the filepath and upserts it into postgres, or sqlite, in batches
 type InsertData struct {
 	FilePath string
-	Config   *common.Config
+	// json, csv or parquet, detected from the file extension when empty
+	Format dataset.Format
+	// csv header to the movies schema field its column holds
+	HeaderMap map[string]string
+	Config    *common.Config
+	// loads into the sqlite database at the path instead of postgres when set
+	SQLitePath string
 }
 
-func (d *InsertData) InsertMovies() {
-	// initialise the db connection
-	postgres, err := database.NewPostgres(d.Config.DBName, d.Config.DBUser, d.Config.DBPass)
-	if err != nil {
-		panic(err.Error())
-	}
+// MovieStore is a database the movies are loaded into
+type MovieStore interface {
+	// upserts the batch in a single transaction, the report counts its movies
+	UpsertMovies(ctx context.Context, batch []common.MovieData) (LoadReport, error)
+}
 
-	moviesDB := database.New(postgres.DB)
+// counts of a load, a movie is skipped when it is stored as it is already or it is invalid
+type LoadReport struct {
+	Inserted int
+	Updated  int
+	Skipped  int
+}
 
-	start := time.Now()
+// how long a batch can take to be upserted
+const batchTimeout = time.Minute
 
-	fd, err := os.Open(d.FilePath)
-	if err != nil {
-		log.Fatal("failed to open the file", err)
+func (d *InsertData) InsertMovies() error {
+	// initialise the db connection
+	var store MovieStore
+	if d.SQLitePath != "" {
+		db, err := sqlite.Open(d.SQLitePath)
+		if err != nil {
+			return err
+		}
+		defer db.Close()
+		store = SQLiteStore(db)
+	} else {
+		postgres, err := database.NewPostgres(d.Config.Postgres)
+		if err != nil {
+			return err
+		}
+		defer postgres.DB.Close()
+		store = PostgresStore(postgres.DB)
 	}
-	defer fd.Close()
 
-	// start reading the json file in-memory
-	jsonBytes, err := io.ReadAll(fd)
+	start := time.Now()
+
+	// stream the file so the whole of it is never in memory
+	source := dataset.Source{Path: d.FilePath, Format: d.Format, HeaderMap: d.HeaderMap}
+	reader, err := dataset.Open(source, common.DefaultMovieSchema())
 	if err != nil {
-		log.Fatal("failed to read the file", err)
+		return fmt.Errorf("failed to open the dataset: %w", err)
 	}
+	defer reader.Close()
 
-	var results common.Results
-	err = json.Unmarshal(jsonBytes, &results)
+	report, err := LoadMovies(context.Background(), store, reader)
+	log.Printf("inserted %d, updated %d and skipped %d movies", report.Inserted, report.Updated, report.Skipped)
 	if err != nil {
-		log.Fatal("failed to unmarshal the json", err)
+		return fmt.Errorf("error loading the movies: %w", err)
 	}
+	log.Printf("time taken to read and write to database: %d", time.Now().Sub(start).Milliseconds())
+	return nil
+}
 
-	for _, movieData := range results.Results {
-		arg := database.AddMovieParams{
-			Adult: pgtype.Bool{
-				Bool:  movieData.Adult,
-				Valid: true,
-			},
-			BackdropPath: pgtype.Text{
-				String: movieData.BackdropPath,
-				Valid:  true,
-			},
-			GenreIds: movieData.GenreIDs,
-			MovieID:  movieData.ID,
-			MovieLanguage: pgtype.Text{
-				String: movieData.Language,
-				Valid:  true,
-			},
-			MovieOriginalTitle: pgtype.Text{
-				String: movieData.OriginalTitle,
-				Valid:  true,
-			},
-			MovieOverview: pgtype.Text{
-				String: movieData.Overview,
-				Valid:  true,
-			},
-			Popularity: pgtype.Float8{
-				Float64: movieData.Popularity,
-				Valid:   true,
-			},
-			PosterPath: pgtype.Text{
-				String: movieData.PosterPath,
-				Valid:  true,
-			},
-			ReleaseDate: pgtype.Text{
-				String: movieData.ReleaseDate,
-				Valid:  true,
-			},
-			MovieTitle: movieData.MovieTitle,
-			Video: pgtype.Bool{
-				Bool:  movieData.Video,
-				Valid: true,
-			},
-			VoteAverage: pgtype.Float8{
-				Float64: movieData.VoteAverage,
-				Valid:   true,
-			},
-			VoteCount: pgtype.Int8{
-				Int64: movieData.VoteCount,
-				Valid: true,
-			},
+// upserts the movies of the reader in batches, each in its own transaction. a movie
+// already stored is updated, or skipped if nothing changed. the report counts the
+// movies of the batches committed before an error.
+func LoadMovies(ctx context.Context, store MovieStore, reader dataset.Reader) (LoadReport, error) {
+	var report LoadReport
+	batch := make([]common.MovieData, 0, dataset.DefaultBatchSize)
+	for position := 0; ; position++ {
+		var movieData common.MovieData
+		err := reader.Next(&movieData)
+		if err == io.EOF {
+			break
 		}
-		err := moviesDB.AddMovie(context.Background(), arg)
 		if err != nil {
-			log.Fatalf("error inserting movie data: %+v", err)
+			return report, fmt.Errorf("failed to read the movie at position %d: %w", position, err)
+		}
+		if movieData.ID == 0 || movieData.MovieTitle == "" {
+			log.Printf("skipping the movie at position %d without an id or a title", position)
+			report.Skipped++
+			continue
 		}
 
+		batch = append(batch, movieData)
+		if len(batch) == dataset.DefaultBatchSize {
+			if err := upsertBatch(ctx, store, batch, &report); err != nil {
+				return report, err
+			}
+			batch = batch[:0]
+		}
+	}
+	if len(batch) == 0 {
+		return report, nil
 	}
+	return report, upsertBatch(ctx, store, batch, &report)
+}
 
-	log.Printf("time taken to read and write to database: %d", time.Now().Sub(start).Milliseconds())
+func upsertBatch(ctx context.Context, store MovieStore, batch []common.MovieData, report *LoadReport) error {
+	ctx, cancel := context.WithTimeout(ctx, batchTimeout)
+	defer cancel()
+
+	// only added to the report once the batch is committed
+	counts, err := store.UpsertMovies(ctx, batch)
+	if err != nil {
+		return err
+	}
+	report.Inserted += counts.Inserted
+	report.Updated += counts.Updated
+	report.Skipped += counts.Skipped
+	return nil
+}
 
+type postgresStore struct {
+	db *pgxpool.Pool
+}
+
+// PostgresStore loads the movies into the movies table of postgres
+func PostgresStore(db *pgxpool.Pool) MovieStore {
+	return postgresStore{db: db}
+}
+
+func (s postgresStore) UpsertMovies(ctx context.Context, movies []common.MovieData) (LoadReport, error) {
+	batch := make([]database.UpsertMovieParams, 0, len(movies))
+	for _, movieData := range movies {
+		batch = append(batch, database.UpsertMovieParams(MovieParams(movieData)))
+	}
+
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return LoadReport{}, fmt.Errorf("failed to begin the transaction: %w", err)
+	}
+	// a no-op once committed
+	defer tx.Rollback(ctx)
+
+	var counts LoadReport
+	var batchErr error
+	database.New(tx).UpsertMovie(ctx, batch).QueryRow(func(i int, inserted bool, err error) {
+		switch {
+		case errors.Is(err, pgx.ErrNoRows):
+			// the conflicting row has the same values, so it isn't updated
+			counts.Skipped++
+		case err != nil:
+			if batchErr == nil {
+				batchErr = fmt.Errorf("failed to upsert the movie %d: %w", batch[i].MovieID, err)
+			}
+		case inserted:
+			counts.Inserted++
+		default:
+			counts.Updated++
+		}
+	})
+	if batchErr != nil {
+		return LoadReport{}, batchErr
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return LoadReport{}, fmt.Errorf("failed to commit the batch: %w", err)
+	}
+	return counts, nil
+}
+
+type sqliteStore struct {
+	db *sqlite.DB
+}
+
+// SQLiteStore loads the movies into a sqlite database, see sqlite.DB
+func SQLiteStore(db *sqlite.DB) MovieStore {
+	return sqliteStore{db: db}
+}
+
+func (s sqliteStore) UpsertMovies(ctx context.Context, movies []common.MovieData) (LoadReport, error) {
+	counts, err := s.db.UpsertMovies(ctx, movies)
+	return LoadReport(counts), err
+}
+
+// the row of the movie, the data comes from the TMDB json or a document validated against the movies schema
+func MovieParams(movieData common.MovieData) database.AddMovieParams {
+	return database.AddMovieParams{
+		Adult: pgtype.Bool{
+			Bool:  movieData.Adult,
+			Valid: true,
+		},
+		BackdropPath: pgtype.Text{
+			String: movieData.BackdropPath,
+			Valid:  true,
+		},
+		GenreIds: movieData.GenreIDs,
+		MovieID:  movieData.ID,
+		MovieLanguage: pgtype.Text{
+			String: movieData.Language,
+			Valid:  true,
+		},
+		MovieOriginalTitle: pgtype.Text{
+			String: movieData.OriginalTitle,
+			Valid:  true,
+		},
+		MovieOverview: pgtype.Text{
+			String: movieData.Overview,
+			Valid:  true,
+		},
+		Popularity: pgtype.Float8{
+			Float64: movieData.Popularity,
+			Valid:   true,
+		},
+		PosterPath: pgtype.Text{
+			String: movieData.PosterPath,
+			Valid:  true,
+		},
+		ReleaseDate: pgtype.Text{
+			String: movieData.ReleaseDate,
+			Valid:  true,
+		},
+		MovieTitle: movieData.MovieTitle,
+		Video: pgtype.Bool{
+			Bool:  movieData.Video,
+			Valid: true,
+		},
+		VoteAverage: pgtype.Float8{
+			Float64: movieData.VoteAverage,
+			Valid:   true,
+		},
+		VoteCount: pgtype.Int8{
+			Int64: movieData.VoteCount,
+			Valid: true,
+		},
+	}
+}
+
+// converts a document normalised by the movies schema to the movie data stored in the database
+func MovieFromFields(fields map[string]interface{}) (common.MovieData, error) {
+	// the schema fields are named after the json tags of the movie data
+	jsonBytes, err := json.Marshal(fields)
+	if err != nil {
+		return common.MovieData{}, err
+	}
+	var movieData common.MovieData
+	if err := json.Unmarshal(jsonBytes, &movieData); err != nil {
+		return common.MovieData{}, fmt.Errorf("document is not a valid movie: %w", err)
+	}
+	return movieData, nil
 }
@@ -0,0 +1,299 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"textscout/common"
+
+	// pure go driver, FTS5 is compiled in so no cgo or build tags are needed
+	_ "modernc.org/sqlite"
+)
+
+var ErrMovieExists = errors.New("movie already exists")
+
+// the movies along with an FTS5 index of their title and overview. the index reads the
+// text from the movies table (external content) and the triggers keep it in step with it.
+const schema = `
+CREATE TABLE IF NOT EXISTS movies (
+    movie_id INTEGER PRIMARY KEY,
+    adult INTEGER,
+    backdrop_path TEXT,
+    genre_ids TEXT,
+    movie_language TEXT,
+    movie_original_title TEXT,
+    movie_overview TEXT,
+    popularity REAL,
+    poster_path TEXT,
+    release_date TEXT,
+    movie_title TEXT NOT NULL,
+    video INTEGER,
+    vote_average REAL,
+    vote_count INTEGER
+);
+
+CREATE VIRTUAL TABLE IF NOT EXISTS movies_fts USING fts5(
+    movie_title, movie_overview,
+    content='movies', content_rowid='movie_id',
+    tokenize='porter unicode61 remove_diacritics 2'
+);
+
+CREATE TRIGGER IF NOT EXISTS movies_fts_insert AFTER INSERT ON movies BEGIN
+    INSERT INTO movies_fts (rowid, movie_title, movie_overview) VALUES (new.movie_id, new.movie_title, new.movie_overview);
+END;
+
+CREATE TRIGGER IF NOT EXISTS movies_fts_delete AFTER DELETE ON movies BEGIN
+    INSERT INTO movies_fts (movies_fts, rowid, movie_title, movie_overview) VALUES ('delete', old.movie_id, old.movie_title, old.movie_overview);
+END;
+
+CREATE TRIGGER IF NOT EXISTS movies_fts_update AFTER UPDATE ON movies BEGIN
+    INSERT INTO movies_fts (movies_fts, rowid, movie_title, movie_overview) VALUES ('delete', old.movie_id, old.movie_title, old.movie_overview);
+    INSERT INTO movies_fts (rowid, movie_title, movie_overview) VALUES (new.movie_id, new.movie_title, new.movie_overview);
+END;
+`
+
+const movieColumns = `movie_id, adult, backdrop_path, genre_ids, movie_language, movie_original_title, movie_overview,
+    popularity, poster_path, release_date, movie_title, video, vote_average, vote_count`
+
+// the conflicting movie is only updated when a value changed, so the affected rows tell an update from a skip
+const upsertMovie = `INSERT INTO movies (` + movieColumns + `)
+VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+ON CONFLICT (movie_id) DO UPDATE SET
+    adult = excluded.adult,
+    backdrop_path = excluded.backdrop_path,
+    genre_ids = excluded.genre_ids,
+    movie_language = excluded.movie_language,
+    movie_original_title = excluded.movie_original_title,
+    movie_overview = excluded.movie_overview,
+    popularity = excluded.popularity,
+    poster_path = excluded.poster_path,
+    release_date = excluded.release_date,
+    movie_title = excluded.movie_title,
+    video = excluded.video,
+    vote_average = excluded.vote_average,
+    vote_count = excluded.vote_count
+WHERE movies.adult IS NOT excluded.adult
+    OR movies.backdrop_path IS NOT excluded.backdrop_path
+    OR movies.genre_ids IS NOT excluded.genre_ids
+    OR movies.movie_language IS NOT excluded.movie_language
+    OR movies.movie_original_title IS NOT excluded.movie_original_title
+    OR movies.movie_overview IS NOT excluded.movie_overview
+    OR movies.popularity IS NOT excluded.popularity
+    OR movies.poster_path IS NOT excluded.poster_path
+    OR movies.release_date IS NOT excluded.release_date
+    OR movies.movie_title IS NOT excluded.movie_title
+    OR movies.video IS NOT excluded.video
+    OR movies.vote_average IS NOT excluded.vote_average
+    OR movies.vote_count IS NOT excluded.vote_count`
+
+// bm25 weighs a match in the title twice a match in the overview, lower is better.
+// snippet wraps the matched terms of the column in <em> with at most 16 tokens around them.
+const searchMovies = `SELECT m.movie_id, m.adult, m.backdrop_path, m.genre_ids, m.movie_language, m.movie_original_title,
+    m.movie_overview, m.popularity, m.poster_path, m.release_date, m.movie_title, m.video, m.vote_average, m.vote_count,
+    bm25(movies_fts, 2.0, 1.0) AS rank,
+    snippet(movies_fts, 0, '<em>', '</em>', '…', 16),
+    snippet(movies_fts, 1, '<em>', '</em>', '…', 16)
+FROM movies_fts JOIN movies m ON m.movie_id = movies_fts.rowid
+WHERE movies_fts MATCH ?
+ORDER BY rank, m.movie_id
+LIMIT ?`
+
+// words of a query, everything else is dropped so the text can't be read as FTS5 syntax
+var queryTokenRegex = regexp.MustCompile(`[\p{L}\p{N}]+`)
+
+// DB is a movies database in a single file, searched with FTS5
+type DB struct {
+	db *sql.DB
+}
+
+// counts of an upsert, a movie is skipped when it is stored as it is already
+type Counts struct {
+	Inserted int
+	Updated  int
+	Skipped  int
+}
+
+type SearchRow struct {
+	Movie common.MovieData
+	// bm25 of the movie, negated so the best match has the highest score
+	Score float64
+	// the title and overview with the matched terms highlighted
+	TitleSnippet    string
+	OverviewSnippet string
+}
+
+// Open opens the database at the path, creating the file and the tables if needed
+func Open(path string) (*DB, error) {
+	// a single writer at a time, the readers wait on it for up to 5s instead of failing
+	dsn := fmt.Sprintf("file:%s?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)", path)
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := db.Exec(schema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to create the sqlite schema: %w", err)
+	}
+	return &DB{db: db}, nil
+}
+
+func (d *DB) Close() error {
+	return d.db.Close()
+}
+
+// UpsertMovies stores the movies in a single transaction, a stored movie is updated
+// if any of its values changed and skipped otherwise
+func (d *DB) UpsertMovies(ctx context.Context, movies []common.MovieData) (Counts, error) {
+	var counts Counts
+	tx, err := d.db.BeginTx(ctx, nil)
+	if err != nil {
+		return counts, fmt.Errorf("failed to begin the transaction: %w", err)
+	}
+	// a no-op once committed
+	defer tx.Rollback()
+
+	exists, err := tx.PrepareContext(ctx, "SELECT EXISTS (SELECT 1 FROM movies WHERE movie_id = ?)")
+	if err != nil {
+		return counts, err
+	}
+	defer exists.Close()
+	upsert, err := tx.PrepareContext(ctx, upsertMovie)
+	if err != nil {
+		return counts, err
+	}
+	defer upsert.Close()
+
+	for _, movie := range movies {
+		var stored bool
+		if err := exists.QueryRowContext(ctx, movie.ID).Scan(&stored); err != nil {
+			return Counts{}, fmt.Errorf("failed to look up the movie %d: %w", movie.ID, err)
+		}
+		args, err := movieArgs(movie)
+		if err != nil {
+			return Counts{}, err
+		}
+		result, err := upsert.ExecContext(ctx, args...)
+		if err != nil {
+			return Counts{}, fmt.Errorf("failed to upsert the movie %d: %w", movie.ID, err)
+		}
+		affected, err := result.RowsAffected()
+		if err != nil {
+			return Counts{}, err
+		}
+		switch {
+		case affected == 0:
+			counts.Skipped++
+		case stored:
+			counts.Updated++
+		default:
+			counts.Inserted++
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return Counts{}, fmt.Errorf("failed to commit the batch: %w", err)
+	}
+	return counts, nil
+}
+
+// AddMovie stores the movie, ErrMovieExists if one with the same id is stored already
+func (d *DB) AddMovie(ctx context.Context, movie common.MovieData) error {
+	args, err := movieArgs(movie)
+	if err != nil {
+		return err
+	}
+	result, err := d.db.ExecContext(ctx, "INSERT INTO movies ("+movieColumns+") VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?) ON CONFLICT (movie_id) DO NOTHING", args...)
+	if err != nil {
+		return fmt.Errorf("failed to insert the movie: %w", err)
+	}
+	if affected, err := result.RowsAffected(); err == nil && affected == 0 {
+		return ErrMovieExists
+	}
+	return err
+}
+
+// DeleteMovie deletes the movie, false if there was none with the id
+func (d *DB) DeleteMovie(ctx context.Context, movieID int32) (bool, error) {
+	result, err := d.db.ExecContext(ctx, "DELETE FROM movies WHERE movie_id = ?", movieID)
+	if err != nil {
+		return false, fmt.Errorf("failed to delete the movie: %w", err)
+	}
+	affected, err := result.RowsAffected()
+	return affected != 0, err
+}
+
+func (d *DB) CountMovies(ctx context.Context) (int, error) {
+	var count int
+	err := d.db.QueryRowContext(ctx, "SELECT count(*) FROM movies").Scan(&count)
+	return count, err
+}
+
+// Search matches the words of the query against the title and overview, every word
+// has to match unless union is set. the best matches come first.
+func (d *DB) Search(ctx context.Context, query string, union bool, limit int) ([]SearchRow, error) {
+	match := MatchQuery(query, union)
+	if match == "" {
+		return []SearchRow{}, nil
+	}
+	rows, err := d.db.QueryContext(ctx, searchMovies, match, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	results := make([]SearchRow, 0)
+	for rows.Next() {
+		var r SearchRow
+		var m common.MovieData
+		var adult, video sql.NullBool
+		var backdropPath, genreIDs, language, originalTitle, overview, posterPath, releaseDate sql.NullString
+		var popularity, voteAverage sql.NullFloat64
+		var voteCount sql.NullInt64
+		var rank float64
+		if err := rows.Scan(&m.ID, &adult, &backdropPath, &genreIDs, &language, &originalTitle, &overview,
+			&popularity, &posterPath, &releaseDate, &m.MovieTitle, &video, &voteAverage, &voteCount,
+			&rank, &r.TitleSnippet, &r.OverviewSnippet); err != nil {
+			return nil, err
+		}
+		m.Adult, m.Video = adult.Bool, video.Bool
+		m.BackdropPath, m.Language, m.OriginalTitle = backdropPath.String, language.String, originalTitle.String
+		m.Overview, m.PosterPath, m.ReleaseDate = overview.String, posterPath.String, releaseDate.String
+		m.Popularity, m.VoteAverage, m.VoteCount = popularity.Float64, voteAverage.Float64, voteCount.Int64
+		if genreIDs.String != "" {
+			if err := json.Unmarshal([]byte(genreIDs.String), &m.GenreIDs); err != nil {
+				return nil, fmt.Errorf("movie %d has invalid genre_ids: %w", m.ID, err)
+			}
+		}
+		r.Movie, r.Score = m, -rank
+		results = append(results, r)
+	}
+	return results, rows.Err()
+}
+
+// MatchQuery converts the text to an FTS5 query, every word quoted so it is matched as it is.
+// empty when the text has no words.
+func MatchQuery(text string, union bool) string {
+	tokens := queryTokenRegex.FindAllString(text, -1)
+	for i, token := range tokens {
+		tokens[i] = `"` + token + `"`
+	}
+	if union {
+		return strings.Join(tokens, " OR ")
+	}
+	return strings.Join(tokens, " ")
+}
+
+func movieArgs(m common.MovieData) ([]interface{}, error) {
+	genreIDs, err := json.Marshal(m.GenreIDs)
+	if err != nil {
+		return nil, err
+	}
+	if m.GenreIDs == nil {
+		genreIDs = []byte("[]")
+	}
+	return []interface{}{m.ID, m.Adult, m.BackdropPath, string(genreIDs), m.Language, m.OriginalTitle, m.Overview,
+		m.Popularity, m.PosterPath, m.ReleaseDate, m.MovieTitle, m.Video, m.VoteAverage, m.VoteCount}, nil
+}
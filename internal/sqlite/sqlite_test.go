@@ -0,0 +1,85 @@
+package sqlite
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+	"textscout/common"
+)
+
+func TestSearch(t *testing.T) {
+	db, err := Open(filepath.Join(t.TempDir(), "movies.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	ctx := context.Background()
+
+	movies := []common.MovieData{
+		{ID: 293167, MovieTitle: "Kong: Skull Island", Overview: "Explore the mysterious and dangerous home of the king of the apes", GenreIDs: []int32{28, 12}},
+		{ID: 823464, MovieTitle: "Godzilla x Kong: The New Empire", Overview: "Godzilla and Kong must reunite against a colossal threat"},
+		{ID: 940721, MovieTitle: "Godzilla Minus One", Overview: "Postwar Japan is at its lowest point"},
+	}
+	counts, err := db.UpsertMovies(ctx, movies)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if counts.Inserted != 3 {
+		t.Errorf("expected 3 movies inserted, got: %+v", counts)
+	}
+
+	// loading the same movies again skips them, a changed one is updated
+	movies[2].Overview = "Japan after the war"
+	counts, err = db.UpsertMovies(ctx, movies)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if counts.Updated != 1 || counts.Skipped != 2 {
+		t.Errorf("expected 1 movie updated and 2 skipped, got: %+v", counts)
+	}
+
+	// a title match ranks above an overview match
+	rows, err := db.Search(ctx, "kong", false, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 2 {
+		t.Fatalf("expected 2 movies, got: %d", len(rows))
+	}
+	if rows[0].Score < rows[1].Score {
+		t.Errorf("expected the best match first, got scores: %f, %f", rows[0].Score, rows[1].Score)
+	}
+	if !strings.Contains(rows[0].TitleSnippet, "<em>Kong</em>") {
+		t.Errorf("expected the title snippet to highlight kong, got: %s", rows[0].TitleSnippet)
+	}
+	if rows[0].Movie.ID == 293167 && len(rows[0].Movie.GenreIDs) != 2 {
+		t.Errorf("expected the genre ids to be read back, got: %v", rows[0].Movie.GenreIDs)
+	}
+
+	// every word has to match unless union is set, the stemmer matches the updated overview
+	rows, _ = db.Search(ctx, "godzilla wars", false, 10)
+	if len(rows) != 1 || rows[0].Movie.ID != 940721 {
+		t.Errorf("expected Godzilla Minus One, got: %+v", rows)
+	}
+	rows, _ = db.Search(ctx, "skull minus", true, 10)
+	if len(rows) != 2 {
+		t.Errorf("expected 2 movies for either word, got: %d", len(rows))
+	}
+	// the FTS5 syntax is escaped
+	if _, err := db.Search(ctx, `kong" OR NEAR(`, false, 10); err != nil {
+		t.Errorf("expected the query to be escaped, got: %v", err)
+	}
+
+	if err := db.AddMovie(ctx, movies[0]); err != ErrMovieExists {
+		t.Errorf("expected ErrMovieExists, got: %v", err)
+	}
+	deleted, err := db.DeleteMovie(ctx, 293167)
+	if err != nil || !deleted {
+		t.Errorf("expected the movie to be deleted, got: %v %v", deleted, err)
+	}
+	rows, _ = db.Search(ctx, "skull", false, 10)
+	if len(rows) != 0 {
+		t.Errorf("expected the deleted movie to be gone from the index, got: %d", len(rows))
+	}
+}
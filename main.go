@@ -1,45 +1,128 @@
 package main
 
 import (
+	"errors"
 	"flag"
+	"fmt"
 	"log"
-	"textscout/api"
-	"textscout/common"
-	"textscout/internal/populate"
+	"os"
+	"strings"
 )
 
-func main() {
-	// support two commands
-	// 1. populate the database by parsing the json file
-	// 2. start the REST server
+// textscout <command> [flags] [args], every command parses its own flags:
+// 1. serve: start the REST server
+// 2. ingest: populate the database by parsing the dataset file
+// 3. index build: build the in-memory index from a dataset and report its size
+// 4. search: run a query from the terminal and print the ranked results
+// 5. stats: print the size of the index or the database
+// 6. repl: search the in-memory index interactively
+// 7. migrate: migrate the database schema, followed by up, down or status
+// 8. analyze: print what the analyzer does to some text
+// 9. config print: print the effective config
+type command struct {
+	name    string
+	usage   string
+	summary string
+	run     func(fs *flag.FlagSet, args []string) error
+}
+
+var commands = []command{
+	{"serve", "serve [flags]", "start the REST server", runServe},
+	{"ingest", "ingest -filePath=<dataset> [flags]", "upsert the movies of a dataset into postgres or sqlite", runIngest},
+	{"index", "index build -filePath=<dataset> [flags]", "build the in-memory index from a dataset and report its size", runIndex},
+	{"search", "search [flags] <query>", "search the in-memory index or the database and print the ranked results", runSearch},
+	{"stats", "stats [flags]", "print the number of documents and terms of the index or the database", runStats},
+	{"repl", "repl -index=<dataset> [flags]", "search the in-memory index interactively, switching modes and analyzers", runRepl},
+	{"migrate", "migrate [flags] up|down|status", "apply, roll back or list the schema migrations", runMigrate},
+	{"analyze", "analyze [flags] <text>", "print the tokens every stage of an analyzer produces", runAnalyze},
+	{"config", "config print [flags]", "print the effective config, merged from the file, env and flags", runConfig},
+}
+
+// the commands of the former -command flag
+var legacyCommands = map[string]string{
+	"insertData": "ingest",
+	"runServer":  "serve",
+	"analyze":    "analyze",
+	"migrate":    "migrate",
+	"config":     "config",
+}
 
-	var commandFlag string
-	var filePath string
-	var searchBy string
+// returned by a command when its arguments are wrong, the usage of the command is printed
+var errUsage = errors.New("invalid usage")
 
-	flag.StringVar(&commandFlag, "command", "", "which command to run. possible values are insertData and runServer")
-	flag.StringVar(&filePath, "filePath", "", "path to the file to read from")
-	flag.StringVar(&searchBy, "searchBy", "", "searchBy database or the inmemory inverted index. possible values are database and inmemIndex")
-	flag.Parse()
+func main() {
+	args := legacyArgs(os.Args[1:])
+	if len(args) == 0 || args[0] == "-h" || args[0] == "-help" || args[0] == "--help" || args[0] == "help" {
+		usage()
+		if len(args) == 0 {
+			os.Exit(2)
+		}
+		return
+	}
 
-	config := common.GetConfigOrDie()
-	if commandFlag == "insertData" {
-		if filePath == "" {
-			log.Fatal("specify the filepath to read the data from.")
+	for _, c := range commands {
+		if c.name != args[0] {
+			continue
+		}
+		err := c.run(newFlagSet(c), args[1:])
+		if errors.Is(err, errUsage) {
+			fmt.Fprintf(os.Stderr, "%v\nusage: textscout %s, see textscout %s -h\n", err, c.usage, c.name)
+			os.Exit(2)
 		}
+		if err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	fmt.Fprintf(os.Stderr, "unknown command %q\n\n", args[0])
+	usage()
+	os.Exit(2)
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: textscout <command> [flags] [args]")
+	fmt.Fprintln(os.Stderr, "\ncommands:")
+	for _, c := range commands {
+		fmt.Fprintf(os.Stderr, "  %-42s %s\n", c.usage, c.summary)
+	}
+	fmt.Fprintln(os.Stderr, "\nrun textscout <command> -h for the flags of a command")
+}
 
-		u := &populate.InsertData{
-			FilePath: filePath,
-			Config:   config,
+// rewrites -command=insertData ... to ingest ..., so the scripts written for the
+// single -command flag keep working
+func legacyArgs(args []string) []string {
+	for i, arg := range args {
+		name, value, hasValue := strings.Cut(strings.TrimLeft(arg, "-"), "=")
+		if !strings.HasPrefix(arg, "-") || name != "command" {
+			continue
+		}
+		rest := append([]string{}, args[:i]...)
+		if !hasValue && i+1 < len(args) {
+			value = args[i+1]
+			rest = append(rest, args[i+2:]...)
+		} else {
+			rest = append(rest, args[i+1:]...)
 		}
-		u.InsertMovies()
-	} else if commandFlag == "runServer" {
-		if searchBy == "inmemIndex" && filePath == "" {
-			log.Fatal("specify the filepath to read the data from.")
+		command, ok := legacyCommands[value]
+		if !ok {
+			return args
 		}
-		api.StartServer(config, searchBy, filePath)
-	} else {
-		log.Fatal("specify a valid command to run")
+		log.Printf("-command=%s is deprecated, use textscout %s instead", value, command)
+		return append([]string{command}, rest...)
 	}
+	return args
+}
 
+// parses the flags wherever they are, i.e. search "godzilla kong" -index=movies.json,
+// and returns the other args in order. the flag sets exit on an invalid flag.
+func parseArgs(fs *flag.FlagSet, args []string) []string {
+	positional := make([]string, 0)
+	for {
+		fs.Parse(args)
+		if fs.NArg() == 0 {
+			return positional
+		}
+		positional = append(positional, fs.Arg(0))
+		args = fs.Args()[1:]
+	}
 }
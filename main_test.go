@@ -0,0 +1,62 @@
+package main
+
+import (
+	"flag"
+	"reflect"
+	"testing"
+)
+
+func TestLegacyArgs(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		want []string
+	}{
+		{"subcommand", []string{"serve", "-port=9000"}, []string{"serve", "-port=9000"}},
+		{"command flag", []string{"-command=runServer", "-port=9000"}, []string{"serve", "-port=9000"}},
+		{"command flag with a separate value", []string{"-command", "insertData", "-filePath=movies.json"}, []string{"ingest", "-filePath=movies.json"}},
+		{"command flag after the other flags", []string{"-filePath=movies.json", "--command=insertData"}, []string{"ingest", "-filePath=movies.json"}},
+		{"command flag named after the subcommand", []string{"-command=serve"}, []string{"-command=serve"}},
+		{"unknown command flag", []string{"-command=reindex", "-port=9000"}, []string{"-command=reindex", "-port=9000"}},
+		{"unknown subcommand", []string{"reindex"}, []string{"reindex"}},
+		{"no args", []string{}, []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := legacyArgs(tt.args); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("expected %q, got: %q", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestParseArgs(t *testing.T) {
+	tests := []struct {
+		name  string
+		args  []string
+		want  []string
+		limit int
+		union bool
+	}{
+		{"flags before the args", []string{"-limit=3", "-or", "godzilla", "kong"}, []string{"godzilla", "kong"}, 3, true},
+		{"flags after the args", []string{"godzilla", "kong", "-limit", "3", "-or"}, []string{"godzilla", "kong"}, 3, true},
+		{"flags between the args", []string{"godzilla", "-limit=3", "kong"}, []string{"godzilla", "kong"}, 3, false},
+		{"no flags", []string{"godzilla"}, []string{"godzilla"}, 10, false},
+		{"no args", []string{"-or"}, []string{}, 10, true},
+		{"args after the terminator", []string{"-or", "--", "-limit=3"}, []string{"-limit=3"}, 10, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fs := flag.NewFlagSet("search", flag.ContinueOnError)
+			limit := fs.Int("limit", 10, "")
+			union := fs.Bool("or", false, "")
+			got := parseArgs(fs, tt.args)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("expected the args %q, got: %q", tt.want, got)
+			}
+			if *limit != tt.limit || *union != tt.union {
+				t.Errorf("expected -limit=%d -or=%t, got: -limit=%d -or=%t", tt.limit, tt.union, *limit, *union)
+			}
+		})
+	}
+}
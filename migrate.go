@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"textscout/internal/database"
+	"textscout/internal/migrate"
+	"time"
+)
+
+func runMigrate(fs *flag.FlagSet, args []string) error {
+	var configFlags configFlags
+	var steps int
+	configFlags.register(fs)
+	fs.IntVar(&steps, "steps", 1, "number of migrations migrate down rolls back")
+	rest := parseArgs(fs, args)
+	if len(rest) != 1 {
+		return fmt.Errorf("%w: specify up, down or status after migrate", errUsage)
+	}
+	direction := rest[0]
+	if direction != "up" && direction != "down" && direction != "status" {
+		return fmt.Errorf("%w: specify up, down or status after migrate, got: %q", errUsage, direction)
+	}
+	if direction == "down" && steps < 1 {
+		return fmt.Errorf("%w: steps must be at least 1", errUsage)
+	}
+
+	config, err := configFlags.load(fs)
+	if err != nil {
+		return err
+	}
+	pgDB, err := database.NewPostgres(config.Postgres)
+	if err != nil {
+		return err
+	}
+	defer pgDB.DB.Close()
+	migrator, err := migrate.New(pgDB.DB)
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	switch direction {
+	case "up":
+		applied, err := migrator.Up(ctx)
+		for _, m := range applied {
+			log.Printf("applied %d_%s", m.Version, m.Name)
+		}
+		if err != nil {
+			return err
+		}
+		if len(applied) == 0 {
+			log.Println("the database is up to date")
+		}
+	case "down":
+		rolledBack, err := migrator.Down(ctx, steps)
+		for _, m := range rolledBack {
+			log.Printf("rolled back %d_%s", m.Version, m.Name)
+		}
+		if err != nil {
+			return err
+		}
+		if len(rolledBack) == 0 {
+			log.Println("no migrations to roll back")
+		}
+	case "status":
+		statuses, err := migrator.Status(ctx)
+		if err != nil {
+			return err
+		}
+		for _, s := range statuses {
+			applied := "pending"
+			if s.AppliedAt != nil {
+				applied = "applied at " + s.AppliedAt.Format(time.RFC3339)
+			}
+			fmt.Printf("%04d_%-30s %s\n", s.Version, s.Name, applied)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,292 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"textscout/common"
+	textsearch "textscout/inmemsearch"
+	"textscout/internal/backend"
+	"textscout/internal/dataset"
+	"time"
+)
+
+const replHelp = `type a query to search the index, or one of:
+  :and / :or          match all of the query words (default) or any of them
+  :explain            toggle printing how the score of every hit was computed
+  :analyzer [name]    list the analyzers, or index the text fields with another one ("schema" for the schema's own)
+  :analyze <text>     print the tokens every stage of the analyzer produces for the text
+  :limit <n>          number of hits to print
+  :filter [f=value]   keep only the hits with the value of a filterable field, no args clears the filters
+  :sort [field]       order by a sortable field, -field for descending, no args orders by score
+  :stats              number of documents and terms of the index
+  :help               this help
+  :quit               exit, as does ctrl-d`
+
+// the analyzer of the schema, the fields keep the analyzers they were given
+const schemaAnalyzer = "schema"
+
+// an interactive session over the in-memory index, the index is built once for every analyzer used
+type shell struct {
+	out    io.Writer
+	source dataset.Source
+	schema *common.Schema
+	// analyzer name to the index with every text field analyzed by it
+	indexes  map[string]*textsearch.InMemSearch
+	analyzer string
+	union    bool
+	explain  bool
+	limit    int
+	filters  map[string]string
+	sort     string
+}
+
+func runRepl(fs *flag.FlagSet, args []string) error {
+	var datasetFlags datasetFlags
+	var schemaPath, analyzer string
+	var limit int
+	datasetFlags.register(fs, "index")
+	fs.StringVar(&schemaPath, "schema", "", "path to the json file describing the fields of the documents, defaults to the movies schema")
+	fs.StringVar(&analyzer, "analyzer", schemaAnalyzer, "analyzer to index the text fields with, the ones of the schema by default. possible values are "+strings.Join(textsearch.AnalyzerNames(), ", "))
+	fs.IntVar(&limit, "limit", 10, "number of hits to print")
+	if rest := parseArgs(fs, args); len(rest) != 0 {
+		return fmt.Errorf("%w: repl takes no args, got: %v", errUsage, rest)
+	}
+	if datasetFlags.path == "" {
+		return fmt.Errorf("%w: specify the dataset to build the index from with -index", errUsage)
+	}
+
+	schema, err := common.LoadSchema(schemaPath)
+	if err != nil {
+		return err
+	}
+	source, err := datasetFlags.source()
+	if err != nil {
+		return err
+	}
+	s := &shell{
+		out:      os.Stdout,
+		source:   source,
+		schema:   schema,
+		indexes:  make(map[string]*textsearch.InMemSearch),
+		analyzer: schemaAnalyzer,
+		limit:    limit,
+		filters:  make(map[string]string),
+	}
+	if err := s.useAnalyzer(analyzer); err != nil {
+		return err
+	}
+	fmt.Fprintln(s.out, `type :help for the commands`)
+	return s.run(os.Stdin)
+}
+
+func (s *shell) run(in io.Reader) error {
+	scanner := bufio.NewScanner(in)
+	for {
+		fmt.Fprintf(s.out, "%s> ", s.prompt())
+		if !scanner.Scan() {
+			fmt.Fprintln(s.out)
+			return scanner.Err()
+		}
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		if !strings.HasPrefix(line, ":") {
+			s.search(line)
+			continue
+		}
+		if quit := s.command(line); quit {
+			return nil
+		}
+	}
+}
+
+// the settings which change the results, so they are always in sight
+func (s *shell) prompt() string {
+	mode := "and"
+	if s.union {
+		mode = "or"
+	}
+	parts := []string{s.analyzer, mode}
+	if s.explain {
+		parts = append(parts, "explain")
+	}
+	if s.sort != "" {
+		parts = append(parts, "sort="+s.sort)
+	}
+	if len(s.filters) != 0 {
+		parts = append(parts, "filter="+filterFlag(s.filters).String())
+	}
+	return strings.Join(parts, " ")
+}
+
+// runs a :command, returns whether the session is over
+func (s *shell) command(line string) bool {
+	name, arg, _ := strings.Cut(strings.TrimPrefix(line, ":"), " ")
+	arg = strings.TrimSpace(arg)
+	switch name {
+	case "q", "quit", "exit":
+		return true
+	case "h", "help":
+		fmt.Fprintln(s.out, replHelp)
+	case "and":
+		s.union = false
+	case "or":
+		s.union = true
+	case "explain":
+		s.explain = !s.explain
+	case "analyzer":
+		if arg == "" {
+			fmt.Fprintf(s.out, "analyzers: %s, %s\n", schemaAnalyzer, strings.Join(textsearch.AnalyzerNames(), ", "))
+			break
+		}
+		if err := s.useAnalyzer(arg); err != nil {
+			fmt.Fprintln(s.out, err)
+		}
+	case "analyze":
+		s.analyze(arg)
+	case "limit":
+		n, err := strconv.Atoi(arg)
+		if err != nil || n <= 0 {
+			fmt.Fprintln(s.out, "limit must be a positive integer")
+			break
+		}
+		s.limit = n
+	case "filter":
+		if arg == "" {
+			s.filters = make(map[string]string)
+			break
+		}
+		if err := filterFlag(s.filters).Set(arg); err != nil {
+			fmt.Fprintln(s.out, err)
+		}
+	case "sort":
+		s.sort = arg
+	case "stats":
+		index := s.indexes[s.analyzer]
+		fmt.Fprintf(s.out, "documents: %d, terms: %d\n", index.DocCount(), index.TermCount())
+	default:
+		fmt.Fprintf(s.out, "unknown command :%s, type :help for the commands\n", name)
+	}
+	return false
+}
+
+// switches to the index of the analyzer, building it the first time
+func (s *shell) useAnalyzer(name string) error {
+	if _, ok := s.indexes[name]; !ok {
+		schema := s.schema
+		if name != schemaAnalyzer {
+			if _, err := textsearch.GetAnalyzer(name); err != nil {
+				return err
+			}
+			schema = withAnalyzer(s.schema, name)
+		}
+		start := time.Now()
+		index, err := textsearch.NewInMemSearchFromSource(s.source, schema)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(s.out, "indexed %d documents with the %s analyzer in %s\n", index.DocCount(), name, time.Since(start).Round(time.Microsecond))
+		s.indexes[name] = index
+	}
+	s.analyzer = name
+	return nil
+}
+
+// a copy of the schema with every indexed field analyzed by the analyzer
+func withAnalyzer(schema *common.Schema, analyzer string) *common.Schema {
+	copied := *schema
+	copied.Fields = make([]common.FieldMapping, len(schema.Fields))
+	for i, f := range schema.Fields {
+		if f.Indexed {
+			f.Analyzer = analyzer
+		}
+		copied.Fields[i] = f
+	}
+	return &copied
+}
+
+func (s *shell) search(query string) {
+	index := s.indexes[s.analyzer]
+	start := time.Now()
+	hits, analysis, err := index.Search(textsearch.SearchRequest{
+		Query:   query,
+		Union:   s.union,
+		Filters: s.filters,
+		Sort:    s.sort,
+		Explain: s.explain,
+	})
+	took := time.Since(start)
+	if err != nil {
+		fmt.Fprintln(s.out, err)
+		return
+	}
+
+	matched := len(hits)
+	if len(hits) > s.limit {
+		hits = hits[:s.limit]
+	}
+	result := backend.Result{Hits: make([]backend.Hit, 0, len(hits))}
+	for _, hit := range hits {
+		result.Hits = append(result.Hits, backend.Hit{
+			ID:          s.schema.DocumentID(hit.Document.Fields),
+			Fields:      hit.Document.Fields,
+			Score:       hit.Score,
+			Explanation: hit.Explanation,
+		})
+	}
+	if len(result.Hits) != 0 {
+		printTable(s.out, s.schema, result.Hits)
+	}
+	if s.explain {
+		result.Analysis = &analysis
+		printExplanations(s.out, result)
+	}
+	fmt.Fprintf(s.out, "%d of %d hits in %s\n", len(result.Hits), matched, took.Round(time.Microsecond))
+}
+
+// the stages of the analyzers of the indexed fields, each analyzer once
+func (s *shell) analyze(text string) {
+	if text == "" {
+		fmt.Fprintln(s.out, "specify the text to analyze")
+		return
+	}
+	names := make([]string, 0)
+	if s.analyzer != schemaAnalyzer {
+		names = append(names, s.analyzer)
+	} else {
+		seen := make(map[string]bool)
+		for _, f := range s.schema.IndexedFields() {
+			name := f.Analyzer
+			if name == "" {
+				name = textsearch.StandardAnalyzer
+			}
+			if !seen[name] {
+				seen[name] = true
+				names = append(names, name)
+			}
+		}
+		sort.Strings(names)
+	}
+	for _, name := range names {
+		analyzer, err := textsearch.GetAnalyzer(name)
+		if err != nil {
+			fmt.Fprintln(s.out, err)
+			return
+		}
+		fmt.Fprintf(s.out, "%s:\n", name)
+		for _, stage := range analyzer.Stages(text) {
+			terms := make([]string, 0, len(stage.Tokens))
+			for _, token := range stage.Tokens {
+				terms = append(terms, token.Term)
+			}
+			fmt.Fprintf(s.out, "  %-10s %s\n", stage.Name, strings.Join(terms, " "))
+		}
+	}
+}
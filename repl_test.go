@@ -0,0 +1,126 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"textscout/common"
+	textsearch "textscout/inmemsearch"
+)
+
+// runs the script in a session over the sample dataset and returns what it printed after building the index
+func runShell(t *testing.T, script string) string {
+	t.Helper()
+	schema, err := common.LoadSchema("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	source, err := (&datasetFlags{path: sampleFilePath}).source()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	s := &shell{
+		out:      &out,
+		source:   source,
+		schema:   schema,
+		indexes:  make(map[string]*textsearch.InMemSearch),
+		analyzer: schemaAnalyzer,
+		limit:    10,
+		filters:  make(map[string]string),
+	}
+	if err := s.useAnalyzer(schemaAnalyzer); err != nil {
+		t.Fatal(err)
+	}
+	out.Reset()
+	if err := s.run(strings.NewReader(script)); err != nil {
+		t.Fatal(err)
+	}
+	return out.String()
+}
+
+func TestShell(t *testing.T) {
+	tests := []struct {
+		name   string
+		script string
+		want   []string
+		absent []string
+	}{
+		{
+			name:   "query",
+			script: "godzilla kong\n",
+			want:   []string{"schema and> #  SCORE", "823464  Godzilla x Kong: The New Empire", "1 of 1 hits in "},
+			absent: []string{"Kong: Skull Island"},
+		},
+		{
+			name:   "any of the query words",
+			script: ":or\ngodzilla kong\n:and\ngodzilla kong\n",
+			want:   []string{"schema or> #  SCORE", "3 of 3 hits in ", "schema and> #  SCORE", "1 of 1 hits in "},
+		},
+		{
+			name:   "limit",
+			script: ":limit 1\ngodzilla\n",
+			want:   []string{"940721  Godzilla Minus One", "1 of 2 hits in "},
+			absent: []string{"823464"},
+		},
+		{
+			name:   "filter",
+			script: ":filter original_language=ja\ngodzilla\n:filter\ngodzilla\n",
+			want:   []string{"schema and filter=original_language=ja> #  SCORE", "1 of 1 hits in ", "schema and> #  SCORE", "2 of 2 hits in "},
+		},
+		{
+			name:   "explain",
+			script: ":explain\ngodzilla\n:explain\n",
+			want:   []string{"schema and explain> #  SCORE", "query \"godzilla\"\n  standard (title, overview): godzilla", "#1 940721\n  1.9551 score(doc=1), sum of:", "weight(title:godzilla)", "schema and explain> schema and> "},
+		},
+		{
+			name:   "sort",
+			script: ":sort -popularity\n:sort\n",
+			want:   []string{"schema and sort=-popularity> schema and> "},
+		},
+		{
+			name:   "help",
+			script: ":help\n",
+			want:   []string{replHelp},
+		},
+		{
+			name:   "quit",
+			script: ":quit\ngodzilla\n",
+			want:   []string{"schema and> "},
+			absent: []string{"hits in", "\n"},
+		},
+		{
+			name:   "end of the input",
+			script: "\n\n",
+			want:   []string{"schema and> schema and> schema and> \n"},
+		},
+		{
+			name:   "bad input",
+			script: ":limit 0\n:limit ten\n:filter original_language\n:analyzer nope\n:analyze\n:frob\n",
+			want: []string{
+				"schema and> limit must be a positive integer\nschema and> limit must be a positive integer\n",
+				"a filter must be field=value, got: \"original_language\"",
+				"unknown analyzer: nope",
+				"specify the text to analyze",
+				"unknown command :frob, type :help for the commands",
+				// nothing changed the settings
+				"\nschema and> \n",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out := runShell(t, tt.script)
+			for _, want := range tt.want {
+				if !strings.Contains(out, want) {
+					t.Errorf("expected the output to contain %q, got:\n%s", want, out)
+				}
+			}
+			for _, absent := range tt.absent {
+				if strings.Contains(out, absent) {
+					t.Errorf("expected the output not to contain %q, got:\n%s", absent, out)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,240 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"textscout/common"
+	textsearch "textscout/inmemsearch"
+	"textscout/internal/backend"
+	"time"
+)
+
+// longest text of a field printed in a table cell
+const maxCellLength = 60
+
+// field=value, the flag can be repeated
+type filterFlag map[string]string
+
+func (f filterFlag) String() string {
+	pairs := make([]string, 0, len(f))
+	for name, value := range f {
+		pairs = append(pairs, name+"="+value)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+func (f filterFlag) Set(value string) error {
+	name, v, ok := strings.Cut(value, "=")
+	if !ok || name == "" {
+		return fmt.Errorf("a filter must be field=value, got: %q", value)
+	}
+	f[name] = v
+	return nil
+}
+
+// the printed result of a search
+type searchOutput struct {
+	Query    string                    `json:"query"`
+	SearchBy string                    `json:"search_by"`
+	TookMs   float64                   `json:"took_ms"`
+	Analysis *textsearch.QueryAnalysis `json:"analysis,omitempty"`
+	Hits     []map[string]interface{}  `json:"hits"`
+}
+
+func runSearch(fs *flag.FlagSet, args []string) error {
+	var configFlags configFlags
+	var datasetFlags datasetFlags
+	var backendFlags backendFlags
+	var union, explain bool
+	var sortBy, output string
+	var limit int
+	filters := make(filterFlag)
+	configFlags.register(fs)
+	datasetFlags.register(fs, "index")
+	backendFlags.register(fs, "")
+	fs.BoolVar(&union, "or", false, "match any of the query words instead of all of them")
+	fs.BoolVar(&explain, "explain", false, "print how the score of every hit was computed, inmemIndex only")
+	fs.StringVar(&sortBy, "sort", "", "sortable field to order the hits by, prefixed with - for descending. inmemIndex only")
+	fs.Var(filters, "filter", "field=value a hit must have, can be repeated. inmemIndex only")
+	fs.IntVar(&limit, "limit", 10, "number of hits to print")
+	fs.StringVar(&output, "output", "table", "table or json")
+	rest := parseArgs(fs, args)
+	if len(rest) == 0 {
+		return fmt.Errorf("%w: specify the query to search", errUsage)
+	}
+	if output != "table" && output != "json" {
+		return fmt.Errorf("%w: output must be table or json, got: %q", errUsage, output)
+	}
+	if limit <= 0 {
+		return fmt.Errorf("%w: limit must be positive", errUsage)
+	}
+	if err := backendFlags.resolve(&datasetFlags); err != nil {
+		return err
+	}
+
+	b, schema, err := openBackend(fs, &configFlags, &datasetFlags, &backendFlags)
+	if err != nil {
+		return err
+	}
+	if closer, ok := b.(io.Closer); ok {
+		defer closer.Close()
+	}
+
+	query := strings.Join(rest, " ")
+	req := backend.Request{
+		Query:   query,
+		Fields:  make(map[string]string),
+		Union:   union,
+		Filters: filters,
+		Sort:    sortBy,
+		Explain: explain,
+		Limit:   limit,
+	}
+	// the backends searching field by field get the query for every field
+	for _, f := range schema.IndexedFields() {
+		req.Fields[f.QueryParam] = query
+	}
+
+	start := time.Now()
+	result, err := b.Search(context.Background(), req)
+	if err != nil {
+		return err
+	}
+	took := time.Since(start)
+
+	if output == "json" {
+		return printJSON(os.Stdout, searchOutput{
+			Query:    query,
+			SearchBy: backendFlags.searchBy,
+			TookMs:   float64(took.Microseconds()) / 1000,
+			Analysis: result.Analysis,
+			Hits:     hitDocuments(schema, result.Hits),
+		})
+	}
+	printTable(os.Stdout, schema, result.Hits)
+	if explain {
+		printExplanations(os.Stdout, result)
+	}
+	fmt.Printf("%d hits in %s by %s\n", len(result.Hits), took.Round(time.Microsecond), backendFlags.searchBy)
+	return nil
+}
+
+// builds the backend of the flags, the in-memory index is built from the dataset first
+func openBackend(fs *flag.FlagSet, configFlags *configFlags, datasetFlags *datasetFlags, backendFlags *backendFlags) (backend.Backend, *common.Schema, error) {
+	config, err := configFlags.load(fs)
+	if err != nil {
+		return nil, nil, err
+	}
+	source, err := datasetFlags.source()
+	if err != nil {
+		return nil, nil, err
+	}
+	settings, schema, err := backendFlags.settings(source)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	start := time.Now()
+	b, err := backend.New(settings.SearchBy, backend.Options{
+		Config:           config,
+		Source:           settings.Source,
+		Schema:           schema,
+		TrigramThreshold: settings.TrigramThreshold,
+		SyncFromDatabase: settings.SyncFromDatabase,
+		SQLitePath:       settings.SQLitePath,
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	if inMem, ok := b.(*backend.InMem); ok {
+		log.Printf("built the index of %d documents in %s", inMem.DocCount(), time.Since(start).Round(time.Millisecond))
+	}
+	return b, schema, nil
+}
+
+// the stored fields of every hit along with its id and score, like the documents the api returns
+func hitDocuments(schema *common.Schema, hits []backend.Hit) []map[string]interface{} {
+	docs := make([]map[string]interface{}, 0, len(hits))
+	for _, hit := range hits {
+		d := schema.StoredFields(hit.Fields)
+		d["_id"] = hit.ID
+		d["_score"] = hit.Score
+		if hit.Explanation != nil {
+			d["_explanation"] = hit.Explanation
+		}
+		if len(hit.Highlights) != 0 {
+			d["_highlights"] = hit.Highlights
+		}
+		docs = append(docs, d)
+	}
+	return docs
+}
+
+// one row for every hit, ranked, with the text of its indexed fields
+func printTable(w io.Writer, schema *common.Schema, hits []backend.Hit) {
+	fields := schema.IndexedFields()
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	header := []string{"#", "SCORE", "ID"}
+	for _, f := range fields {
+		header = append(header, strings.ToUpper(f.Name))
+	}
+	fmt.Fprintln(tw, strings.Join(header, "\t"))
+	for i, hit := range hits {
+		row := []string{fmt.Sprint(i + 1), fmt.Sprintf("%.4f", hit.Score), hit.ID}
+		for _, f := range fields {
+			row = append(row, cell(common.FormatValue(hit.Fields[f.Name])))
+		}
+		fmt.Fprintln(tw, strings.Join(row, "\t"))
+	}
+	tw.Flush()
+}
+
+// the text on a single line, cut to maxCellLength runes
+func cell(text string) string {
+	text = strings.Join(strings.Fields(text), " ")
+	runes := []rune(text)
+	if len(runes) > maxCellLength {
+		return string(runes[:maxCellLength-1]) + "…"
+	}
+	return text
+}
+
+func printExplanations(w io.Writer, result backend.Result) {
+	if result.Analysis != nil {
+		fmt.Fprintf(w, "\nquery %q\n", result.Analysis.Text)
+		for _, a := range result.Analysis.Analyzers {
+			fmt.Fprintf(w, "  %s (%s): %s\n", a.Analyzer, strings.Join(a.Fields, ", "), strings.Join(a.Tokens, " "))
+		}
+	}
+	for i, hit := range result.Hits {
+		fmt.Fprintf(w, "\n#%d %s\n", i+1, hit.ID)
+		printExplanation(w, hit.Explanation, 1)
+	}
+	fmt.Fprintln(w)
+}
+
+// the explanation as a tree, every detail indented under what it adds up to
+func printExplanation(w io.Writer, e *textsearch.Explanation, depth int) {
+	if e == nil {
+		return
+	}
+	fmt.Fprintf(w, "%s%.4f %s\n", strings.Repeat("  ", depth), e.Value, e.Description)
+	for _, detail := range e.Details {
+		printExplanation(w, detail, depth+1)
+	}
+}
+
+func printJSON(w io.Writer, v interface{}) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(v)
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const sampleFilePath = "inmemsearch/testdata/sample.json"
+
+// runs the search command and returns what it printed
+func runSearchCommand(t *testing.T, args ...string) (string, error) {
+	t.Helper()
+	out, err := os.Create(filepath.Join(t.TempDir(), "stdout"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer out.Close()
+	stdout := os.Stdout
+	os.Stdout = out
+	defer func() { os.Stdout = stdout }()
+
+	var search command
+	for _, c := range commands {
+		if c.name == "search" {
+			search = c
+		}
+	}
+	runErr := search.run(newFlagSet(search), args)
+	printed, err := os.ReadFile(out.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(printed), runErr
+}
+
+func TestSearchCommand(t *testing.T) {
+	printed, err := runSearchCommand(t, "godzilla", "-index="+sampleFilePath, "-limit=2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(printed), "\n")
+	if len(lines) != 4 || !strings.HasPrefix(lines[0], "#  SCORE") {
+		t.Fatalf("expected a header, 2 hits and a summary, got:\n%s", printed)
+	}
+	if !strings.Contains(lines[1], "940721") || !strings.Contains(lines[1], "Godzilla Minus One") || !strings.Contains(lines[2], "823464") {
+		t.Errorf("expected Godzilla Minus One ranked before Godzilla x Kong, got:\n%s", printed)
+	}
+	if !strings.HasPrefix(lines[3], "2 hits in ") || !strings.HasSuffix(lines[3], " by inmemIndex") {
+		t.Errorf("expected the summary of 2 hits by inmemIndex, got: %s", lines[3])
+	}
+
+	printed, err = runSearchCommand(t, "-output=json", "-index", sampleFilePath, "kong")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var output struct {
+		Query    string                   `json:"query"`
+		SearchBy string                   `json:"search_by"`
+		Hits     []map[string]interface{} `json:"hits"`
+	}
+	if err := json.Unmarshal([]byte(printed), &output); err != nil {
+		t.Fatalf("expected json, got: %v\n%s", err, printed)
+	}
+	if output.Query != "kong" || output.SearchBy != "inmemIndex" || len(output.Hits) != 2 {
+		t.Fatalf("expected 2 hits for kong by inmemIndex, got: %+v", output)
+	}
+	if output.Hits[0]["_id"] != "293167" || output.Hits[0]["title"] != "Kong: Skull Island" {
+		t.Errorf("expected Kong: Skull Island first, got: %v", output.Hits[0])
+	}
+
+	// the wrong usages are reported as such
+	for _, args := range [][]string{
+		{"-index=" + sampleFilePath},
+		{"-index=" + sampleFilePath, "-output=xml", "kong"},
+		{"-index=" + sampleFilePath, "-limit=0", "kong"},
+		{"-searchBy=elastic", "kong"},
+	} {
+		if _, err := runSearchCommand(t, args...); !errors.Is(err, errUsage) {
+			t.Errorf("expected a usage error for %q, got: %v", args, err)
+		}
+	}
+}
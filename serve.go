@@ -0,0 +1,48 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"textscout/api"
+	"textscout/internal/backend"
+)
+
+func runServe(fs *flag.FlagSet, args []string) error {
+	var configFlags configFlags
+	var datasetFlags datasetFlags
+	var backendFlags backendFlags
+	var collectionsPath string
+	configFlags.register(fs)
+	datasetFlags.register(fs, "filePath")
+	backendFlags.register(fs, backend.Database)
+	fs.StringVar(&collectionsPath, "collections", "", "path to a json file listing more collections to serve along with the one from filePath")
+	if rest := parseArgs(fs, args); len(rest) != 0 {
+		return fmt.Errorf("%w: serve takes no args, got: %v", errUsage, rest)
+	}
+
+	config, err := configFlags.load(fs)
+	if err != nil {
+		return err
+	}
+	source, err := datasetFlags.source()
+	if err != nil {
+		return err
+	}
+	settings, schema, err := backendFlags.settings(source)
+	if err != nil {
+		return err
+	}
+	server, err := api.NewServer(config, settings, schema, collectionsPath)
+	if err != nil {
+		return err
+	}
+
+	// the requests in flight are drained on ctrl-c or when the orchestrator stops the process
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	return server.ListenAndServe(ctx)
+}
@@ -7,10 +7,64 @@ INSERT INTO movies(
 );
 
 -- name: GetMovieByTitle :many
-SELECT * FROM movies WHERE LOWER(movie_title) LIKE LOWER('%' || $1 || '%') LIMIT 5;
+SELECT adult, backdrop_path, genre_ids, movie_id, movie_language, movie_original_title, movie_overview, popularity, poster_path, release_date, movie_title, video, vote_average, vote_count FROM movies WHERE LOWER(movie_title) LIKE LOWER('%' || $1 || '%') LIMIT $2;
 
 -- name: GetMovieByDesc :many
-SELECT * FROM movies WHERE LOWER(movie_overview) LIKE LOWER('%' || $1 || '%') LIMIT 5;
+SELECT adult, backdrop_path, genre_ids, movie_id, movie_language, movie_original_title, movie_overview, popularity, poster_path, release_date, movie_title, video, vote_average, vote_count FROM movies WHERE LOWER(movie_overview) LIKE LOWER('%' || $1 || '%') LIMIT $2;
 
 -- name: GetMovieByTitleAndDesc :many
-SELECT * FROM movies WHERE LOWER(movie_title) LIKE LOWER('%' || $1 || '%') AND LOWER(movie_overview) LIKE LOWER('%' || $2 || '%') LIMIT 5;
\ No newline at end of file
+SELECT adult, backdrop_path, genre_ids, movie_id, movie_language, movie_original_title, movie_overview, popularity, poster_path, release_date, movie_title, video, vote_average, vote_count FROM movies WHERE LOWER(movie_title) LIKE LOWER('%' || $1 || '%') AND LOWER(movie_overview) LIKE LOWER('%' || $2 || '%') LIMIT $3;
+
+-- name: GetMovieByMovieID :one
+SELECT adult, backdrop_path, genre_ids, movie_id, movie_language, movie_original_title, movie_overview, popularity, poster_path, release_date, movie_title, video, vote_average, vote_count FROM movies WHERE movie_id = $1 LIMIT 1;
+
+-- name: DeleteMovie :execrows
+DELETE FROM movies WHERE movie_id = $1;
+
+-- name: UpsertMovie :batchone
+INSERT INTO movies(
+    adult, backdrop_path, genre_ids, movie_id, movie_language, movie_original_title, movie_overview,
+    popularity, poster_path, release_date, movie_title, video, vote_average, vote_count)
+    VALUES (
+    $1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14
+)
+ON CONFLICT (movie_id) DO UPDATE SET
+    adult = EXCLUDED.adult, backdrop_path = EXCLUDED.backdrop_path, genre_ids = EXCLUDED.genre_ids,
+    movie_language = EXCLUDED.movie_language, movie_original_title = EXCLUDED.movie_original_title,
+    movie_overview = EXCLUDED.movie_overview, popularity = EXCLUDED.popularity, poster_path = EXCLUDED.poster_path,
+    release_date = EXCLUDED.release_date, movie_title = EXCLUDED.movie_title, video = EXCLUDED.video,
+    vote_average = EXCLUDED.vote_average, vote_count = EXCLUDED.vote_count
+    WHERE (movies.adult, movies.backdrop_path, movies.genre_ids, movies.movie_language, movies.movie_original_title,
+        movies.movie_overview, movies.popularity, movies.poster_path, movies.release_date, movies.movie_title,
+        movies.video, movies.vote_average, movies.vote_count)
+    IS DISTINCT FROM (EXCLUDED.adult, EXCLUDED.backdrop_path, EXCLUDED.genre_ids, EXCLUDED.movie_language,
+        EXCLUDED.movie_original_title, EXCLUDED.movie_overview, EXCLUDED.popularity, EXCLUDED.poster_path,
+        EXCLUDED.release_date, EXCLUDED.movie_title, EXCLUDED.video, EXCLUDED.vote_average, EXCLUDED.vote_count)
+RETURNING (xmax = 0) AS inserted;
+
+-- name: SearchMoviesFTS :many
+SELECT movies.adult, movies.backdrop_path, movies.genre_ids, movies.movie_id, movies.movie_language, movies.movie_original_title, movies.movie_overview, movies.popularity, movies.poster_path, movies.release_date, movies.movie_title, movies.video, movies.vote_average, movies.vote_count,
+    ts_rank_cd(movies.search_vector, query) AS rank
+FROM movies, websearch_to_tsquery('english', sqlc.arg(query)::text) AS query
+WHERE movies.search_vector @@ query
+ORDER BY rank DESC, movies.movie_id
+LIMIT sqlc.arg(max_results);
+
+-- name: SetTrigramThreshold :exec
+SELECT set_config('pg_trgm.word_similarity_threshold', sqlc.arg(threshold)::float8::text, true);
+
+-- name: SearchMoviesTrigram :many
+SELECT movies.adult, movies.backdrop_path, movies.genre_ids, movies.movie_id, movies.movie_language, movies.movie_original_title, movies.movie_overview, movies.popularity, movies.poster_path, movies.release_date, movies.movie_title, movies.video, movies.vote_average, movies.vote_count,
+    GREATEST(word_similarity(LOWER(sqlc.arg(query)::text), LOWER(movies.movie_title)),
+        word_similarity(LOWER(sqlc.arg(query)::text), LOWER(movies.movie_overview)))::float8 AS score
+FROM movies
+WHERE LOWER(sqlc.arg(query)::text) <% LOWER(movies.movie_title)
+    OR LOWER(sqlc.arg(query)::text) <% LOWER(movies.movie_overview)
+ORDER BY score DESC, similarity(LOWER(movies.movie_title), LOWER(sqlc.arg(query)::text)) DESC, movies.movie_id
+LIMIT sqlc.arg(max_results);
+
+-- name: ListMoviesAfter :many
+SELECT adult, backdrop_path, genre_ids, movie_id, movie_language, movie_original_title, movie_overview, popularity, poster_path, release_date, movie_title, video, vote_average, vote_count FROM movies WHERE movie_id > sqlc.arg(after_movie_id) ORDER BY movie_id LIMIT sqlc.arg(max_results);
+
+-- name: CountMovies :one
+SELECT count(*) FROM movies;
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"runtime"
+	"textscout/common"
+	textsearch "textscout/inmemsearch"
+	"textscout/internal/backend"
+	"textscout/internal/database"
+	"time"
+)
+
+// the size of an index or a database, the counts it doesn't know are left out
+type indexStats struct {
+	SearchBy    string  `json:"search_by"`
+	Documents   int     `json:"documents"`
+	Terms       *int    `json:"terms,omitempty"`
+	BuildTimeMs float64 `json:"build_time_ms,omitempty"`
+	// heap in use once the index is built
+	HeapBytes uint64 `json:"heap_bytes,omitempty"`
+}
+
+func (s indexStats) print(output string) error {
+	if output == "json" {
+		return printJSON(os.Stdout, s)
+	}
+	fmt.Printf("search_by:  %s\n", s.SearchBy)
+	fmt.Printf("documents:  %d\n", s.Documents)
+	if s.Terms != nil {
+		fmt.Printf("terms:      %d\n", *s.Terms)
+	}
+	if s.BuildTimeMs != 0 {
+		fmt.Printf("build time: %.1fms\n", s.BuildTimeMs)
+	}
+	if s.HeapBytes != 0 {
+		fmt.Printf("heap:       %.1fMiB\n", float64(s.HeapBytes)/(1<<20))
+	}
+	return nil
+}
+
+func inMemStats(index *textsearch.InMemSearch, took time.Duration) indexStats {
+	terms := index.TermCount()
+	var mem runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&mem)
+	return indexStats{
+		SearchBy:    backend.InMemIndex,
+		Documents:   index.DocCount(),
+		Terms:       &terms,
+		BuildTimeMs: float64(took.Microseconds()) / 1000,
+		HeapBytes:   mem.HeapInuse,
+	}
+}
+
+func runIndex(fs *flag.FlagSet, args []string) error {
+	var datasetFlags datasetFlags
+	var schemaPath, output string
+	datasetFlags.register(fs, "filePath")
+	fs.StringVar(&schemaPath, "schema", "", "path to the json file describing the fields of the documents, defaults to the movies schema")
+	fs.StringVar(&output, "output", "table", "table or json")
+	rest := parseArgs(fs, args)
+	if len(rest) != 1 || rest[0] != "build" {
+		return fmt.Errorf("%w: specify build after index", errUsage)
+	}
+	if datasetFlags.path == "" {
+		return fmt.Errorf("%w: specify the filePath to build the index from", errUsage)
+	}
+
+	schema, err := common.LoadSchema(schemaPath)
+	if err != nil {
+		return err
+	}
+	source, err := datasetFlags.source()
+	if err != nil {
+		return err
+	}
+	// the index isn't kept, building it checks the dataset and the schema and tells its size
+	start := time.Now()
+	index, err := textsearch.NewInMemSearchFromSource(source, schema)
+	if err != nil {
+		return err
+	}
+	return inMemStats(index, time.Since(start)).print(output)
+}
+
+func runStats(fs *flag.FlagSet, args []string) error {
+	var configFlags configFlags
+	var datasetFlags datasetFlags
+	var backendFlags backendFlags
+	var output string
+	configFlags.register(fs)
+	datasetFlags.register(fs, "index")
+	backendFlags.register(fs, "")
+	fs.StringVar(&output, "output", "table", "table or json")
+	if rest := parseArgs(fs, args); len(rest) != 0 {
+		return fmt.Errorf("%w: stats takes no args, got: %v", errUsage, rest)
+	}
+	if err := backendFlags.resolve(&datasetFlags); err != nil {
+		return err
+	}
+
+	switch backendFlags.searchBy {
+	case backend.InMemIndex, backend.SQLite:
+		start := time.Now()
+		b, _, err := openBackend(fs, &configFlags, &datasetFlags, &backendFlags)
+		if err != nil {
+			return err
+		}
+		if inMem, ok := b.(*backend.InMem); ok {
+			defer inMem.Close()
+			return inMemStats(inMem.Index(), time.Since(start)).print(output)
+		}
+		defer b.(*backend.SQLiteFTS).Close()
+		return indexStats{SearchBy: backend.SQLite, Documents: b.(backend.DocumentCounter).DocCount()}.print(output)
+	}
+
+	// the postgres backends all search the movies table
+	config, err := configFlags.load(fs)
+	if err != nil {
+		return err
+	}
+	pgDB, err := database.NewPostgres(config.Postgres)
+	if err != nil {
+		return err
+	}
+	defer pgDB.DB.Close()
+	count, err := database.New(pgDB.DB).CountMovies(context.Background())
+	if err != nil {
+		return fmt.Errorf("failed to count the movies: %w", err)
+	}
+	log.Printf("the movies table is searched by %s", backendFlags.searchBy)
+	return indexStats{SearchBy: backendFlags.searchBy, Documents: int(count)}.print(output)
+}